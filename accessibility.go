@@ -0,0 +1,128 @@
+// Collect the alt text of each slide from the SVG's <title> and <desc>
+// elements, for learning platforms which want a description of every image.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Represent the accessibility text of one slide. Paths are relative to the
+// directory containing the file.
+type AltTextEntry struct {
+	Png string `json:"png"`
+	Image string `json:"image,omitempty"`
+	Layer string `json:"layer,omitempty"`
+	Title string `json:"title"`
+	Description string `json:"description"`
+	Notes string `json:"notes,omitempty"`
+}
+
+// Gather the text of the <title> and <desc> elements whose parents are
+// visible in the document as it stands, in document order. The first title
+// stands for the slide; the descriptions are joined into one. Hidden groups
+// are skipped whole, rather than checking each element's ancestors.
+func describeDocument(doc *etree.Document) (title string, description string) {
+	var descriptions []string
+	var walk func(parent *etree.Element)
+	walk = func(parent *etree.Element) {
+		if displayNone(parent) {
+			return
+		}
+		for _, element := range parent.ChildElements() {
+			if element.Tag != "title" && element.Tag != "desc" {
+				walk(element)
+				continue
+			}
+			text := strings.Join(strings.Fields(element.Text()), " ")
+			if text == "" || visibilityHidden(parent) {
+				continue
+			}
+			if element.Tag == "desc" {
+				descriptions = append(descriptions, text)
+			} else if title == "" {
+				title = text
+			}
+		}
+	}
+	if root := doc.Root(); root != nil {
+		walk(root)
+	}
+	return title, strings.Join(descriptions, " ")
+}
+
+// Look for any <desc> in an image's SVG, for validate --require-alt. Which
+// of them are visible on each slide is only known once the layers are
+// applied, so rendering checks again slide by slide.
+func (image *Image) checkDescriptions(fetcher *remoteFetcher) error {
+	inFile, err := image.sourceFile(fetcher)
+	if err != nil {
+		return err
+	}
+	doc := etree.NewDocument()
+	if err := readSVG(doc, inFile); err != nil {
+		return fmt.Errorf("%s: error reading SVG XML file: %w", image.Filename, err)
+	}
+	for _, element := range doc.FindElements("//desc") {
+		if strings.TrimSpace(element.Text()) != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: no <desc> to describe its slides, which --require-alt needs", image.Filename)
+}
+
+// Write the title, description and notes of every slide, as CSV if the
+// filename ends in .csv and as JSON otherwise. The layer's title, if it has
+// one, takes the place of the SVG's.
+func writeAltText(filename string, slides []*Slide) error {
+	dir := filepath.Dir(filename)
+	entries := []*AltTextEntry{}
+	for _, slide := range slides {
+		png, err := filepath.Rel(dir, slide.PngFile)
+		if err != nil {
+			png = slide.PngFile
+		}
+		title := slide.Title
+		if title == "" {
+			title = slide.AltTitle
+		}
+		entries = append(entries, &AltTextEntry{
+			Png: filepath.ToSlash(png),
+			Image: slide.Image,
+			Layer: slide.Layer,
+			Title: title,
+			Description: slide.AltText,
+			Notes: strings.TrimSpace(slide.Notes),
+		})
+	}
+
+	if strings.ToLower(filepath.Ext(filename)) != ".csv" {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filename, append(data, '\n'), 0644)
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := csv.NewWriter(file)
+	w.Write([]string{"png", "image", "layer", "title", "description", "notes"})
+	for _, entry := range entries {
+		w.Write([]string{entry.Png, entry.Image, entry.Layer, entry.Title, entry.Description, entry.Notes})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
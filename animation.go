@@ -0,0 +1,203 @@
+// Package a sequence of frames (such as a camera move) into a single animated
+// file, which is easier to drop into an editor than a folder of PNGs.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// The animated formats frames can be packaged into, with the extension each
+// is written with. APNG gets its own extension so that it doesn't replace
+// the layer's still PNG.
+var animationExtensions = map[string]string{"gif": ".gif", "apng": ".apng", "webm": ".webm"}
+
+// The frame rate animations play at unless one is configured.
+const defaultAnimationFPS = 30
+
+// The colors of an animated GIF: the web-safe palette, plus a transparent
+// entry so that transparent backgrounds stay transparent rather than black.
+var gifPalette = append(color.Palette{color.Transparent}, palette.WebSafe...)
+
+// Write the frames as an animated GIF, dithered to the web-safe palette since
+// GIF only has 256 colors. Each frame is decoded in turn, but has to be kept
+// (at a byte per pixel) until the whole GIF is encoded.
+func writeGIF(filename string, framePngs []string, fps int) error {
+	animation := &gif.GIF{}
+	for _, framePng := range framePngs {
+		frame, err := readPNG(framePng)
+		if err != nil {
+			return err
+		}
+		paletted := image.NewPaletted(frame.Bounds(), gifPalette)
+		draw.FloydSteinberg.Draw(paletted, frame.Bounds(), frame, frame.Bounds().Min)
+		animation.Image = append(animation.Image, paletted)
+		animation.Delay = append(animation.Delay, max(100/fps, 1))
+		// Otherwise what shows through a frame's transparent pixels is the
+		// frame before it.
+		animation.Disposal = append(animation.Disposal, gif.DisposalBackground)
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(file, animation); err != nil {
+		file.Close()
+		return fmt.Errorf("encoding %s: %w", filename, err)
+	}
+	return file.Close()
+}
+
+// Compress an image as the zlib stream of 8-bit RGBA rows that makes up PNG
+// image data, so that every frame of an APNG has the same format.
+func pngImageData(frame image.Image) ([]byte, error) {
+	bounds := frame.Bounds()
+	rgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), frame, bounds.Min, draw.Src)
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	for y := 0; y < rgba.Rect.Dy(); y++ {
+		// Each row starts with its filter type, which is always none.
+		writer.Write([]byte{0})
+		writer.Write(rgba.Pix[y*rgba.Stride : y*rgba.Stride+rgba.Rect.Dx()*4])
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// Write the frames as an APNG, which keeps their full color and alpha. The
+// first frame doubles as the still image for viewers without APNG support.
+// The frames are decoded and written out one at a time, so that only one is
+// in memory at once.
+func writeAPNG(filename string, framePngs []string, fps int) error {
+	size, err := pngSize(framePngs[0])
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := writeAPNGFrames(bufio.NewWriter(file), framePngs, size, fps); err != nil {
+		file.Close()
+		os.Remove(filename)
+		return err
+	}
+	return file.Close()
+}
+
+// Write out the chunks of an APNG, whose frames are all the given size.
+func writeAPNGFrames(w *bufio.Writer, framePngs []string, size image.Point, fps int) error {
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:], uint32(size.X))
+	binary.BigEndian.PutUint32(header[4:], uint32(size.Y))
+	header[8], header[9] = 8, 6
+	animationControl := make([]byte, 8)
+	binary.BigEndian.PutUint32(animationControl[0:], uint32(len(framePngs)))
+	w.Write(pngSignature)
+	writePNGChunk(w, &pngChunk{Type: "IHDR", Data: header})
+	writePNGChunk(w, &pngChunk{Type: "acTL", Data: animationControl})
+
+	sequence := uint32(0)
+	for i, framePng := range framePngs {
+		frame, err := readPNG(framePng)
+		if err != nil {
+			return err
+		}
+		if frame.Bounds().Size() != size {
+			return fmt.Errorf("frame %d is %v rather than %v", i+1, frame.Bounds().Size(), size)
+		}
+		frameControl := make([]byte, 26)
+		binary.BigEndian.PutUint32(frameControl[0:], sequence)
+		binary.BigEndian.PutUint32(frameControl[4:], uint32(size.X))
+		binary.BigEndian.PutUint32(frameControl[8:], uint32(size.Y))
+		binary.BigEndian.PutUint16(frameControl[20:], 1)
+		binary.BigEndian.PutUint16(frameControl[22:], uint16(fps))
+		writePNGChunk(w, &pngChunk{Type: "fcTL", Data: frameControl})
+		sequence++
+
+		data, err := pngImageData(frame)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			writePNGChunk(w, &pngChunk{Type: "IDAT", Data: data})
+			continue
+		}
+		// Later frames' data is the same, prefixed with a sequence number.
+		frameData := binary.BigEndian.AppendUint32(nil, sequence)
+		writePNGChunk(w, &pngChunk{Type: "fdAT", Data: append(frameData, data...)})
+		sequence++
+	}
+	writePNGChunk(w, &pngChunk{Type: "IEND"})
+	return w.Flush()
+}
+
+// Write the frames as a WebM clip with ffmpeg (which must be installed), in
+// VP9 with the alpha channel kept.
+func writeWebM(filename string, framePngs []string, fps int) error {
+	var list strings.Builder
+	list.WriteString("ffconcat version 1.0\n")
+	for _, framePng := range framePngs {
+		fmt.Fprintf(&list, "file %s\nduration %f\n", quoteConcatPath(framePng), 1/float64(fps))
+	}
+	listFile, err := os.CreateTemp("", "bulletpointer-frames-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(listFile.Name())
+	if _, err := listFile.WriteString(list.String()); err != nil {
+		listFile.Close()
+		return err
+	}
+	listFile.Close()
+
+	cmd := exec.Command("ffmpeg", "-y", "-loglevel", "error", "-f", "concat", "-safe", "0", "-i", listFile.Name(),
+		"-r", fmt.Sprint(fps), "-c:v", "libvpx-vp9", "-pix_fmt", "yuva420p", filename)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if text := trimOutput(string(output), maxRendererOutput); text != "" {
+			err = fmt.Errorf("%w: %s", err, text)
+		}
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	return nil
+}
+
+// Package a layer's frames into each of the requested animated formats, named
+// after the layer's PNG.
+func writeAnimations(pngFile string, framePngs []string, formats []string, fps int) error {
+	if fps <= 0 {
+		fps = defaultAnimationFPS
+	}
+	for _, format := range formats {
+		filename := strings.TrimSuffix(pngFile, ".png") + animationExtensions[format]
+		var err error
+		switch format {
+		case "gif":
+			err = writeGIF(filename, framePngs, fps)
+		case "apng":
+			err = writeAPNG(filename, framePngs, fps)
+		case "webm":
+			err = writeWebM(filename, framePngs, fps)
+		}
+		if err != nil {
+			return fmt.Errorf("could not write %s: %w", filename, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Write frames with a transparent background and a red square which moves
+// along, returning their filenames.
+func writeTestFrames(t *testing.T, count int) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var framePngs []string
+	for i := range count {
+		frame := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+		for y := 5; y < 15; y++ {
+			for x := i * 10; x < i*10+10; x++ {
+				frame.Set(x, y, color.NRGBA{R: 255, A: 255})
+			}
+		}
+		var data bytes.Buffer
+		if err := png.Encode(&data, frame); err != nil {
+			t.Fatal(err)
+		}
+		framePng := filepath.Join(dir, fmt.Sprintf("frame%d.png", i))
+		if err := os.WriteFile(framePng, data.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		framePngs = append(framePngs, framePng)
+	}
+	return framePngs
+}
+
+func TestWriteGIF(t *testing.T) {
+	framePngs := writeTestFrames(t, 3)
+	filename := filepath.Join(t.TempDir(), "anim.gif")
+	if err := writeGIF(filename, framePngs, 10); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	animation, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(animation.Image) != 3 {
+		t.Fatalf("%d frames, want 3", len(animation.Image))
+	}
+	for i, frame := range animation.Image {
+		if _, _, _, a := frame.At(39-i*10, 0).RGBA(); a != 0 {
+			t.Errorf("frame %d: the background has alpha %d, want it transparent", i+1, a)
+		}
+		if r, _, _, a := frame.At(i*10+5, 10).RGBA(); r != 0xffff || a != 0xffff {
+			t.Errorf("frame %d: the square is %v, want red", i+1, frame.At(i*10+5, 10))
+		}
+		if animation.Disposal[i] != gif.DisposalBackground {
+			t.Errorf("frame %d: disposal %d, want the background restored", i+1, animation.Disposal[i])
+		}
+	}
+}
+
+func TestWriteAPNG(t *testing.T) {
+	framePngs := writeTestFrames(t, 3)
+	filename := filepath.Join(t.TempDir(), "anim.apng")
+	if err := writeAPNG(filename, framePngs, 10); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := parsePNGChunks(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, chunk := range chunks {
+		types = append(types, chunk.Type)
+	}
+	want := []string{"IHDR", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "fcTL", "fdAT", "IEND"}
+	if !slices.Equal(types, want) {
+		t.Errorf("chunks %v, want %v", types, want)
+	}
+	// Viewers without APNG support show the first frame.
+	still, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := still.At(30, 0).RGBA(); a != 0 {
+		t.Errorf("the still's background has alpha %d, want it transparent", a)
+	}
+	if r, _, _, _ := still.At(5, 10).RGBA(); r != 0xffff {
+		t.Errorf("the still's square is %v, want red", still.At(5, 10))
+	}
+
+	mismatched := append(framePngs, writeSizedTestFrame(t, 20, 20))
+	if err := writeAPNG(filename, mismatched, 10); err == nil {
+		t.Errorf("frames of different sizes did not fail")
+	} else if _, err := os.Stat(filename); err == nil {
+		t.Errorf("a failed APNG was left behind")
+	}
+}
+
+// Write a blank frame of the given size.
+func writeSizedTestFrame(t *testing.T, width int, height int) string {
+	t.Helper()
+	var data bytes.Buffer
+	if err := png.Encode(&data, image.NewNRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	framePng := filepath.Join(t.TempDir(), "odd.png")
+	if err := os.WriteFile(framePng, data.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return framePng
+}
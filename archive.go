@@ -0,0 +1,149 @@
+// Package up the outputs of a run into a single tar or zip file, either to
+// stream to stdout or to publish as one artifact.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Work out the archive format from a filename, defaulting to tar.
+func archiveFormat(filename string) string {
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	}
+	return "tar"
+}
+
+// Write every file under a directory into an archive, in sorted order and
+// with paths relative to the directory (using forward slashes), optionally
+// under a top-level prefix. If include is given, only the files it accepts
+// are written.
+func writeArchive(w io.Writer, dir string, format string, prefix string, include func(string) bool) error {
+	files, err := listFiles(dir)
+	if err != nil {
+		return err
+	}
+	if include != nil {
+		files = slices.DeleteFunc(files, func(name string) bool { return !include(name) })
+	}
+	switch format {
+	case "zip":
+		archive := zip.NewWriter(w)
+		for _, name := range files {
+			if err := addZipFile(archive, filepath.Join(dir, filepath.FromSlash(name)), prefix+name); err != nil {
+				return err
+			}
+		}
+		return archive.Close()
+	case "tar", "tar.gz":
+		if format == "tar.gz" {
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			w = gz
+		}
+		archive := tar.NewWriter(w)
+		for _, name := range files {
+			if err := addTarFile(archive, filepath.Join(dir, filepath.FromSlash(name)), prefix+name); err != nil {
+				return err
+			}
+		}
+		return archive.Close()
+	}
+	return fmt.Errorf("unknown archive format %q (use tar, tar.gz or zip)", format)
+}
+
+// Add one file to a zip archive.
+func addZipFile(archive *zip.Writer, file string, name string) error {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(stat)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	out, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// Add one file to a tar archive.
+func addTarFile(archive *tar.Writer, file string, name string) error {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(stat, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(archive, in)
+	return err
+}
+
+// Package the outputs in a directory into an archive file, named for the
+// archive (deck.zip holds deck/...) so that unpacking it never spills files
+// into the current directory. Intermediate SVGs are left out, as is the
+// archive itself if it is being written into the same directory.
+func writeArchiveFile(filename string, dir string) error {
+	base := filepath.Base(filename)
+	for _, ext := range []string{".zip", ".tar.gz", ".tgz", ".tar"} {
+		if strings.HasSuffix(strings.ToLower(base), ext) {
+			base = base[:len(base)-len(ext)]
+			break
+		}
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(filename), ".archive-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	absArchive, _ := filepath.Abs(filename)
+	absTemp, _ := filepath.Abs(temp.Name())
+	absDir, _ := filepath.Abs(dir)
+	include := func(name string) bool {
+		file := filepath.Join(absDir, filepath.FromSlash(name))
+		return !isSVGName(name) && file != absArchive && file != absTemp
+	}
+	err = writeArchive(temp, dir, archiveFormat(filename), base+"/", include)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filename)
+}
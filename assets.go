@@ -0,0 +1,232 @@
+// Keep the raster images (and other files) an SVG links to working once the
+// intermediate copy of the SVG is written somewhere else, or embed them in it
+// with inline_assets, for a renderer which can't see the files at all.
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Find the attributes which link elements to files outside the document:
+// the href (or xlink:href) of an image, and of anything else that isn't a
+// reference within the document itself or an inline data: URI.
+func assetRefs(doc *etree.Document) []*etree.Attr {
+	var refs []*etree.Attr
+	var walk func(element *etree.Element)
+	walk = func(element *etree.Element) {
+		for i := range element.Attr {
+			attr := &element.Attr[i]
+			if attr.Key != "href" || (attr.Space != "" && attr.Space != "xlink") {
+				continue
+			}
+			// Links which are only followed when the SVG is viewed.
+			if element.Tag == "a" {
+				continue
+			}
+			if isAssetRef(attr.Value) {
+				refs = append(refs, attr)
+			}
+		}
+		for _, child := range element.ChildElements() {
+			walk(child)
+		}
+	}
+	if root := doc.Root(); root != nil {
+		walk(root)
+	}
+	return refs
+}
+
+// List the links of an element and everything inside it which may be to
+// files: hrefs (other than those of <a> elements, which are only followed
+// when the SVG is viewed) and the url() references of style sheets and style
+// attributes, such as the src of an @font-face.
+func linkedFiles(root *etree.Element) []string {
+	var refs []string
+	addCSS := func(css string) {
+		for _, match := range cssURL.FindAllStringSubmatch(css, -1) {
+			refs = append(refs, match[2])
+		}
+	}
+	for _, element := range append(root.FindElements(".//*"), root) {
+		for _, attr := range element.Attr {
+			switch {
+			case attr.Key == "href" && (attr.Space == "" || attr.Space == "xlink") && element.Tag != "a":
+				refs = append(refs, attr.Value)
+			case strings.Contains(attr.Value, "url("):
+				addCSS(attr.Value)
+			}
+		}
+		if element.Tag == "style" {
+			addCSS(element.Text())
+		}
+	}
+	return refs
+}
+
+// Report whether an href refers to a file, as opposed to something within
+// the document or a data: URI.
+func isAssetRef(href string) bool {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return false
+	}
+	u, err := url.Parse(href)
+	// A single letter scheme is really a Windows drive.
+	return err != nil || len(u.Scheme) <= 1 || u.Scheme == "file"
+}
+
+// Work out the absolute path of the file an href refers to, relative to the
+// directory of the SVG.
+func assetPath(dir string, href string) string {
+	href = strings.TrimSpace(href)
+	if u, err := url.Parse(href); err == nil && u.Scheme == "file" {
+		href = u.Path
+		if len(href) > 2 && href[0] == '/' && href[2] == ':' {
+			href = href[1:]
+		}
+	} else if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	name := filepath.FromSlash(href)
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	return name
+}
+
+// Turn an absolute path into a file:// URI.
+func fileURI(name string) string {
+	slashed := filepath.ToSlash(name)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
+
+// Point every file the document links to at its absolute location, so that
+// the links still work from wherever the document is written. The files are
+// relative to the original SVG (the source, as configured), which for a
+// remote one means relative to its URL; inFile is where it is on disk.
+// Returns an error naming every linked file which is missing.
+func resolveAssets(doc *etree.Document, source string, inFile string) error {
+	var base *url.URL
+	if isRemote(source) {
+		base, _ = url.Parse(source)
+	}
+	var missing []string
+	for _, attr := range assetRefs(doc) {
+		if base != nil && base.Scheme != "s3" {
+			if ref, err := url.Parse(strings.TrimSpace(attr.Value)); err == nil && ref.Scheme == "" {
+				attr.Value = base.ResolveReference(ref).String()
+			}
+			continue
+		}
+		name := assetPath(filepath.Dir(inFile), attr.Value)
+		if _, err := os.Stat(name); err != nil {
+			missing = append(missing, attr.Value)
+			continue
+		}
+		attr.Value = fileURI(name)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("linked files are missing: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Find the url() references of CSS, such as the src of an @font-face.
+var cssURL = regexp.MustCompile(`url\(\s*(['"]?)([^'")]*)['"]?\s*\)`)
+
+// Encode a file as a data: URI, with its media type going by its extension
+// or, failing that, its contents.
+func dataURI(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	mediaType := mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+	if mediaType == "" || strings.HasPrefix(mediaType, "text/plain") {
+		mediaType = http.DetectContentType(data)
+	}
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Embed every file that an element and everything inside it link to as a
+// data: URI: images and the like by their href, and fonts (or anything else)
+// by the url() of a style sheet or style attribute. The links are relative to
+// dir unless resolveAssets has already made them absolute; remote ones are
+// downloaded with the fetcher. A file linked more than once is only read once,
+// though it is embedded each time.
+func inlineAssets(root *etree.Element, dir string, fetcher *remoteFetcher) error {
+	uris := make(map[string]string)
+	var missing []string
+	inline := func(ref string) string {
+		ref = strings.TrimSpace(ref)
+		if !isAssetRef(ref) && !isRemote(ref) {
+			return ref
+		}
+		if uri, ok := uris[ref]; ok {
+			return uri
+		}
+		name := assetPath(dir, ref)
+		var err error
+		if isRemote(ref) {
+			name, err = fetcher.fetch(ref)
+		}
+		uri := ref
+		if err == nil {
+			uri, err = dataURI(name)
+		}
+		if err != nil {
+			missing = append(missing, ref)
+			uri = ref
+		}
+		uris[ref] = uri
+		return uri
+	}
+	inlineCSS := func(css string) string {
+		return cssURL.ReplaceAllStringFunc(css, func(match string) string {
+			ref := cssURL.FindStringSubmatch(match)[2]
+			if uri := inline(ref); uri != strings.TrimSpace(ref) {
+				// Base64 needs no quoting in CSS.
+				return "url(" + uri + ")"
+			}
+			return match
+		})
+	}
+
+	for _, element := range append(root.FindElements(".//*"), root) {
+		for i := range element.Attr {
+			attr := &element.Attr[i]
+			switch {
+			case attr.Key == "href" && (attr.Space == "" || attr.Space == "xlink") && element.Tag != "a":
+				attr.Value = inline(attr.Value)
+			case strings.Contains(attr.Value, "url("):
+				attr.Value = inlineCSS(attr.Value)
+			}
+		}
+		if element.Tag == "style" && strings.Contains(element.Text(), "url(") {
+			element.SetText(inlineCSS(element.Text()))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("could not embed the linked files %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
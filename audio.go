@@ -0,0 +1,118 @@
+// Probe the length of narration audio files, so that a layer can simply be
+// shown for as long as its narration lasts.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Determine the length of an audio file in seconds. WAV files are read
+// directly; anything else is handed to ffprobe.
+func audioDuration(filename string) (float64, error) {
+	if strings.ToLower(filepath.Ext(filename)) == ".wav" {
+		return wavDuration(filename)
+	}
+	return ffprobeDuration(filename)
+}
+
+// Read the duration out of a RIFF/WAVE header without decoding any audio:
+// the length of the data chunk divided by the byte rate from the fmt chunk.
+func wavDuration(filename string) (float64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var header [12]byte
+	if _, err := io.ReadFull(file, header[:]); err != nil {
+		return 0, fmt.Errorf("reading %s: %w", filename, err)
+	}
+	if !bytes.Equal(header[0:4], []byte("RIFF")) || !bytes.Equal(header[8:12], []byte("WAVE")) {
+		return 0, fmt.Errorf("%s is not a RIFF/WAVE file", filename)
+	}
+
+	var byteRate uint32
+	for {
+		var chunkHeader [8]byte
+		if _, err := io.ReadFull(file, chunkHeader[:]); err != nil {
+			return 0, fmt.Errorf("%s has no data chunk", filename)
+		}
+		chunkID := string(chunkHeader[0:4])
+		chunkSize := binary.LittleEndian.Uint32(chunkHeader[4:8])
+
+		switch chunkID {
+		case "fmt ":
+			// Only the first 16 bytes are needed, whatever size the chunk
+			// claims to be; the rest (of an extensible format) is skipped.
+			var fmtChunk [16]byte
+			if chunkSize < 16 {
+				return 0, fmt.Errorf("%s has a truncated fmt chunk", filename)
+			}
+			if _, err := io.ReadFull(file, fmtChunk[:]); err != nil {
+				return 0, fmt.Errorf("%s has a truncated fmt chunk", filename)
+			}
+			byteRate = binary.LittleEndian.Uint32(fmtChunk[8:12])
+			if _, err := file.Seek(int64(chunkSize)-16, io.SeekCurrent); err != nil {
+				return 0, err
+			}
+		case "data":
+			if byteRate == 0 {
+				return 0, fmt.Errorf("%s has no usable fmt chunk before its data", filename)
+			}
+			// Streamed WAV files leave the size at its maximum value, in
+			// which case the data runs until the end of the file.
+			if chunkSize == 0xFFFFFFFF {
+				offset, _ := file.Seek(0, io.SeekCurrent)
+				end, err := file.Seek(0, io.SeekEnd)
+				if err != nil {
+					return 0, err
+				}
+				chunkSize = uint32(end - offset)
+			}
+			return float64(chunkSize) / float64(byteRate), nil
+		default:
+			if _, err := file.Seek(int64(chunkSize), io.SeekCurrent); err != nil {
+				return 0, err
+			}
+		}
+
+		// Chunks are padded to an even number of bytes.
+		if chunkSize%2 == 1 {
+			if _, err := file.Seek(1, io.SeekCurrent); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// Ask ffprobe for the duration of any other kind of audio file.
+func ffprobeDuration(filename string) (float64, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return 0, err
+	}
+	ffprobe, err := exec.LookPath("ffprobe")
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe is needed to read the length of %s: %w", filename, err)
+	}
+
+	output, err := exec.Command(ffprobe, "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", filename).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed on %s: %w", filename, err)
+	}
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe gave no duration for %s", filename)
+	}
+	return duration, nil
+}
@@ -0,0 +1,136 @@
+// Render SVGs without spelling out their layers. An image with "layers: auto"
+// reveals its Inkscape layers one after another, from the bottom up. With
+// --auto there is no config at all: every SVG found under the directories
+// given is an image of its own, with a single layer showing it as it is, or
+// with --auto-layers the same reveal. The outputs mirror the layout of the
+// directories.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Find the Inkscape layers directly under the root of an SVG which are
+// showing, in z-order (from the bottom up). Sublayers go with their layer,
+// and layers hidden in the SVG are left hidden.
+func stackedLayers(doc *etree.Document) []*etree.Element {
+	root := doc.Root()
+	if root == nil {
+		return nil
+	}
+	var layers []*etree.Element
+	for _, child := range root.ChildElements() {
+		if isInkscapeLayer(child) && child.SelectAttrValue("id", "") != "" && !displayNone(child) {
+			layers = append(layers, child)
+		}
+	}
+	return layers
+}
+
+// Build a progressive reveal of an SVG's Inkscape layers: the bottom one
+// alone first, and then each layer above it added in turn. An SVG with
+// fewer than two layers has a single layer, showing it as it is. The
+// suffixes are left to be numbered.
+func revealLayers(doc *etree.Document) []*ImageLayer {
+	var ids []string
+	for _, layer := range stackedLayers(doc) {
+		ids = append(ids, layer.SelectAttrValue("id", ""))
+	}
+	if len(ids) < 2 {
+		return []*ImageLayer{{suffixSet: true}}
+	}
+	layers := []*ImageLayer{{HideIDs: ids[1:]}}
+	for _, id := range ids[1:] {
+		layers = append(layers, &ImageLayer{ShowIDs: []string{id}})
+	}
+	return layers
+}
+
+// Derive an image's layers from the Inkscape layers in its SVG, for "layers:
+// auto" and --auto-layers.
+func (image *Image) deriveLayers() error {
+	inFile, err := image.sourceFile(nil)
+	if err != nil {
+		return err
+	}
+	doc := etree.NewDocument()
+	if err := readSVG(doc, inFile); err != nil {
+		return fmt.Errorf("%s: error reading SVG XML file: %w", inFile, err)
+	}
+	image.Layers = revealLayers(doc)
+	return nil
+}
+
+// Find the SVGs under each of the sources (or the sources themselves, for
+// SVG files) and make an image of each, leaving out anything inside the
+// output directory and hidden directories such as .git. The outputs of an
+// SVG in a subdirectory go in the same subdirectory of the output dir.
+func discoverImages(sources []string, outDir string, nameTemplate string, derive bool) ([]*Image, []string, error) {
+	absOut, _ := filepath.Abs(outDir)
+	if nameTemplate == "" {
+		nameTemplate = defaultNameTemplate
+	}
+	var images []*Image
+	for _, source := range sources {
+		dir, files := source, []string{}
+		err := filepath.WalkDir(source, func(name string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				abs, _ := filepath.Abs(name)
+				if abs == absOut || (name != source && strings.HasPrefix(entry.Name(), ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if isSVGName(name) {
+				files = append(files, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, sources, fmt.Errorf("could not search %s: %w", source, err)
+		}
+		if isSVGName(source) {
+			dir = filepath.Dir(source)
+		} else if len(files) == 0 {
+			return nil, sources, fmt.Errorf("no SVGs found in %s", source)
+		}
+
+		for _, file := range files {
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return nil, sources, err
+			}
+			image := &Image{Filename: filepath.ToSlash(rel), baseDir: dir, configFile: source}
+			if subDir := path.Dir(image.Filename); subDir != "." {
+				image.NameTemplate = path.Join(subDir, nameTemplate)
+			}
+			image.Layers = []*ImageLayer{{suffixSet: true}}
+			if derive {
+				if err := image.deriveLayers(); err != nil {
+					return nil, sources, err
+				}
+			}
+			images = append(images, image)
+		}
+	}
+	return images, sources, nil
+}
+
+// Load the images to render: from the config files, or with --auto, from
+// the SVGs found in the directories given instead.
+func (options *RenderOptions) loadImages() ([]*Image, []string, error) {
+	if options.Auto {
+		return discoverImages(options.Configs, options.OutDir, options.NameTemplate, options.AutoLayers)
+	}
+	return loadImages(options.Configs, options.limits)
+}
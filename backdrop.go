@@ -0,0 +1,54 @@
+// Swap the backdrop behind a layer's content, so that the same slides can be
+// rendered on a dark theme for video and a light one for a printed handout.
+
+package main
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Work out a layer's backdrop: the element to show behind it and the color
+// to give it, where the layer's own settings take precedence over the image's.
+func (layer *ImageLayer) backdrop(image *Image) (string, string) {
+	return cmp.Or(layer.BackgroundID, image.BackgroundID), cmp.Or(layer.BackgroundColor, image.BackgroundColor)
+}
+
+// List every backdrop the image or any of its layers uses, which are the ones
+// swapped between.
+func (image *Image) backdropIDs() []string {
+	var ids []string
+	add := func(id string) {
+		if id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	add(image.BackgroundID)
+	for _, layer := range image.Layers {
+		add(layer.BackgroundID)
+	}
+	return ids
+}
+
+// Show the layer's backdrop and hide all the others, then give it the
+// layer's background color (as its fill). Without a backdrop element, the
+// color is used for the page behind the drawing instead, by exportOptions.
+func (layer *ImageLayer) applyBackdrop(image *Image, index *elementIndex) error {
+	id, color := layer.backdrop(image)
+	if id == "" {
+		return nil
+	}
+	for _, other := range image.backdropIDs() {
+		elements, err := index.resolve(other)
+		if err != nil {
+			return err
+		}
+		for _, element := range elements {
+			setHidden(element, other != id)
+			if other == id && color != "" {
+				setStyleProperty(element, "fill", color)
+			}
+		}
+	}
+	return nil
+}
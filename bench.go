@@ -0,0 +1,117 @@
+// Time a render phase by phase (parsing, DOM manipulation, serialization and
+// the renderer itself), to show where the time goes on a big deck and what
+// difference a different renderer would make, before committing to one.
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The phases which bench reports, in the order they happen to a layer.
+var benchPhases = []string{"parse", "mutate", "optimize", "serialize", "render", "encode"}
+
+// Report which phase a profile stack's time belongs to, by its last frame.
+func benchPhase(stack string) string {
+	frames := strings.Split(stack, profileSeparator)
+	phase := frames[len(frames)-1]
+	if phase == "animate" {
+		return "encode"
+	}
+	return phase
+}
+
+// Render the configs runs times with the given renderer (or the ones their
+// configs give, if empty), each time into a fresh output directory so that
+// nothing is skipped as up to date, and print the time spent in each phase.
+func benchRenderer(options RenderOptions, renderer string, runs int) error {
+	options.renderer = renderer
+	options.profile = NewProfile()
+	options.Resume = false
+	options.Progress = false
+	layers := 0
+	var wall time.Duration
+	for range runs {
+		outDir, err := os.MkdirTemp("", "bulletpointer-bench-")
+		if err != nil {
+			return fmt.Errorf("could not create output dir: %w", err)
+		}
+		options.OutDir = outDir
+		start := time.Now()
+		slides, err := options.renderSlides()
+		wall += time.Since(start)
+		os.RemoveAll(outDir)
+		if err != nil {
+			return err
+		}
+		layers = len(slides)
+	}
+
+	totals := make(map[string]time.Duration)
+	for stack, elapsed := range options.profile.samples {
+		totals[benchPhase(stack)] += elapsed
+	}
+	var measured time.Duration
+	for _, elapsed := range totals {
+		measured += elapsed
+	}
+	if other := wall - measured; other > 0 {
+		totals["other"] = other
+	}
+
+	name := cmp.Or(renderer, "as configured")
+	fmt.Printf("\nRenderer %s: %d layers in %s per run (%d runs)\n", name, layers, (wall / time.Duration(runs)).Round(time.Millisecond), runs)
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "PHASE\tPER RUN\tPER LAYER\tSHARE\t")
+	for _, phase := range slices.Concat(benchPhases, []string{"other"}) {
+		elapsed, ok := totals[phase]
+		if !ok {
+			continue
+		}
+		perRun := elapsed / time.Duration(runs)
+		perLayer := time.Duration(0)
+		if layers > 0 {
+			perLayer = perRun / time.Duration(layers)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%.1f%%\t\n", phase, perRun.Round(time.Millisecond), perLayer.Round(time.Microsecond), 100*elapsed.Seconds()/wall.Seconds())
+	}
+	return table.Flush()
+}
+
+// Entry point for "bulletpointer bench [options] in.yaml...". The outputs
+// are thrown away; only the timings are of interest.
+func benchCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] in.yaml...")
+	options := &RenderOptions{}
+	options.registerFlags(flags)
+	renderers := flags.String("renderers", "", "compare these renderers (comma-separated, such as inkscape,docker) instead of the configured ones")
+	runs := flags.Int("runs", 1, "render this many times with each renderer, reporting the average")
+	flags.Parse(args)
+	if err := options.takePositional(flags.Args(), false); err != nil || *runs < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	trapSignals()
+	names := []string{""}
+	if *renderers != "" {
+		names = strings.Split(*renderers, ",")
+	}
+	for _, renderer := range names {
+		if renderer != "" && !knownRenderers[renderer] {
+			fatal("", &ConfigError{fmt.Errorf("unknown renderer %q; expected one of %s", renderer, strings.Join(slices.Sorted(maps.Keys(knownRenderers)), ", "))})
+		}
+	}
+	for _, renderer := range names {
+		if err := benchRenderer(*options, renderer, *runs); err != nil {
+			fatal("Benchmark failed: ", err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Find where things are drawn on a layer, by asking the renderer for the
+// bounding boxes of the elements which are showing. Working these out from
+// the geometry would mean following every transform, font and stroke, which
+// the renderer does already.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// The elements which draw something themselves, rather than grouping or
+// defining things drawn elsewhere.
+var drawnTags = []string{"path", "rect", "circle", "ellipse", "line", "polyline", "polygon", "text", "image", "use", "foreignObject"}
+
+// The number of px in each unit a document's size can be given in.
+var unitPx = map[string]float64{"": 1, "px": 1, "pt": 4.0 / 3, "pc": 16, "mm": 96 / 25.4, "cm": 96 / 2.54, "in": 96}
+
+// Convert a length such as "210mm" to px, reporting whether it could be.
+func lengthPx(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	number := strings.TrimRight(value, "abcdefghijklmnopqrstuvwxyz")
+	scale, ok := unitPx[value[len(number):]]
+	if !ok {
+		return 0, false
+	}
+	length, err := strconv.ParseFloat(number, 64)
+	if err != nil || length <= 0 {
+		return 0, false
+	}
+	return length * scale, true
+}
+
+// Work out the size of the page in px, which is what the renderer reports
+// bounding boxes in: the document's width and height, or else its viewBox.
+func pageSize(root *etree.Element) (float64, float64, error) {
+	width, widthOK := lengthPx(root.SelectAttrValue("width", ""))
+	height, heightOK := lengthPx(root.SelectAttrValue("height", ""))
+	if widthOK && heightOK {
+		return width, height, nil
+	}
+	viewBox, err := documentViewBox(root)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not work out the size of the page: %w", err)
+	}
+	return viewBox[2], viewBox[3], nil
+}
+
+// Find the elements which are drawn as the document is now: those with a
+// drawn tag which are showing, and aren't inside definitions (which are only
+// drawn where they are used, as the <use> elements are). Text is taken as a
+// whole rather than by its spans.
+func drawnElements(doc *etree.Document) []*etree.Element {
+	var drawn []*etree.Element
+	var walk func(element *etree.Element)
+	walk = func(element *etree.Element) {
+		for _, child := range element.ChildElements() {
+			if displayNone(child) || slices.Contains(referencedElements, child.Tag) || child.Tag == "metadata" {
+				continue
+			}
+			if slices.Contains(drawnTags, child.Tag) {
+				if isVisible(child) {
+					drawn = append(drawn, child)
+				}
+				continue
+			}
+			walk(child)
+		}
+	}
+	if root := doc.Root(); root != nil {
+		walk(root)
+	}
+	return drawn
+}
+
+// Parse what the renderer's --query-all prints, a line of "id,x,y,width,height"
+// for every element, skipping anything else it prints along the way.
+func parseQuery(output []byte) map[string][4]float64 {
+	boxes := make(map[string][4]float64)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ",")
+		if len(fields) != 5 {
+			continue
+		}
+		var box [4]float64
+		var err error
+		for i, field := range fields[1:] {
+			if box[i], err = strconv.ParseFloat(field, 64); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			boxes[fields[0]] = box
+		}
+	}
+	return boxes
+}
+
+// Ask the renderer for the bounding boxes ("x y width height" in px from the
+// top left of the page) of the elements drawn in the document as it is now.
+// Elements without an ID are given one while the renderer looks, so that
+// what it reports can be matched up with them. The document is written next
+// to pngFile when it can't be piped to the renderer.
+func (renderer *Renderer) queryBounds(doc *etree.Document, pngFile string) (map[*etree.Element][4]float64, error) {
+	drawn := drawnElements(doc)
+	ids := make([]string, len(drawn))
+	var named []*etree.Element
+	for i, element := range drawn {
+		ids[i] = element.SelectAttrValue("id", "")
+		if ids[i] == "" {
+			ids[i] = fmt.Sprintf("bulletpointer-bounds-%d", i)
+			element.CreateAttr("id", ids[i])
+			named = append(named, element)
+		}
+	}
+	data, err := doc.WriteToBytes()
+	for _, element := range named {
+		element.RemoveAttr("id")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var output []byte
+	if renderer.canPipe() {
+		output, err = renderer.runInput([]string{"--query-all", "--pipe"}, bytes.NewReader(data), pngFile)
+	} else {
+		svgFile := strings.TrimSuffix(pngFile, filepath.Ext(pngFile)) + ".query.svg"
+		if err := os.WriteFile(svgFile, data, 0644); err != nil {
+			return nil, err
+		}
+		defer os.Remove(svgFile)
+		output, err = renderer.run([]string{"--query-all", svgFile}, svgFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not query the bounding boxes: %w", err)
+	}
+
+	queried := parseQuery(output)
+	bounds := make(map[*etree.Element][4]float64)
+	for i, element := range drawn {
+		if box, ok := queried[ids[i]]; ok && box[2] > 0 && box[3] > 0 {
+			bounds[element] = box
+		}
+	}
+	return bounds, nil
+}
+
+// Represent where a layer draws: the elements drawn, the bounding boxes the
+// renderer found for them, and the size of the page these are measured on.
+type layerBounds struct {
+	width float64
+	height float64
+	elements []*etree.Element
+	boxes map[*etree.Element][4]float64
+}
+
+// Measure where the layer draws, as the document is now.
+func (run *Run) measureBounds(image *Image, doc *etree.Document, pngFile string) (*layerBounds, error) {
+	width, height, err := pageSize(doc.Root())
+	if err != nil {
+		return nil, err
+	}
+	boxes, err := run.imageRenderer(image).queryBounds(doc, pngFile)
+	if err != nil {
+		return nil, err
+	}
+	return &layerBounds{width: width, height: height, elements: drawnElements(doc), boxes: boxes}, nil
+}
+
+// Report whether a bounding box covers the whole of a rectangle, as a
+// background does.
+func covers(box [4]float64, rect [4]float64) bool {
+	return box[0] <= rect[0] && box[1] <= rect[1] && box[0]+box[2] >= rect[0]+rect[2] && box[1]+box[3] >= rect[1]+rect[3]
+}
+
+// Work out the bounding box of everything the layer draws on the page, as
+// fractions of the page, leaving out what covers the whole page (such as the
+// background). Reports false if nothing else is drawn there.
+func (bounds *layerBounds) content() ([4]float64, bool) {
+	page := [4]float64{0, 0, bounds.width, bounds.height}
+	left, top, right, bottom := bounds.width, bounds.height, 0.0, 0.0
+	for _, element := range bounds.elements {
+		box, ok := bounds.boxes[element]
+		if !ok || covers(box, page) {
+			continue
+		}
+		left, top = min(left, max(box[0], 0)), min(top, max(box[1], 0))
+		right, bottom = max(right, min(box[0]+box[2], bounds.width)), max(bottom, min(box[1]+box[3], bounds.height))
+	}
+	if right <= left || bottom <= top {
+		return [4]float64{}, false
+	}
+	return [4]float64{left / bounds.width, top / bounds.height, (right - left) / bounds.width, (bottom - top) / bounds.height}, true
+}
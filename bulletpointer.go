@@ -4,12 +4,14 @@
 package main
 
 import (
+	"crypto/sha256"
 	"fmt"
-	"log"
+	"maps"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/beevik/etree"
 	"gopkg.in/yaml.v3"
@@ -19,149 +21,748 @@ import (
 // files that represent layers on that image.
 type Image struct {
 	Filename string `yaml:"filename"`
+	BaseDir string `yaml:"base_dir,omitempty"`
 	Layers []*ImageLayer `yaml:"layers"`
+	CrossfadeFrames int `yaml:"crossfade_frames,omitempty"`
+	Composites []*Composite `yaml:"composites,omitempty"`
+	Subtitles string `yaml:"subtitles,omitempty"`
+	Formats []string `yaml:"formats,omitempty"`
+	Quality int `yaml:"quality,omitempty"`
+	Background string `yaml:"background,omitempty"`
+	BackgroundID string `yaml:"background_id,omitempty"`
+	BackgroundColor string `yaml:"background_color,omitempty"`
+	Area string `yaml:"area,omitempty"`
+	Page int `yaml:"page,omitempty"`
+	RootID string `yaml:"root_id,omitempty"`
+	NameTemplate string `yaml:"name_template,omitempty"`
+	NumberPadding int `yaml:"number_padding,omitempty"`
+	NumberStart *int `yaml:"number_start,omitempty"`
+	Resolution string `yaml:"resolution,omitempty"`
+	Renderer string `yaml:"renderer,omitempty"`
+	RendererArgs []string `yaml:"renderer_args,omitempty"`
+	TextToPath bool `yaml:"text_to_path,omitempty"`
+	InlineAssets bool `yaml:"inline_assets,omitempty"`
+	Hooks *Hooks `yaml:"hooks,omitempty"`
+	Transforms []*TransformSpec `yaml:"transforms,omitempty"`
+	ShowWithAncestors bool `yaml:"show_with_ancestors,omitempty"`
+	Locales map[string]map[string]string `yaml:"locales,omitempty"`
+	Overlays []*Overlay `yaml:"overlays,omitempty"`
+	Numbering *SlideNumbering `yaml:"numbering,omitempty"`
+	Variables map[string]string `yaml:"variables,omitempty"`
+	Colors map[string]string `yaml:"colors,omitempty"`
+	BurnCaptions *BurnIn `yaml:"burn_captions,omitempty"`
+	SafeArea string `yaml:"safe_area,omitempty"`
+	Metadata *CardMetadata `yaml:"metadata,omitempty"`
+	TitleCard *Card `yaml:"title_card,omitempty"`
+	EndCard *Card `yaml:"end_card,omitempty"`
+
+	// The directory which the image's relative paths are resolved against:
+	// its base_dir, or else that of the config file it came from.
+	baseDir string
+
+	// Whether the config gave "layers: auto", for the layers to be derived
+	// from the SVG's Inkscape layers once the image is loaded.
+	autoLayers bool
+
+	// The config file the image came from and the SHA-256 of its contents,
+	// for stamping into the outputs, and the line the image starts on.
+	configFile string
+	configHash string
+	configLine int
+}
+
+// Give every layer which left out its suffix an automatic one based on its
+// position in the image (_01, _02, ...), so inserting a layer in the middle
+// renumbers the rest instead of requiring it to be done by hand.
+func (image *Image) assignSuffixes() {
+	padding := image.NumberPadding
+	if padding <= 0 {
+		padding = 2
+	}
+	start := 1
+	if image.NumberStart != nil {
+		start = *image.NumberStart
+	}
+	for i, layer := range image.Layers {
+		if !layer.suffixSet {
+			layer.Suffix = fmt.Sprintf("_%0*d", padding, start+i)
+		}
+	}
+	image.assignCardSuffixes()
+}
+
+// Report whether the image should be exported in the given format, either
+// because it asks for it or because the whole run does.
+func (image *Image) wantsFormat(format string, runFormats []string) bool {
+	return slices.Contains(image.Formats, format) || slices.Contains(runFormats, format)
 }
 
 // In the context of an individual SVG file, loop through and apply the
-// layering logic to produce individual "slides" for video insertion.
-func (image *Image) processImage(inDir string, outDir string) {
-	inFile := filepath.Join(inDir, image.Filename)
+// layering logic to produce individual "slides" for video insertion. Any
+// problems are reported through the run; only successful layers are returned.
+func (image *Image) processImage(run *Run) []*Slide {
+	// Problems with the image as a whole mean that none of its layers will
+	// be rendered, so they are all counted as done.
+	failImage := func(err error) []*Slide {
+		run.fail(image.Filename, "", err)
+		run.Progress.skip(len(image.Layers))
+		return nil
+	}
+
+	inFile, err := image.sourceFile(run.Remote)
+	if err != nil {
+		return failImage(&InputError{err})
+	}
 	if fileStat, err := os.Stat(inFile); err == nil {
 		if !fileStat.Mode().IsRegular() {
-			log.Fatalf("Input file %s is not regular file\n", inFile)
+			return failImage(&InputError{fmt.Errorf("input file %s is not regular file", inFile)})
 		}
 	} else {
-		log.Fatalf("Source file needs to exist: %s\n", inFile)
+		return failImage(&InputError{fmt.Errorf("source file needs to exist: %s", inFile)})
 	}
 
-	outPrefix := filepath.Base(inFile)
+	outPrefix := remoteBase(image.Filename)
 	outExt := filepath.Ext(outPrefix)
 	outPrefix = outPrefix[0:(len(outPrefix) - len(outExt))]
 
-	if strings.ToLower(outExt) != ".svg" {
-		log.Fatalf("Expected .svg file but got %s\n", inFile)
+	if !isSVGName(image.Filename) {
+		return failImage(&ConfigError{fmt.Errorf("expected .svg or .svgz file but got %s", image.Filename)})
 	}
 
+	nameTemplate, err := image.nameTemplate(run.NameTemplate)
+	if err != nil {
+		return failImage(err)
+	}
+	outPath := func(index int, suffix string) (string, error) {
+		name, err := outputName(nameTemplate, NameFields{ImageBase: outPrefix, LayerIndex: index, Suffix: suffix})
+		if err != nil {
+			return "", err
+		}
+		outPng := filepath.Join(run.OutDir, filepath.FromSlash(name))
+		return outPng, run.prepareDir(outPng)
+	}
+
+	stopParse := run.Profile.measure(image.Filename, "parse")
 	doc := etree.NewDocument()
-	if err := doc.ReadFromFile(inFile); err != nil {
-		log.Fatalf("Error reading SVG XML file: %s\n", err.Error())
+	if err := readSVG(doc, inFile); err != nil {
+		return failImage(&InputError{fmt.Errorf("error reading SVG XML file: %w", err)})
+	}
+	if err := resolveAssets(doc, image.Filename, inFile); err != nil {
+		return failImage(&InputError{err})
+	}
+	index := newElementIndex(doc, inFile)
+	if err := isolateElement(index, image.RootID); err != nil {
+		return failImage(err)
+	}
+	if _, err := insertOverlays(image.Overlays, index, image.baseDir); err != nil {
+		return failImage(err)
+	}
+	if err := run.Limits.checkLinks(doc.Root(), filepath.Dir(inFile)); err != nil {
+		return failImage(&InputError{err})
+	}
+	if image.InlineAssets && doc.Root() != nil {
+		if err := inlineAssets(doc.Root(), filepath.Dir(inFile), run.Remote); err != nil {
+			return failImage(&InputError{err})
+		}
+	}
+	stopParse()
+	if err := image.applyLocale(index, run.Locale); err != nil {
+		return failImage(err)
+	}
+	if err := substituteText(doc, image.textVariables(run.Variables)); err != nil {
+		return failImage(err)
+	}
+	recolor(doc, image.palette(run.Colors))
+	image.checkFonts(run.renderer(image.Renderer), doc)
+
+	durations, err := image.layerDurations(image.baseDir)
+	if err != nil {
+		return failImage(fmt.Errorf("problem with timing: %w", err))
+	}
+	captions, captionStarts, err := image.layerCaptions(durations)
+	if err != nil {
+		return failImage(fmt.Errorf("problem with the captions: %w", err))
 	}
 
-	for _, layer := range image.Layers {
-		outBase := fmt.Sprintf("%s%s%s", outPrefix, layer.Suffix, outExt)
-		outFile := filepath.Join(outDir, outBase)
-		layer.processImageLayer(doc, outFile)
+	// Every PNG produced for this image, which may need converting into
+	// other raster formats at the end.
+	var allPngs []string
+	var outPngs []string
+	var slides []*Slide
+	layerPngs := make(map[string]string)
+	// The cards are slides of the image as its layers are, on either side
+	// of them.
+	renderCard := func(card *imageCard) {
+		if !run.wantsLayer(card.Suffix) {
+			return
+		}
+		stopRender := run.Profile.measure(image.Filename, card.Suffix, "render")
+		outPng, err := outPath(card.index, card.Suffix)
+		var slide *Slide
+		if err == nil {
+			slide, err = image.writeCard(run, card, doc.Root(), outPng)
+		}
+		stopRender()
+		if err != nil {
+			run.fail(image.Filename, card.Suffix, fmt.Errorf("could not generate the %s card: %w", card.kind, err))
+			return
+		}
+		slides = append(slides, slide)
+		allPngs = append(allPngs, outPng)
+	}
+	cards := image.cards()
+	if image.TitleCard != nil {
+		renderCard(cards[0])
 	}
+	for i, layer := range image.Layers {
+		if run.stopping() {
+			break
+		}
+		run.Progress.begin(image.Filename, layer.Suffix)
+		slide := &Slide{Image: image.Filename, Layer: layer.Suffix, Title: layer.Title, Notes: layer.Notes, Duration: durations[i]}
+		slide.Number = run.SlideOffsets[image] + i + 1
+		if captions != nil {
+			slide.Captions, slide.CaptionsStart = captions[i], captionStarts[i]
+		}
+		slide.PngFile, err = outPath(i+1, layer.Suffix)
+		export := run.wantsLayer(layer.Suffix)
+		if err == nil {
+			if slide.SvgFile, err = run.svgPath(slide.PngFile); err == nil {
+				err = layer.processImageLayer(run, image, index, slide, export)
+			}
+		}
+		run.Progress.step()
+		if err != nil {
+			run.fail(image.Filename, layer.Suffix, err)
+			continue
+		}
+		// A layer which wasn't exported this time still counts towards the
+		// deck (the PDF, manifest and so on) if an earlier run exported it.
+		if !export {
+			if _, err := os.Stat(slide.PngFile); err != nil {
+				continue
+			}
+			layerPngs[layer.Suffix] = slide.PngFile
+			slides = append(slides, slide)
+			continue
+		}
+		outPngs = append(outPngs, slide.PngFile)
+		allPngs = append(allPngs, slide.Frames...)
+		allPngs = append(allPngs, layer.variantPngs(slide.PngFile)...)
+		if len(slide.Frames) > 0 && len(layer.Camera.Animations) > 0 {
+			stopEncode := run.Profile.measure(image.Filename, layer.Suffix, "animate")
+			if err := writeAnimations(slide.PngFile, slide.Frames, layer.Camera.Animations, layer.Camera.FPS); err != nil {
+				run.fail(image.Filename, layer.Suffix, fmt.Errorf("could not package the camera frames: %w", err))
+			}
+			stopEncode()
+		}
+		layerPngs[layer.Suffix] = slide.PngFile
+		slides = append(slides, slide)
+	}
+	// The rest is made from the layers, which are now incomplete.
+	if run.stopping() {
+		return slides
+	}
+	if image.EndCard != nil {
+		renderCard(cards[len(cards)-1])
+	}
+
+	// Each fade is between a layer and the one before it, so it is only made
+	// when both are there, and is left as it is on disk unless one of them
+	// was exported this time.
+	if image.CrossfadeFrames > 0 {
+		stopEncode := run.Profile.measure(image.Filename, "crossfade", "encode")
+		for i := 1; i < len(image.Layers); i++ {
+			fromPng, toPng := layerPngs[image.Layers[i-1].Suffix], layerPngs[image.Layers[i].Suffix]
+			if fromPng == "" || toPng == "" || !slices.Contains(outPngs, fromPng) && !slices.Contains(outPngs, toPng) {
+				continue
+			}
+			framePngs, err := writeCrossfade(fromPng, toPng, image.CrossfadeFrames)
+			if err != nil {
+				run.fail(image.Filename, "crossfade", fmt.Errorf("could not generate crossfade frames: %w", err))
+				continue
+			}
+			allPngs = append(allPngs, framePngs...)
+		}
+		stopEncode()
+	}
+
+	for i, composite := range image.Composites {
+		if !run.wantsLayer(composite.Suffix) {
+			continue
+		}
+		stopEncode := run.Profile.measure(image.Filename, composite.Suffix, "encode")
+		outPng, err := outPath(len(image.Layers)+i+1, composite.Suffix)
+		if err == nil {
+			err = composite.writeComposite(image.baseDir, layerPngs, outPng)
+		}
+		if err == nil {
+			err = image.stampPNG(outPng, composite.Suffix, "", "", "")
+		}
+		stopEncode()
+		if err != nil {
+			run.fail(image.Filename, composite.Suffix, fmt.Errorf("could not generate composite: %w", err))
+			continue
+		}
+		allPngs = append(allPngs, outPng)
+	}
+
+	allPngs = append(outPngs, allPngs...)
+	quality := image.Quality
+	if quality <= 0 {
+		quality = defaultQuality
+	}
+	for _, format := range slices.Sorted(maps.Keys(rasterExtensions)) {
+		if !image.wantsFormat(format, run.Formats) {
+			continue
+		}
+		stopEncode := run.Profile.measure(image.Filename, format, "encode")
+		for _, outPng := range allPngs {
+			if _, err := convertRaster(outPng, format, quality); err != nil {
+				run.fail(image.Filename, format, fmt.Errorf("could not convert to %s: %w", format, err))
+			}
+		}
+		stopEncode()
+	}
+
+	return slides
 }
 
 // Represent the toggles that are applied to a "layer" of an image, which will
 // then be exported as an individual instance of that image.
 type ImageLayer struct {
 	Suffix string `yaml:"suffix"`
+	Title string `yaml:"title,omitempty"`
+	Notes string `yaml:"notes,omitempty"`
+	Tags []string `yaml:"tags,omitempty"`
 	HideIDs []string `yaml:"hide_ids,omitempty"`
 	ShowIDs []string `yaml:"show_ids,omitempty"`
+	ShowWithAncestors bool `yaml:"show_with_ancestors,omitempty"`
+	CloneIDs []*CloneSpec `yaml:"clone_ids,omitempty"`
+	RemoveIDs []string `yaml:"remove_ids,omitempty"`
+	SetAttrs map[string]map[string]*string `yaml:"set_attrs,omitempty"`
+	RemoveAttrs map[string][]string `yaml:"remove_attrs,omitempty"`
+	Duration float64 `yaml:"duration,omitempty"`
+	Caption int `yaml:"caption,omitempty"`
+	At string `yaml:"at,omitempty"`
+	Audio string `yaml:"audio,omitempty"`
+	Background string `yaml:"background,omitempty"`
+	BackgroundID string `yaml:"background_id,omitempty"`
+	BackgroundColor string `yaml:"background_color,omitempty"`
+	Area string `yaml:"area,omitempty"`
+	Page int `yaml:"page,omitempty"`
+	Expect *LayerExpectation `yaml:"expect,omitempty"`
+	Transforms []*TransformSpec `yaml:"transforms,omitempty"`
+	Overlays []*Overlay `yaml:"overlays,omitempty"`
+	Camera *Camera `yaml:"camera,omitempty"`
+	Variants []*LayerVariant `yaml:"variants,omitempty"`
+
+	// Whether the suffix was given at all, since an explicitly empty suffix
+	// (output named after the SVG alone) is different from a missing one.
+	suffixSet bool
+
+	// The line of the config file the layer starts on.
+	line int
+}
+
+// Decode an image from YAML, where its layers may be given as "auto" instead
+// of a list.
+func (image *Image) UnmarshalYAML(value *yaml.Node) error {
+	type plainImage Image
+	if value.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			key, layers := value.Content[i], value.Content[i+1]
+			if key.Value != "layers" || layers.Kind != yaml.ScalarNode {
+				continue
+			}
+			if layers.Value != "auto" {
+				return fmt.Errorf("line %d: layers should be a list or auto, not %q", layers.Line, layers.Value)
+			}
+			image.autoLayers = true
+			without := *value
+			without.Content = slices.Delete(slices.Clone(value.Content), i, i+2)
+			value = &without
+			break
+		}
+	}
+	return value.Decode((*plainImage)(image))
+}
+
+// Decode a layer from YAML, noting whether it had a suffix key (perhaps
+// merged in from another layer) and where it was.
+func (layer *ImageLayer) UnmarshalYAML(value *yaml.Node) error {
+	type plainLayer ImageLayer
+	if err := value.Decode((*plainLayer)(layer)); err != nil {
+		return err
+	}
+	layer.line = value.Line
+	layer.suffixSet = mappingHasKey(value, "suffix")
+	return nil
+}
+
+// Work out the export settings for this layer, where anything the layer sets
+// itself takes precedence over the image as a whole. An image with a root_id
+// is exported as just that element unless an area is given.
+func (layer *ImageLayer) exportOptions(image *Image) ExportOptions {
+	options := ExportOptions{Background: image.Background, Area: image.Area, Page: image.Page, Resolution: image.Resolution, TextToPath: image.TextToPath, RendererArgs: image.RendererArgs}
+	if layer.Background != "" {
+		options.Background = layer.Background
+	} else if id, color := layer.backdrop(image); id == "" && color != "" {
+		options.Background = color
+	}
+	if layer.Area != "" {
+		options.Area = layer.Area
+	} else if options.Area == "" && image.RootID != "" {
+		options.Area = "id:" + image.RootID
+	}
+	if layer.Page != 0 {
+		options.Page = layer.Page
+	}
+	return options
 }
 
 // Within the context of a specific image layer, hide/show the relevant image
-// elements for that particular layer.
-func (layer *ImageLayer) processImageLayer(doc *etree.Document, outFile string) {
-	for _, id := range layer.HideIDs {
-		element := assertOneElementById(doc, id)
-		setHidden(element, true)
+// elements for that particular layer, then export the slide's intermediate
+// SVG file to its PNG file. A layer which isn't being exported only changes
+// the document, for the layers after it to build on. With --resume, a PNG
+// already exported from the same input is kept (and its post-layer hooks are
+// not run again).
+func (layer *ImageLayer) processImageLayer(run *Run, image *Image, index *elementIndex, slide *Slide, export bool) error {
+	if export {
+		if err := image.preLayerHooks(slide); err != nil {
+			return err
+		}
 	}
-	for _, id := range layer.ShowIDs {
-		element := assertOneElementById(doc, id)
-		setHidden(element, false)
+	stopMutate := run.Profile.measure(image.Filename, layer.Suffix, "mutate")
+	trace := run.traceLayer(image, layer, index.doc)
+	overlays, err := insertOverlays(layer.Overlays, index, image.baseDir)
+	if err != nil {
+		return err
+	}
+	defer removeOverlays(overlays, index)
+	for _, overlay := range overlays {
+		if err := run.Limits.checkLinks(overlay, image.baseDir); err != nil {
+			return err
+		}
+	}
+	if image.InlineAssets {
+		for _, overlay := range overlays {
+			if err := inlineAssets(overlay, image.baseDir, run.Remote); err != nil {
+				return err
+			}
+		}
+	}
+	trace.step("overlays", len(layer.Overlays) > 0)
+	if err := layer.cloneAndRemove(index); err != nil {
+		return err
+	}
+	trace.step("clone_ids and remove_ids", len(layer.CloneIDs)+len(layer.RemoveIDs) > 0)
+	for _, selector := range layer.HideIDs {
+		elements, err := index.resolve(selector)
+		if err != nil {
+			return err
+		}
+		for _, element := range elements {
+			setHidden(element, true)
+		}
+	}
+	trace.step("hide_ids", len(layer.HideIDs) > 0)
+	for _, selector := range layer.ShowIDs {
+		elements, err := index.resolve(selector)
+		if err != nil {
+			return err
+		}
+		for _, element := range elements {
+			setHidden(element, false)
+		}
+	}
+	trace.step("show_ids", len(layer.ShowIDs) > 0)
+	if err := layer.applyBackdrop(image, index); err != nil {
+		return err
+	}
+	trace.step("background_id", len(image.backdropIDs()) > 0)
+	if err := layer.showAncestors(image, index); err != nil {
+		return err
+	}
+	trace.step("show_with_ancestors", layer.ShowWithAncestors || image.ShowWithAncestors)
+	if err := layer.patchAttrs(index); err != nil {
+		return err
+	}
+	trace.step("set_attrs and remove_attrs", len(layer.SetAttrs)+len(layer.RemoveAttrs) > 0)
+	if err := layer.applyTransforms(image, index.doc); err != nil {
+		return err
+	}
+	trace.step("transforms", len(layer.Transforms)+len(image.Transforms) > 0)
+	// Everything else keeps the index up to date itself; a transform can do
+	// anything to the document, but rebuilding the index of a large one for
+	// every layer is not to be done lightly.
+	if len(layer.Transforms)+len(image.Transforms) > 0 {
+		index.refresh()
+	}
+	if !export {
+		stopMutate()
+		return nil
+	}
+	if err := image.Numbering.apply(index, slide.Number, run.SlideTotal); err != nil {
+		return err
+	}
+	trace.step("numbering", image.Numbering != nil)
+	stopMutate()
+	if err := layer.checkExpectations(image, index); err != nil {
+		return err
+	}
+	slide.AltTitle, slide.AltText = describeDocument(index.doc)
+	if run.RequireAlt && slide.AltText == "" {
+		return fmt.Errorf("no <desc> is visible to describe the slide, which --require-alt needs")
 	}
 
-	if err := doc.WriteToFile(outFile); err != nil {
-		log.Fatalf("Problem writing to %s: %s\n", outFile, err.Error())
+	cameraStart, restoreView, err := layer.Camera.aim(index.doc)
+	if err != nil {
+		return err
 	}
+	defer restoreView()
 
-	// The input filename, and therefore the output filename, was already
-	// checked to end with .svg
-	outPng := outFile[0:(len(outFile) - 4)] + ".png"
+	// Optimizing removes what this layer hides, which the layers after it
+	// may show, so it is a copy which is exported.
+	doc := index.doc
+	if run.Optimize {
+		stopOptimize := run.Profile.measure(image.Filename, layer.Suffix, "optimize")
+		doc, _ = optimizedCopy(index.doc, false)
+		stopOptimize()
+	}
 
-	cmd := exec.Cmd{
-		Path: "/usr/bin/flatpak",
-		Args: []string{
-			"flatpak",
-			"run",
-			"org.inkscape.Inkscape",
-			fmt.Sprintf("--export-filename=%s", outPng),
-			"--export-width=1280",
-			"--export-height=720",
-			outFile,
-		},
+	renderer := run.imageRenderer(image)
+	pipe := run.pipesSVG(image, renderer)
+	if pipe {
+		slide.SvgFile = ""
 	}
-	if err := cmd.Run(); err != nil{
-		log.Fatalf("Could not convert SVG to PNG with Inkscape: %s\n", err.Error())
+	// The layer's own changes may link to files too, which the renderer
+	// looks for next to the SVG it is given (or where it runs, for a piped
+	// one).
+	if err := run.Limits.checkLinks(doc.Root(), filepath.Dir(slide.SvgFile)); err != nil {
+		return err
+	}
+	stopSerialize := run.Profile.measure(image.Filename, layer.Suffix, "serialize")
+	svgHash := sha256.New()
+	var svgData []byte
+	if pipe {
+		svgData, err = doc.WriteToBytes()
+		svgHash.Write(svgData)
+	} else {
+		err = writeFingerprinted(doc, slide.SvgFile, svgHash)
+	}
+	if err != nil {
+		return fmt.Errorf("problem writing to %s: %w", slide.SvgFile, err)
+	}
+	stopSerialize()
+	if run.Bounds || image.safeArea(run.SafeArea) != "" {
+		bounds, err := run.measureBounds(image, doc, slide.PngFile)
+		if err != nil {
+			return fmt.Errorf("could not find where the layer draws: %w", err)
+		}
+		if err := image.checkSafeArea(run, layer, bounds); err != nil {
+			return fmt.Errorf("could not check the safe area: %w", err)
+		}
+		if content, ok := bounds.content(); ok && run.Bounds {
+			slide.Bounds = &content
+		}
 	}
-}
 
-// Find the singular element that has the given ID attribute. If there isn't
-// exactly one of them, then fail the entire program.
-func assertOneElementById(doc *etree.Document, id string) *etree.Element {
-	xpath := fmt.Sprintf("//[@id='%s']", id)
-	elements := doc.FindElements(xpath)
-	if len(elements) != 1 {
-		log.Fatalf("Expected one #%s element; found %d\n", id, len(elements))
+	options := layer.exportOptions(image)
+	fingerprint := exportFingerprint(svgHash, options, renderer, image.BurnCaptions, slide.Captions)
+	// The variants go before the layer's own PNG is checked for being up to
+	// date, since they can change without it.
+	if err := layer.exportVariants(run, image, index, slide); err != nil {
+		return err
+	}
+	if run.Resume && pngFingerprint(slide.PngFile) == fingerprint {
+		debugf("Already up to date: %s\n", slide.PngFile)
+		slide.Frames = layer.Camera.framePngs(slide.PngFile)
+		run.Resumed.Add(1)
+		return nil
 	}
-	return elements[0]
-}
 
-// Toggle the style: display: X sub-attribute on the element. If true, then set
-// display:none; if false, then set display:inline.
-func setHidden(element *etree.Element, hidden bool) {
-	attrValue := element.SelectAttrValue("style", "")
-	attrComponents := strings.Split(attrValue, ";")
+	stopRender := run.Profile.measure(image.Filename, layer.Suffix, "render")
+	defer stopRender()
+	renderStart := time.Now()
+	// The frames go first, so that the layer's own PNG is only stamped (as
+	// done, for --resume) once all of them are.
+	err = layer.Camera.exportFrames(run, image, layer, doc, cameraStart, slide)
+	if err == nil && pipe {
+		err = renderer.exportPNGData(svgData, slide.PngFile, options)
+	} else if err == nil {
+		err = renderer.exportPNG(slide.SvgFile, slide.PngFile, options)
+	}
+	slide.RenderSeconds = time.Since(renderStart).Seconds()
+	if err != nil {
+		return &RenderError{fmt.Errorf("could not convert SVG to PNG with Inkscape: %w", err)}
+	}
+	if err := image.BurnCaptions.burn(slide.PngFile, captionLines(slide.Captions)); err != nil {
+		return fmt.Errorf("could not burn captions into %s: %w", slide.PngFile, err)
+	}
+	if err := image.stampPNG(slide.PngFile, layer.Suffix, layer.Title, layer.Notes, fingerprint); err != nil {
+		return fmt.Errorf("could not add metadata to %s: %w", slide.PngFile, err)
+	}
+	if err := image.postLayerHooks(slide); err != nil {
+		return err
+	}
+	debugf("Rendered %s\n", slide.PngFile)
+	return nil
+}
 
-	var expectedComponent string
-	if hidden {
-		expectedComponent = "display:none"
-	} else {
-		expectedComponent = "display:inline"
+// Set and remove the attributes of elements that the layer asks for. Setting
+// an attribute to null removes it too. Like hiding and showing, the changes
+// carry on into the following layers until something changes them back.
+func (layer *ImageLayer) patchAttrs(index *elementIndex) error {
+	// Every selector is resolved before anything changes, since the changes
+	// may include the IDs, labels and classes that they select by.
+	type patch struct {
+		elements []*etree.Element
+		set map[string]*string
+		remove []string
+	}
+	var patches []patch
+	for _, selector := range slices.Sorted(maps.Keys(layer.SetAttrs)) {
+		elements, err := index.resolve(selector)
+		if err != nil {
+			return err
+		}
+		patches = append(patches, patch{elements: elements, set: layer.SetAttrs[selector]})
+	}
+	for _, selector := range slices.Sorted(maps.Keys(layer.RemoveAttrs)) {
+		elements, err := index.resolve(selector)
+		if err != nil {
+			return err
+		}
+		patches = append(patches, patch{elements: elements, remove: layer.RemoveAttrs[selector]})
 	}
 
-	done := false
-	for key, component := range attrComponents {
-		if strings.HasPrefix(component, "display:") {
-			attrComponents[key] = expectedComponent
-			done = true
+	for _, patch := range patches {
+		for _, element := range patch.elements {
+			for _, name := range slices.Sorted(maps.Keys(patch.set)) {
+				if patch.set[name] == nil {
+					removeAttr(element, name)
+				} else {
+					setAttr(element, name, *patch.set[name])
+				}
+			}
+			for _, name := range patch.remove {
+				removeAttr(element, name)
+			}
 		}
 	}
+	if len(patches) > 0 {
+		index.refresh()
+	}
+	return nil
+}
 
-	if !done {
-		attrComponents = append(attrComponents, expectedComponent)
+// Set an attribute on an element. A plain "href" also updates an existing
+// xlink:href, which is what older SVGs (and Inkscape) use for links and
+// embedded images, so that the config doesn't need to care which it is.
+func setAttr(element *etree.Element, name string, value string) {
+	if name == "href" && element.SelectAttr("xlink:href") != nil {
+		element.CreateAttr("xlink:href", value)
+		if element.SelectAttr("href") == nil {
+			return
+		}
 	}
+	element.CreateAttr(name, value)
+}
 
-	element.CreateAttr("style", strings.Join(attrComponents, ";"))
+// Remove an attribute from an element, including the xlink:href for "href".
+func removeAttr(element *etree.Element, name string) {
+	if name == "href" {
+		element.RemoveAttr("xlink:href")
+	}
+	element.RemoveAttr(name)
 }
 
-// Main entry point for the program/script.
-func main() {
-	if len(os.Args) != 3 {
-		log.Fatalln("Usage: bulletpointer /path/to/in.yaml /path/to/out/dir")
+// Look up a presentation property of an element (display, visibility, ...),
+// where the style attribute takes precedence over the attribute of the same
+// name. Within the style the last declaration wins, unless an earlier one is
+// !important. The value is lowercased, without any !important.
+func styleValue(element *etree.Element, property string) string {
+	value := ""
+	important := false
+	for _, component := range strings.Split(element.SelectAttrValue("style", ""), ";") {
+		key, declared, found := strings.Cut(component, ":")
+		if !found || strings.TrimSpace(key) != property {
+			continue
+		}
+		declared = strings.ToLower(strings.TrimSpace(declared))
+		isImportant := strings.HasSuffix(declared, "!important")
+		if important && !isImportant {
+			continue
+		}
+		value = strings.TrimSpace(strings.TrimSuffix(declared, "!important"))
+		important = isImportant
 	}
+	if value == "" {
+		value = strings.ToLower(strings.TrimSpace(element.SelectAttrValue(property, "")))
+	}
+	return value
+}
 
-	if dirStat, err := os.Stat(os.Args[2]); err == nil {
-		if !dirStat.IsDir() {
-			log.Fatalf("Destination should be a directory: %s\n", os.Args[2])
+// Report whether an element has visibility hidden, either from its own
+// setting or inherited from the nearest ancestor which has one.
+func visibilityHidden(element *etree.Element) bool {
+	for ; element != nil; element = element.Parent() {
+		switch styleValue(element, "visibility") {
+		case "hidden", "collapse":
+			return true
+		case "visible":
+			return false
 		}
-	} else {
-		log.Fatalf("Destination dir needs to exist: %s\n", os.Args[2])
 	}
+	return false
+}
 
-	var yamlImages []*Image
-	if yamlBytes, err := os.ReadFile(os.Args[1]); err == nil {
-		if err := yaml.Unmarshal(yamlBytes, &yamlImages); err != nil {
-			log.Fatalf("Problem parsing YAML: %s\n", err.Error())
+// Set a property in the style attribute of an element, replacing any
+// declarations of it that are already there. Empty components and stray
+// whitespace are dropped, so the result only depends on the declarations and
+// not on how the style was written (or toggled) before.
+func setStyleProperty(element *etree.Element, property string, value string) {
+	var attrComponents []string
+	done := false
+	for _, component := range strings.Split(element.SelectAttrValue("style", ""), ";") {
+		component = strings.TrimSpace(component)
+		if component == "" {
+			continue
 		}
-	} else {
-		log.Fatalf("Problem reading file: %s\n", err.Error())
+		if key, _, _ := strings.Cut(component, ":"); strings.TrimSpace(key) == property {
+			if done {
+				continue
+			}
+			component = property + ":" + value
+			done = true
+		}
+		attrComponents = append(attrComponents, component)
+	}
+	if !done {
+		attrComponents = append(attrComponents, property+":"+value)
 	}
+	element.CreateAttr("style", strings.Join(attrComponents, ";"))
+}
 
-	for _, yamlImage := range yamlImages {
-		yamlImage.processImage(filepath.Dir(os.Args[1]), os.Args[2])
+// Hide or show an element by setting display:none or display:inline in its
+// style, keeping a display presentation attribute (if it has one) in step.
+// Showing an element also makes it visible when it is hidden through the
+// visibility property, which some exporters use instead of display.
+func setHidden(element *etree.Element, hidden bool) {
+	display := "inline"
+	if hidden {
+		display = "none"
+	}
+	setStyleProperty(element, "display", display)
+	if element.SelectAttr("display") != nil {
+		element.CreateAttr("display", display)
+	}
+
+	if !hidden && visibilityHidden(element) {
+		setStyleProperty(element, "visibility", "visible")
+		if element.SelectAttr("visibility") != nil {
+			element.CreateAttr("visibility", "visible")
+		}
 	}
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+// Parse an SVG fragment and return the element with the given ID.
+func parseTestElement(t *testing.T, svg string, id string) *etree.Element {
+	t.Helper()
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(svg); err != nil {
+		t.Fatal(err)
+	}
+	element := doc.FindElement("//*[@id='" + id + "']")
+	if element == nil {
+		t.Fatalf("no #%s in %s", id, svg)
+	}
+	return element
+}
+
+func TestStyleValue(t *testing.T) {
+	tests := []struct {
+		element string
+		property string
+		want string
+	}{
+		{element: `<g id="e"/>`, property: "display", want: ""},
+		{element: `<g id="e" style="display:none"/>`, property: "display", want: "none"},
+		{element: `<g id="e" style=" fill : red ; display :  None "/>`, property: "display", want: "none"},
+		{element: `<g id="e" style="display:none;display:inline"/>`, property: "display", want: "inline"},
+		{element: `<g id="e" style="display:none !important;display:inline"/>`, property: "display", want: "none"},
+		{element: `<g id="e" style="display:none!IMPORTANT;display:inline !important"/>`, property: "display", want: "inline"},
+		{element: `<g id="e" display="none"/>`, property: "display", want: "none"},
+		{element: `<g id="e" display="none" style="display:inline"/>`, property: "display", want: "inline"},
+		{element: `<g id="e" style="fill:red" visibility=" Hidden "/>`, property: "visibility", want: "hidden"},
+		{element: `<g id="e" style="font-display:none"/>`, property: "display", want: ""},
+	}
+	for _, test := range tests {
+		element := parseTestElement(t, test.element, "e")
+		if got := styleValue(element, test.property); got != test.want {
+			t.Errorf("styleValue(%s, %q) = %q, want %q", test.element, test.property, got, test.want)
+		}
+	}
+}
+
+func TestSetHidden(t *testing.T) {
+	tests := []struct {
+		svg string
+		hidden bool
+		style string
+		display string
+		visibility string
+	}{
+		{svg: `<g id="e"/>`, hidden: true, style: "display:none"},
+		{svg: `<g id="e"/>`, hidden: false, style: "display:inline"},
+		{svg: `<g id="e" style="fill:red; display:inline ;"/>`, hidden: true, style: "fill:red;display:none"},
+		{svg: `<g id="e" style="display:none;fill:red;display:none"/>`, hidden: false, style: "display:inline;fill:red"},
+		{svg: `<g id="e" display="none"/>`, hidden: false, style: "display:inline", display: "inline"},
+		{svg: `<g id="e" display="inline" style="display:inline"/>`, hidden: true, style: "display:none", display: "none"},
+		{svg: `<g id="e" visibility="hidden"/>`, hidden: false, style: "display:inline;visibility:visible", visibility: "visible"},
+		{svg: `<g id="e" style="visibility:hidden"/>`, hidden: false, style: "visibility:visible;display:inline"},
+		{svg: `<g id="e" style="visibility:hidden"/>`, hidden: true, style: "visibility:hidden;display:none"},
+		{svg: `<g visibility="hidden"><g id="e"/></g>`, hidden: false, style: "display:inline;visibility:visible"},
+		{svg: `<g style="visibility:hidden"><g id="e" style="visibility:visible"/></g>`, hidden: false, style: "visibility:visible;display:inline"},
+	}
+	for _, test := range tests {
+		element := parseTestElement(t, test.svg, "e")
+		setHidden(element, test.hidden)
+		got := [3]string{element.SelectAttrValue("style", ""), element.SelectAttrValue("display", ""), element.SelectAttrValue("visibility", "")}
+		want := [3]string{test.style, test.display, test.visibility}
+		if got != want {
+			t.Errorf("setHidden(%s, %v) left style, display and visibility %q, want %q", test.svg, test.hidden, got, want)
+		}
+		if hidden := displayNone(element) || !isVisible(element); hidden != test.hidden {
+			t.Errorf("setHidden(%s, %v) left the element hidden = %v", test.svg, test.hidden, hidden)
+		}
+	}
+}
+
+// The number of Inkscape layers, and of bullets in each, in the large SVG
+// the benchmarks work on: about 4 MB of it.
+const largeTestLayers, largeTestBullets = 400, 50
+
+// Write a large SVG, like a diagram exported from a drawing tool, and return
+// its filename along with the layers of a deck which steps through it.
+func writeLargeTestSVG(b *testing.B) (string, []*ImageLayer) {
+	b.Helper()
+	var svg strings.Builder
+	svg.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape" width="1920" height="1080">` + "\n")
+	var layers []*ImageLayer
+	for i := range largeTestLayers {
+		fmt.Fprintf(&svg, `  <g id="layer%d" inkscape:label="Step %d" inkscape:groupmode="layer" style="display:none">`+"\n", i, i)
+		for j := range largeTestBullets {
+			fmt.Fprintf(&svg, `    <g id="b%d_%d" class="bullet"><rect x="%d" y="%d" width="200" height="40" style="fill:#336699;stroke:none"/><text x="%d" y="%d" style="font-size:24px">Bullet %d of step %d, with some words to it</text></g>`+"\n", i, j, j*10, j*20, j*10+8, j*20+28, j, i)
+		}
+		svg.WriteString("  </g>\n")
+		layer := &ImageLayer{Suffix: fmt.Sprintf("_%03d", i), ShowIDs: []string{fmt.Sprintf("layer%d", i)}}
+		if i > 0 {
+			layer.HideIDs = []string{fmt.Sprintf("layer%d", i-1)}
+		}
+		layers = append(layers, layer)
+	}
+	svg.WriteString("</svg>\n")
+	file := filepath.Join(b.TempDir(), "large.svg")
+	if err := os.WriteFile(file, []byte(svg.String()), 0644); err != nil {
+		b.Fatal(err)
+	}
+	return file, layers
+}
+
+// Read the large SVG, as processImage does.
+func readLargeTestSVG(b *testing.B, file string) *etree.Document {
+	b.Helper()
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(file); err != nil {
+		b.Fatal(err)
+	}
+	return doc
+}
+
+// Apply every layer of the deck to the large SVG in turn, without exporting
+// them. Rebuilding the index after every layer is what was done before the
+// index was only rebuilt after transforms.
+func BenchmarkApplyLayers(b *testing.B) {
+	file, layers := writeLargeTestSVG(b)
+	image := &Image{Filename: file, Layers: layers}
+	for _, refresh := range []bool{true, false} {
+		name := "only after transforms"
+		if refresh {
+			name = "after every layer"
+		}
+		b.Run(name, func(b *testing.B) {
+			index := newElementIndex(readLargeTestSVG(b, file), file)
+			run := &Run{}
+			b.ReportAllocs()
+			for b.Loop() {
+				for _, layer := range layers {
+					if err := layer.processImageLayer(run, image, index, &Slide{}, false); err != nil {
+						b.Fatal(err)
+					}
+					if refresh {
+						index.refresh()
+					}
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(layers)), "ns/layer")
+		})
+	}
+}
@@ -0,0 +1,244 @@
+// Burn the subtitle cues into the exported PNGs, for platforms which can't
+// carry a separate subtitle track alongside the video.
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Represent how the captions are burned in: the region they go in, as "x y
+// width height" fractions of the PNG (the bottom fifth by default), the text
+// and box colors as #rgb, #rrggbb or #rrggbbaa (or a box of "none"), the font
+// scale (fitting two lines into the region by default) and whether the
+// camera frames get them too, cue by cue.
+type BurnIn struct {
+	Region string `yaml:"region,omitempty"`
+	Color string `yaml:"color,omitempty"`
+	Box string `yaml:"box,omitempty"`
+	Scale int `yaml:"scale,omitempty"`
+	Frames bool `yaml:"frames,omitempty"`
+}
+
+// The defaults for the burn-in settings which aren't given.
+const (
+	defaultBurnRegion = "0 0.8 1 0.2"
+	defaultBurnColor = "#ffffff"
+	defaultBurnBox = "#000000b0"
+)
+
+// Match the markup WebVTT allows in cue text, such as <b> and <v Speaker>.
+var cueMarkup = regexp.MustCompile(`<[^>]*>`)
+
+// Parse a color as #rgb, #rrggbb or #rrggbbaa.
+func parseHexColor(value string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	number, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 || !strings.HasPrefix(value, "#") {
+		return color.NRGBA{}, fmt.Errorf("color %q should be #rgb, #rrggbb or #rrggbbaa", value)
+	}
+	return color.NRGBA{R: uint8(number >> 24), G: uint8(number >> 16), B: uint8(number >> 8), A: uint8(number)}, nil
+}
+
+// Parse the region as fractions of the PNG.
+func (burnIn *BurnIn) region() ([4]float64, error) {
+	var region [4]float64
+	value := burnIn.Region
+	if value == "" {
+		value = defaultBurnRegion
+	}
+	fields := strings.Fields(strings.ReplaceAll(value, ",", " "))
+	if len(fields) != 4 {
+		return region, fmt.Errorf("region %q should be \"x y width height\"", value)
+	}
+	for i, field := range fields {
+		number, err := strconv.ParseFloat(field, 64)
+		if err != nil || number < 0 || number > 1 {
+			return region, fmt.Errorf("region %q should be fractions of the image, from 0 to 1", value)
+		}
+		region[i] = number
+	}
+	if region[2] == 0 || region[3] == 0 || region[0]+region[2] > 1 || region[1]+region[3] > 1 {
+		return region, fmt.Errorf("region %q should have a size and lie within the image", value)
+	}
+	return region, nil
+}
+
+// Check that the captions can be burned in, before any rendering is done.
+func (burnIn *BurnIn) validate(image *Image) error {
+	if burnIn == nil {
+		return nil
+	}
+	if image.Subtitles == "" {
+		return fmt.Errorf("burn_captions needs subtitles: to take the captions from")
+	}
+	if _, err := burnIn.region(); err != nil {
+		return err
+	}
+	if _, err := parseHexColor(cmp.Or(burnIn.Color, defaultBurnColor)); err != nil {
+		return err
+	}
+	if burnIn.Box != "none" {
+		if _, err := parseHexColor(cmp.Or(burnIn.Box, defaultBurnBox)); err != nil {
+			return err
+		}
+	}
+	if burnIn.Scale < 0 {
+		return fmt.Errorf("scale should be positive, not %d", burnIn.Scale)
+	}
+	return nil
+}
+
+// Find the cues shown during each layer of an image, and when each layer
+// starts on the subtitles' clock: a layer timed by the subtitles starts at
+// its cue, and any other follows on from the layer before it. Nothing is
+// found without burn_captions.
+func (image *Image) layerCaptions(durations []float64) ([][]*Cue, []float64, error) {
+	if image.BurnCaptions == nil {
+		return nil, nil, nil
+	}
+	cues, err := parseSubtitles(resolvePath(image.baseDir, image.Subtitles))
+	if err != nil {
+		return nil, nil, err
+	}
+	starts, err := image.subtitleStarts(cues)
+	if err != nil {
+		return nil, nil, err
+	}
+	captions := make([][]*Cue, len(image.Layers))
+	next := 0.0
+	for i := range image.Layers {
+		if starts[i] < 0 {
+			starts[i] = next
+		}
+		duration := durations[i]
+		if duration <= 0 {
+			duration = defaultSlideDuration
+		}
+		next = starts[i] + duration
+		for _, cue := range cues {
+			if cue.Start < next && cue.End > starts[i] {
+				captions[i] = append(captions[i], cue)
+			}
+		}
+	}
+	return captions, starts, nil
+}
+
+// Join the text of the cues into the lines to show, without any markup.
+func captionLines(cues []*Cue) []string {
+	var lines []string
+	for _, cue := range cues {
+		for _, line := range strings.Split(cueMarkup.ReplaceAllString(cue.Text, ""), "\n") {
+			if line = strings.Join(strings.Fields(line), " "); line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+// Wrap lines of text to a width in pixels at the given scale, breaking
+// between words (and cutting short a word too long for a line of its own).
+func wrapText(lines []string, width int, scale int) []string {
+	var wrapped []string
+	for _, line := range lines {
+		current := ""
+		for _, word := range strings.Fields(line) {
+			candidate := strings.TrimSpace(current + " " + word)
+			if w, _ := textSize(candidate, scale); w <= width || current == "" {
+				current = candidate
+				continue
+			}
+			wrapped = append(wrapped, current)
+			current = word
+		}
+		wrapped = append(wrapped, fitText(current, width, scale))
+	}
+	return wrapped
+}
+
+// Draw caption lines into the region of a PNG, centred at the bottom of it
+// on a box. Lines which don't fit are cut, with "..." on the last one shown.
+// Nothing happens without burn_captions.
+func (burnIn *BurnIn) burn(pngFile string, lines []string) error {
+	if burnIn == nil || len(lines) == 0 {
+		return nil
+	}
+	src, err := readPNG(pngFile)
+	if err != nil {
+		return err
+	}
+	bounds := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Bounds(), src, bounds.Min, draw.Src)
+
+	fractions, _ := burnIn.region()
+	region := image.Rect(
+		int(fractions[0]*float64(bounds.Dx())), int(fractions[1]*float64(bounds.Dy())),
+		int((fractions[0]+fractions[2])*float64(bounds.Dx())), int((fractions[1]+fractions[3])*float64(bounds.Dy())))
+	scale := burnIn.Scale
+	if scale == 0 {
+		scale = max(1, region.Dy()/(2*(glyphHeight+3)))
+	}
+	padding := 2 * scale
+	lineHeight := (glyphHeight + 2) * scale
+	lines = wrapText(lines, region.Dx()-2*padding, scale)
+	if fit := max(1, (region.Dy()-2*padding+2*scale)/lineHeight); len(lines) > fit {
+		lines = lines[:fit]
+		lines[fit-1] = fitText(lines[fit-1]+"...", region.Dx()-2*padding, scale)
+	}
+
+	textWidth := 0
+	for _, line := range lines {
+		w, _ := textSize(line, scale)
+		textWidth = max(textWidth, w)
+	}
+	textHeight := len(lines)*lineHeight - 2*scale
+	box := image.Rect(0, 0, textWidth+2*padding, textHeight+2*padding)
+	box = box.Add(image.Pt(region.Min.X+(region.Dx()-box.Dx())/2, region.Max.Y-box.Dy())).Intersect(region)
+	if burnIn.Box != "none" {
+		boxColor, _ := parseHexColor(cmp.Or(burnIn.Box, defaultBurnBox))
+		draw.Draw(img, box, image.NewUniform(boxColor), image.Point{}, draw.Over)
+	}
+	ink, _ := parseHexColor(cmp.Or(burnIn.Color, defaultBurnColor))
+	for i, line := range lines {
+		w, _ := textSize(line, scale)
+		drawText(img, box.Min.X+(box.Dx()-w)/2, box.Min.Y+padding+i*lineHeight, line, scale, ink)
+	}
+	return writePNG(pngFile, img)
+}
+
+// Pick the caption lines for one of a slide's camera frames (counting from
+// 0): those of the cues showing at the frame's time, or none unless the
+// camera frames are to have them.
+func (burnIn *BurnIn) frameLines(slide *Slide, camera *Camera, frame int) []string {
+	if burnIn == nil || !burnIn.Frames {
+		return nil
+	}
+	fps := camera.FPS
+	if fps <= 0 {
+		fps = defaultAnimationFPS
+	}
+	at := slide.CaptionsStart + float64(frame)/float64(fps)
+	var showing []*Cue
+	for _, cue := range slide.Captions {
+		if cue.Start <= at && at < cue.End {
+			showing = append(showing, cue)
+		}
+	}
+	return captionLines(showing)
+}
@@ -0,0 +1,214 @@
+// Move a virtual camera over a layer, exporting a sequence of frames with the
+// view panning and zooming from one part of the drawing to another.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Represent a layer's camera move: the viewBox rectangles it starts and ends
+// at, as "x y width height" (where an empty start means the document's own
+// viewBox), how many frames it takes and how it speeds up and slows down.
+// The frames can also be packaged into animated files (gif, apng or webm)
+// which play at the given frame rate.
+type Camera struct {
+	From string `yaml:"from,omitempty"`
+	To string `yaml:"to"`
+	Frames int `yaml:"frames"`
+	Easing string `yaml:"easing,omitempty"`
+	Animations []string `yaml:"animations,omitempty"`
+	FPS int `yaml:"fps,omitempty"`
+}
+
+// List the PNGs of the camera move for a layer exported to the given PNG.
+func (camera *Camera) framePngs(pngFile string) []string {
+	if camera == nil {
+		return nil
+	}
+	var frames []string
+	for frame := 1; frame <= camera.Frames; frame++ {
+		frames = append(frames, fmt.Sprintf("%s_cam%02d.png", strings.TrimSuffix(pngFile, ".png"), frame))
+	}
+	return frames
+}
+
+// The easings a camera move can use, as functions from the fraction of the
+// move's frames done to the fraction of the distance covered.
+var cameraEasings = map[string]func(float64) float64{
+	"linear": func(t float64) float64 { return t },
+	"ease-in": func(t float64) float64 { return t * t },
+	"ease-out": func(t float64) float64 { return 1 - (1-t)*(1-t) },
+	"ease-in-out": func(t float64) float64 { return t * t * (3 - 2*t) },
+}
+
+// Parse a viewBox rectangle, which may separate its numbers with spaces or
+// commas.
+func parseViewBox(value string) ([4]float64, error) {
+	var rect [4]float64
+	fields := strings.Fields(strings.ReplaceAll(value, ",", " "))
+	if len(fields) != 4 {
+		return rect, fmt.Errorf("viewBox %q should be \"x y width height\"", value)
+	}
+	for i, field := range fields {
+		number, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return rect, fmt.Errorf("viewBox %q has a non-numeric value %q", value, field)
+		}
+		rect[i] = number
+	}
+	if rect[2] <= 0 || rect[3] <= 0 {
+		return rect, fmt.Errorf("viewBox %q should have a positive width and height", value)
+	}
+	return rect, nil
+}
+
+// Check that the camera move can be made, before any rendering is done.
+func (camera *Camera) validate() error {
+	if camera == nil {
+		return nil
+	}
+	if camera.Frames < 2 {
+		return fmt.Errorf("camera needs at least 2 frames, not %d", camera.Frames)
+	}
+	if camera.From != "" {
+		if _, err := parseViewBox(camera.From); err != nil {
+			return fmt.Errorf("camera from: %w", err)
+		}
+	}
+	if _, err := parseViewBox(camera.To); err != nil {
+		return fmt.Errorf("camera to: %w", err)
+	}
+	if _, ok := cameraEasings[camera.Easing]; camera.Easing != "" && !ok {
+		return fmt.Errorf("unknown camera easing %q", camera.Easing)
+	}
+	for _, format := range camera.Animations {
+		if _, ok := animationExtensions[format]; !ok {
+			return fmt.Errorf("unknown animation format %q; expected gif, apng or webm", format)
+		}
+	}
+	if camera.FPS < 0 {
+		return fmt.Errorf("camera fps should be positive, not %d", camera.FPS)
+	}
+	return nil
+}
+
+// Work out the document's own viewBox, from its viewBox attribute or else its
+// width and height (in user units, or px).
+func documentViewBox(root *etree.Element) ([4]float64, error) {
+	if viewBox := root.SelectAttrValue("viewBox", ""); viewBox != "" {
+		return parseViewBox(viewBox)
+	}
+	width := strings.TrimSuffix(root.SelectAttrValue("width", ""), "px")
+	height := strings.TrimSuffix(root.SelectAttrValue("height", ""), "px")
+	return parseViewBox(fmt.Sprintf("0 0 %s %s", width, height))
+}
+
+// Format a viewBox rectangle without needless decimal places.
+func formatViewBox(rect [4]float64) string {
+	fields := make([]string, len(rect))
+	for i, number := range rect {
+		fields[i] = strconv.FormatFloat(math.Round(number*1000)/1000, 'f', -1, 64)
+	}
+	return strings.Join(fields, " ")
+}
+
+// Point the document's viewBox at the end of the camera move, which is what
+// the layer's own PNG shows (so that it holds where the move finishes), and
+// return where the move starts. The returned function puts the viewBox back
+// the way it was, for the layers after this one.
+func (camera *Camera) aim(doc *etree.Document) ([4]float64, func(), error) {
+	var start [4]float64
+	root := doc.Root()
+	if camera == nil || root == nil {
+		return start, func() {}, nil
+	}
+	var err error
+	if camera.From != "" {
+		start, err = parseViewBox(camera.From)
+	} else {
+		start, err = documentViewBox(root)
+	}
+	if err != nil {
+		return start, nil, fmt.Errorf("camera start: %w", err)
+	}
+	original := root.SelectAttr("viewBox")
+	var originalValue string
+	if original != nil {
+		originalValue = original.Value
+	}
+	root.CreateAttr("viewBox", camera.To)
+	return start, func() {
+		if original != nil {
+			root.CreateAttr("viewBox", originalValue)
+		} else {
+			root.RemoveAttr("viewBox")
+		}
+	}, nil
+}
+
+// Export the camera move as a numbered sequence of PNGs next to the layer's
+// own one (NAME_cam01.png and so on), with the viewBox moved part of the way
+// from the start (as found by aim) to the end in each.
+func (camera *Camera) exportFrames(run *Run, image *Image, layer *ImageLayer, doc *etree.Document, start [4]float64, slide *Slide) error {
+	if camera == nil {
+		return nil
+	}
+	end, err := parseViewBox(camera.To)
+	if err != nil {
+		return err
+	}
+	easing := cameraEasings[camera.Easing]
+	if easing == nil {
+		easing = cameraEasings["linear"]
+	}
+
+	renderer := run.imageRenderer(image)
+	pipe := run.pipesSVG(image, renderer)
+	options := layer.exportOptions(image)
+	for i, framePng := range camera.framePngs(slide.PngFile) {
+		frame := i + 1
+		progress := easing(float64(i) / float64(camera.Frames-1))
+		var rect [4]float64
+		for i := range rect {
+			rect[i] = start[i] + (end[i]-start[i])*progress
+		}
+		doc.Root().CreateAttr("viewBox", formatViewBox(rect))
+
+		if pipe {
+			frameData, err := doc.WriteToBytes()
+			if err != nil {
+				return err
+			}
+			err = renderer.exportPNGData(frameData, framePng, options)
+			if err != nil {
+				return fmt.Errorf("could not export camera frame %d: %w", frame, err)
+			}
+		} else {
+			frameSvg, err := run.svgPath(framePng)
+			if err != nil {
+				return err
+			}
+			if err := writeSVG(doc, frameSvg); err != nil {
+				return fmt.Errorf("problem writing to %s: %w", frameSvg, err)
+			}
+			if err := renderer.exportPNG(frameSvg, framePng, options); err != nil {
+				return fmt.Errorf("could not export camera frame %d: %w", frame, err)
+			}
+		}
+		if err := image.BurnCaptions.burn(framePng, image.BurnCaptions.frameLines(slide, camera, i)); err != nil {
+			return fmt.Errorf("could not burn captions into camera frame %d: %w", frame, err)
+		}
+		if err := image.stampPNG(framePng, layer.Suffix, layer.Title, layer.Notes, ""); err != nil {
+			return fmt.Errorf("could not add metadata to %s: %w", framePng, err)
+		}
+		slide.Frames = append(slide.Frames, framePng)
+	}
+	debugf("Rendered %d camera frames for %s\n", camera.Frames, slide.PngFile)
+	return nil
+}
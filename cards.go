@@ -0,0 +1,266 @@
+// Generate a title card before an image's layers and an end card after them,
+// from a built-in template or an SVG template of one's own, with the text
+// (title, episode, date and speaker) coming from the image's "metadata:".
+// The cards are slides of the image like its layers, so they appear in the
+// manifest, slides.txt and the PDF in their place.
+
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/beevik/etree"
+)
+
+// Represent the details of an image which its cards show. Any of them may be
+// left out.
+type CardMetadata struct {
+	Title string `yaml:"title,omitempty"`
+	Episode string `yaml:"episode,omitempty"`
+	Date string `yaml:"date,omitempty"`
+	Speaker string `yaml:"speaker,omitempty"`
+}
+
+// Fill in whatever the metadata leaves unset from other metadata.
+func (metadata *CardMetadata) merge(defaults *CardMetadata) *CardMetadata {
+	if defaults == nil {
+		return metadata
+	}
+	if metadata == nil {
+		return defaults
+	}
+	return &CardMetadata{
+		Title: cmp.Or(metadata.Title, defaults.Title),
+		Episode: cmp.Or(metadata.Episode, defaults.Episode),
+		Date: cmp.Or(metadata.Date, defaults.Date),
+		Speaker: cmp.Or(metadata.Speaker, defaults.Speaker),
+	}
+}
+
+// Represent a title or end card: the SVG template it is made from (the
+// built-in one unless given), the suffix of its PNG and how long it is shown
+// for.
+type Card struct {
+	Template string `yaml:"template,omitempty"`
+	Suffix string `yaml:"suffix,omitempty"`
+	Duration float64 `yaml:"duration,omitempty"`
+}
+
+// The seconds a card is shown for unless it says otherwise.
+const defaultCardDuration = 3
+
+// Represent the values which are filled into a card template: the image's
+// metadata, where the title is the SVG's name unless given, the SVG, and the
+// size of its page, so that the card comes out the same size as the layers.
+// Width and Height are as the SVG gives them (with their units) and ViewBox
+// is its user space, "x y width height".
+type CardInfo struct {
+	CardMetadata
+	Image string
+	Width string
+	Height string
+	ViewBox [4]float64
+}
+
+// The page of a card when the SVG's own can't be worked out.
+var defaultCardViewBox = [4]float64{0, 0, 1280, 720}
+
+// The functions a card template can use, such as {{xml .Title}} to escape a
+// value for the SVG and {{viewBox .ViewBox}} to write out the page.
+var cardFuncs = template.FuncMap{"xml": xmlEscape, "viewBox": formatViewBox}
+
+// The built-in cards are laid out on a 1280x720 page, which is fitted into
+// the middle of the SVG's own over a background filling all of it.
+var titleCardTemplate = template.Must(template.New("title card").Funcs(cardFuncs).Parse(
+	`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="{{xml .Width}}" height="{{xml .Height}}" viewBox="{{viewBox .ViewBox}}">
+  <rect x="{{index .ViewBox 0}}" y="{{index .ViewBox 1}}" width="{{index .ViewBox 2}}" height="{{index .ViewBox 3}}" style="fill:#111111"/>
+  <svg x="{{index .ViewBox 0}}" y="{{index .ViewBox 1}}" width="{{index .ViewBox 2}}" height="{{index .ViewBox 3}}" viewBox="0 0 1280 720">
+{{- if .Episode}}
+    <text x="640" y="230" style="font-family:sans-serif;font-size:36px;fill:#aaaaaa;text-anchor:middle">Episode {{xml .Episode}}</text>
+{{- end}}
+    <text x="640" y="350" style="font-family:sans-serif;font-size:72px;font-weight:bold;fill:#ffffff;text-anchor:middle">{{xml .Title}}</text>
+{{- if .Speaker}}
+    <text x="640" y="450" style="font-family:sans-serif;font-size:40px;fill:#cccccc;text-anchor:middle">{{xml .Speaker}}</text>
+{{- end}}
+{{- if .Date}}
+    <text x="640" y="510" style="font-family:sans-serif;font-size:32px;fill:#aaaaaa;text-anchor:middle">{{xml .Date}}</text>
+{{- end}}
+  </svg>
+</svg>
+`))
+
+var endCardTemplate = template.Must(template.New("end card").Funcs(cardFuncs).Parse(
+	`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="{{xml .Width}}" height="{{xml .Height}}" viewBox="{{viewBox .ViewBox}}">
+  <rect x="{{index .ViewBox 0}}" y="{{index .ViewBox 1}}" width="{{index .ViewBox 2}}" height="{{index .ViewBox 3}}" style="fill:#111111"/>
+  <svg x="{{index .ViewBox 0}}" y="{{index .ViewBox 1}}" width="{{index .ViewBox 2}}" height="{{index .ViewBox 3}}" viewBox="0 0 1280 720">
+    <text x="640" y="330" style="font-family:sans-serif;font-size:72px;font-weight:bold;fill:#ffffff;text-anchor:middle">Thanks for watching</text>
+    <text x="640" y="430" style="font-family:sans-serif;font-size:40px;fill:#cccccc;text-anchor:middle">{{xml .Title}}</text>
+{{- if .Speaker}}
+    <text x="640" y="490" style="font-family:sans-serif;font-size:32px;fill:#aaaaaa;text-anchor:middle">{{xml .Speaker}}</text>
+{{- end}}
+  </svg>
+</svg>
+`))
+
+// Represent one of an image's cards, with what it is made from and where it
+// goes among the image's outputs (for the name template's LayerIndex).
+type imageCard struct {
+	*Card
+	kind string
+	builtin *template.Template
+	index int
+}
+
+// List the image's cards, the title card before its layers and the end card
+// after them (and its composites).
+func (image *Image) cards() []*imageCard {
+	var cards []*imageCard
+	if image.TitleCard != nil {
+		cards = append(cards, &imageCard{Card: image.TitleCard, kind: "title", builtin: titleCardTemplate, index: 0})
+	}
+	if image.EndCard != nil {
+		cards = append(cards, &imageCard{Card: image.EndCard, kind: "end", builtin: endCardTemplate, index: len(image.Layers) + len(image.Composites) + 1})
+	}
+	return cards
+}
+
+// Give the cards which left out their suffix the usual one, _title or _end.
+func (image *Image) assignCardSuffixes() {
+	for _, card := range image.cards() {
+		if card.Suffix == "" {
+			card.Suffix = "_" + card.kind
+		}
+	}
+}
+
+// Work out the names of the PNGs of the image's cards, in the order cards
+// lists them, as slash-separated paths relative to the output directory.
+func (image *Image) cardNames(runTemplate string) ([]string, error) {
+	nameTemplate, err := image.nameTemplate(runTemplate)
+	if err != nil {
+		return nil, err
+	}
+	base := remoteBase(image.Filename)
+	fields := NameFields{ImageBase: strings.TrimSuffix(base, filepath.Ext(base))}
+	var names []string
+	for _, card := range image.cards() {
+		fields.LayerIndex, fields.Suffix = card.index, card.Suffix
+		name, err := outputName(nameTemplate, fields)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Read the template a card is made from, which for one of the image's own is
+// resolved against its base directory.
+func (image *Image) cardTemplate(card *imageCard) (*template.Template, error) {
+	if card.Template == "" {
+		return card.builtin, nil
+	}
+	file := resolvePath(image.baseDir, card.Template)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(file)).Funcs(cardFuncs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s card template %s: %w", card.kind, card.Template, err)
+	}
+	return tmpl, nil
+}
+
+// Work out what the image's cards show, on a page the size of the one the
+// SVG's root element gives.
+func (image *Image) cardInfo(root *etree.Element) *CardInfo {
+	info := &CardInfo{Image: image.Filename, ViewBox: defaultCardViewBox}
+	if image.Metadata != nil {
+		info.CardMetadata = *image.Metadata
+	}
+	if info.Title == "" {
+		base := remoteBase(image.Filename)
+		info.Title = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if root != nil {
+		if viewBox, err := documentViewBox(root); err == nil {
+			info.ViewBox = viewBox
+		}
+		info.Width, info.Height = root.SelectAttrValue("width", ""), root.SelectAttrValue("height", "")
+	}
+	if info.Width == "" || info.Height == "" {
+		info.Width, info.Height = strconv.FormatFloat(info.ViewBox[2], 'f', -1, 64), strconv.FormatFloat(info.ViewBox[3], 'f', -1, 64)
+	}
+	return info
+}
+
+// Write a card's SVG alongside the other intermediates and render it at the
+// image's resolution, returning its slide. The card takes the size of the
+// page from root, the image's SVG. Like a layer, a card whose PNG is up to
+// date is skipped with --resume.
+func (image *Image) writeCard(run *Run, card *imageCard, root *etree.Element, pngFile string) (*Slide, error) {
+	tmpl, err := image.cardTemplate(card)
+	if err != nil {
+		return nil, err
+	}
+	info := image.cardInfo(root)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, info); err != nil {
+		return nil, err
+	}
+
+	slide := &Slide{PngFile: pngFile, Image: image.Filename, Layer: card.Suffix, Title: info.Title, Duration: cmp.Or(card.Duration, defaultCardDuration)}
+	if slide.SvgFile, err = run.svgPath(pngFile); err != nil {
+		return nil, err
+	}
+	if run.Limits != nil {
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(buf.Bytes()); err != nil {
+			return nil, fmt.Errorf("invalid %s card: %w", card.kind, err)
+		}
+		if err := run.Limits.checkLinks(doc.Root(), filepath.Dir(slide.SvgFile)); err != nil {
+			return nil, err
+		}
+	}
+	writer, err := createSVG(slide.SvgFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(buf.Bytes()); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	renderer := run.imageRenderer(image)
+	options := ExportOptions{Resolution: image.Resolution, RendererArgs: image.RendererArgs}
+	svgHash := sha256.New()
+	svgHash.Write(buf.Bytes())
+	fingerprint := exportFingerprint(svgHash, options, renderer, nil, nil)
+	if run.Resume && pngFingerprint(pngFile) == fingerprint {
+		debugf("Already up to date: %s\n", pngFile)
+		run.Resumed.Add(1)
+		return slide, nil
+	}
+	if err := renderer.exportPNG(slide.SvgFile, pngFile, options); err != nil {
+		return nil, &RenderError{fmt.Errorf("could not convert the %s card to PNG with Inkscape: %w", card.kind, err)}
+	}
+	if err := image.stampPNG(pngFile, card.Suffix, info.Title, "", fingerprint); err != nil {
+		return nil, fmt.Errorf("could not add metadata to %s: %w", pngFile, err)
+	}
+	debugf("Rendered %s\n", pngFile)
+	return slide, nil
+}
@@ -0,0 +1,116 @@
+// Export chapter markers for the video made from the slides, from the layers'
+// titles and durations: as the timestamps a YouTube description turns into
+// chapters, or as an ffmpeg metadata file to mux into an MP4 or podcast.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Represent a chapter of the video, from the first slide with its title to
+// the next slide with another, in milliseconds.
+type chapter struct {
+	Title string
+	Start int
+	End int
+}
+
+// The shortest chapter YouTube accepts, in milliseconds, and the fewest
+// chapters it needs.
+const (
+	minYouTubeChapter = 10000
+	minYouTubeChapters = 3
+)
+
+// Divide the slides into chapters by their titles. A slide without a title,
+// or with the same title as the one before, carries on the chapter before
+// it; the first chapter starts at the beginning, whatever comes before its
+// title.
+func layoutChapters(slides []*Slide) ([]*chapter, error) {
+	var chapters []*chapter
+	elapsed := 0.0
+	for _, slide := range slides {
+		start := int(math.Round(elapsed * 1000))
+		elapsed += slide.seconds()
+		if slide.Title != "" && (len(chapters) == 0 || chapters[len(chapters)-1].Title != slide.Title) {
+			if len(chapters) == 0 {
+				start = 0
+			} else {
+				chapters[len(chapters)-1].End = start
+			}
+			chapters = append(chapters, &chapter{Title: slide.Title, Start: start})
+		}
+	}
+	if len(chapters) == 0 {
+		return nil, fmt.Errorf("none of the slides have a title to name a chapter after")
+	}
+	chapters[len(chapters)-1].End = int(math.Round(elapsed * 1000))
+	return chapters, nil
+}
+
+// Format a time as YouTube writes chapter timestamps, M:SS or, for a video
+// of an hour or more, H:MM:SS.
+func youTubeTimestamp(milliseconds int, hours bool) string {
+	seconds := milliseconds / 1000
+	if hours {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// Write the chapters as lines of a YouTube description, warning about what
+// would stop YouTube from making chapters of them.
+func encodeYouTubeChapters(chapters []*chapter) []byte {
+	if len(chapters) < minYouTubeChapters {
+		log.Printf("WARNING YouTube needs at least %d chapters, not %d\n", minYouTubeChapters, len(chapters))
+	}
+	hours := chapters[len(chapters)-1].End >= 3600*1000
+	var builder strings.Builder
+	for _, chapter := range chapters {
+		if chapter.End-chapter.Start < minYouTubeChapter {
+			log.Printf("WARNING chapter %q is shorter than the %d seconds YouTube needs\n", chapter.Title, minYouTubeChapter/1000)
+		}
+		fmt.Fprintf(&builder, "%s %s\n", youTubeTimestamp(chapter.Start, hours), chapter.Title)
+	}
+	return []byte(builder.String())
+}
+
+// Escape a value for an ffmpeg metadata file, which uses a backslash before
+// its special characters.
+var ffmetadataEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+
+// Write the chapters as an ffmpeg metadata file, for muxing in with
+// "ffmpeg -i slides.mp4 -i chapters.ffmeta -map_metadata 1 -codec copy".
+func encodeFFMetadata(chapters []*chapter) []byte {
+	var builder strings.Builder
+	builder.WriteString(";FFMETADATA1\n")
+	for _, chapter := range chapters {
+		fmt.Fprintf(&builder, "\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n", chapter.Start, chapter.End, ffmetadataEscaper.Replace(chapter.Title))
+	}
+	return []byte(builder.String())
+}
+
+// Write the chapters in the format implied by the file extension: .txt for
+// YouTube, or .ffmeta (or .ffmetadata) for ffmpeg.
+func writeChapters(filename string, slides []*Slide) error {
+	chapters, err := layoutChapters(slides)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".txt":
+		data = encodeYouTubeChapters(chapters)
+	case ".ffmeta", ".ffmetadata":
+		data = encodeFFMetadata(chapters)
+	default:
+		return fmt.Errorf("unknown chapters format for %s (use .txt or .ffmeta)", filename)
+	}
+	return os.WriteFile(filename, data, 0644)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLayoutChapters(t *testing.T) {
+	type timed struct {
+		title string
+		duration float64
+	}
+	tests := []struct {
+		name string
+		slides []timed
+		want []chapter
+		err string
+	}{
+		{
+			name: "one chapter for each title",
+			slides: []timed{{"Intro", 10}, {"Method", 20}, {"Results", 12.5}},
+			want: []chapter{{"Intro", 0, 10000}, {"Method", 10000, 30000}, {"Results", 30000, 42500}},
+		},
+		{
+			name: "untitled first slides belong to the first chapter",
+			slides: []timed{{"", 5}, {"", 5}, {"Intro", 10}, {"Method", 10}},
+			want: []chapter{{"Intro", 0, 20000}, {"Method", 20000, 30000}},
+		},
+		{
+			name: "untitled slides carry on the chapter before",
+			slides: []timed{{"Intro", 10}, {"", 10}, {"Method", 10}, {"", 5}},
+			want: []chapter{{"Intro", 0, 20000}, {"Method", 20000, 35000}},
+		},
+		{
+			name: "a title repeated by the next slides is one chapter",
+			slides: []timed{{"Intro", 10}, {"Intro", 10}, {"Method", 10}, {"Method", 10}},
+			want: []chapter{{"Intro", 0, 20000}, {"Method", 20000, 40000}},
+		},
+		{
+			name: "a title coming back later starts another chapter",
+			slides: []timed{{"Intro", 10}, {"Method", 10}, {"Intro", 10}},
+			want: []chapter{{"Intro", 0, 10000}, {"Method", 10000, 20000}, {"Intro", 20000, 30000}},
+		},
+		{
+			name: "slides without a duration take the default",
+			slides: []timed{{"Intro", 0}, {"Method", 0}},
+			want: []chapter{{"Intro", 0, defaultSlideDuration * 1000}, {"Method", defaultSlideDuration * 1000, 2 * defaultSlideDuration * 1000}},
+		},
+		{
+			name: "no titles",
+			slides: []timed{{"", 10}, {"", 10}},
+			err: "none of the slides have a title to name a chapter after",
+		},
+		{
+			name: "no slides",
+			err: "none of the slides have a title to name a chapter after",
+		},
+	}
+	for _, test := range tests {
+		var slides []*Slide
+		for _, slide := range test.slides {
+			slides = append(slides, &Slide{Title: slide.title, Duration: slide.duration})
+		}
+		chapters, err := layoutChapters(slides)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: error = %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+		var got []chapter
+		for _, chapter := range chapters {
+			got = append(got, *chapter)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: chapters = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestYouTubeTimestamp(t *testing.T) {
+	tests := []struct {
+		milliseconds int
+		hours bool
+		want string
+	}{
+		{milliseconds: 0, want: "0:00"},
+		{milliseconds: 65999, want: "1:05"},
+		{milliseconds: 600000, want: "10:00"},
+		{milliseconds: 65000, hours: true, want: "0:01:05"},
+		{milliseconds: 3723000, hours: true, want: "1:02:03"},
+	}
+	for _, test := range tests {
+		if got := youTubeTimestamp(test.milliseconds, test.hours); got != test.want {
+			t.Errorf("youTubeTimestamp(%d, %v) = %q, want %q", test.milliseconds, test.hours, got, test.want)
+		}
+	}
+}
+
+func TestEncodeFFMetadata(t *testing.T) {
+	chapters := []*chapter{{"Intro", 0, 10000}, {"Q&A; a=b #1", 10000, 25000}}
+	want := `;FFMETADATA1
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=10000
+title=Intro
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=10000
+END=25000
+title=Q&A\; a\=b \#1
+`
+	if got := string(encodeFFMetadata(chapters)); got != want {
+		t.Errorf("encodeFFMetadata =\n%s\nwant\n%s", got, want)
+	}
+}
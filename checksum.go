@@ -0,0 +1,174 @@
+// Record checksums of the outputs and check them again later, so that an
+// archived deck can be shown to be exactly what was rendered.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The name of the combined checksum file, in the format sha256sum reads.
+const checksumsFile = "SHA256SUMS"
+
+// The extension of a per-file checksum sidecar.
+const sidecarExt = ".sha256"
+
+// The ways checksums can be written: a sidecar next to every output, or one
+// SHA256SUMS file at the top of the output directory.
+var knownChecksumModes = map[string]bool{"sidecar": true, "sums": true}
+
+// Hash a file's contents.
+func fileSHA256(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// Report whether a file holds checksums rather than being an output itself.
+func isChecksumFile(file string) bool {
+	return strings.HasSuffix(file, sidecarExt) || filepath.Base(file) == checksumsFile
+}
+
+// Write checksums for every file in the output directory, either as sidecars
+// or as a single SHA256SUMS (with sha256sum's "hash  path" lines).
+func writeChecksums(outDir string, mode string) error {
+	files, err := listFiles(outDir)
+	if err != nil {
+		return err
+	}
+	var sums strings.Builder
+	for _, file := range files {
+		if isChecksumFile(file) {
+			continue
+		}
+		filename := filepath.Join(outDir, filepath.FromSlash(file))
+		sum, err := fileSHA256(filename)
+		if err != nil {
+			return err
+		}
+		if mode == "sidecar" {
+			line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(filename))
+			if err := os.WriteFile(filename+sidecarExt, []byte(line), 0644); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", sum, file)
+	}
+	if mode == "sidecar" {
+		return nil
+	}
+	return os.WriteFile(filepath.Join(outDir, checksumsFile), []byte(sums.String()), 0644)
+}
+
+// Read the "hash  path" lines of a checksum file, with the paths resolved
+// against the directory it is in.
+func readChecksums(filename string) (map[string]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		sum, name, found := strings.Cut(text, "  ")
+		if !found || len(sum) != sha256.Size*2 {
+			return nil, fmt.Errorf("%s line %d is not a SHA-256 checksum", filename, line)
+		}
+		// A leading * marks binary mode, which makes no difference here.
+		name = strings.TrimPrefix(name, "*")
+		sums[filepath.Join(filepath.Dir(filename), filepath.FromSlash(name))] = sum
+	}
+	return sums, scanner.Err()
+}
+
+// Check every file against the checksums recorded in a directory, from its
+// SHA256SUMS and any sidecars. This returns how many checksums there were and
+// the problems found: mismatches, files which have gone missing and outputs
+// which no checksum covers.
+func verifyChecksums(dir string) (int, []string, error) {
+	files, err := listFiles(dir)
+	if err != nil {
+		return 0, nil, err
+	}
+	expected := make(map[string]string)
+	for _, file := range files {
+		if !isChecksumFile(file) {
+			continue
+		}
+		sums, err := readChecksums(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return 0, nil, err
+		}
+		for name, sum := range sums {
+			expected[name] = sum
+		}
+	}
+	if len(expected) == 0 {
+		return 0, nil, fmt.Errorf("no %s or %s files in %s", checksumsFile, sidecarExt, dir)
+	}
+
+	var problems []string
+	for _, file := range files {
+		if _, ok := expected[filepath.Join(dir, filepath.FromSlash(file))]; !ok && !isChecksumFile(file) {
+			problems = append(problems, fmt.Sprintf("%s: no checksum", file))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(expected)) {
+		rel, _ := filepath.Rel(dir, name)
+		sum, err := fileSHA256(name)
+		if os.IsNotExist(err) {
+			problems = append(problems, fmt.Sprintf("%s: missing", filepath.ToSlash(rel)))
+		} else if err != nil {
+			return 0, nil, err
+		} else if sum != expected[name] {
+			problems = append(problems, fmt.Sprintf("%s: checksum does not match", filepath.ToSlash(rel)))
+		}
+	}
+	slices.Sort(problems)
+	return len(expected), problems, nil
+}
+
+// Check an output directory against the checksums written when it was
+// rendered, exiting with an error if anything has changed.
+func verifyCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] outdir")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	checked, problems, err := verifyChecksums(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	for _, problem := range problems {
+		log.Printf("%s\n", problem)
+	}
+	if len(problems) > 0 {
+		log.Fatalf("Verify failed: %d problems with %s\n", len(problems), flags.Arg(0))
+	}
+	infof("Verified %d files in %s\n", checked, flags.Arg(0))
+}
@@ -0,0 +1,188 @@
+// Remove outputs which the config no longer produces, such as the PNGs left
+// behind after a layer's suffix is renamed, so that they don't end up in the
+// video by accident.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Match the name of a crossfade frame, as written by writeCrossfade.
+var crossfadeFrame = regexp.MustCompile(`_xfade\d+\.png$`)
+
+// Work out the names of the PNGs an image produces for its layers and then
+// its composites, as slash-separated paths relative to the output directory.
+func (image *Image) outputNames(runTemplate string) ([]string, []string, error) {
+	nameTemplate, err := image.nameTemplate(runTemplate)
+	if err != nil {
+		return nil, nil, err
+	}
+	base := remoteBase(image.Filename)
+	fields := NameFields{ImageBase: strings.TrimSuffix(base, filepath.Ext(base))}
+	var names []string
+	for i, layer := range image.Layers {
+		fields.LayerIndex, fields.Suffix = i+1, layer.Suffix
+		name, err := outputName(nameTemplate, fields)
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
+	}
+	for i, composite := range image.Composites {
+		fields.LayerIndex, fields.Suffix = len(image.Layers)+i+1, composite.Suffix
+		name, err := outputName(nameTemplate, fields)
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
+	}
+	return names[:len(image.Layers)], names[len(image.Layers):], nil
+}
+
+// List every PNG which the images would produce, in the deck and in each of
+// its locales, as slash-separated paths relative to the output directory.
+func plannedOutputs(images []*Image, runTemplate string) (map[string]bool, error) {
+	planned := make(map[string]bool)
+	for _, locale := range slices.Concat([]string{""}, localeNames(images)) {
+		for _, image := range images {
+			layers, composites, err := image.outputNames(runTemplate)
+			if err != nil {
+				return nil, err
+			}
+			for i, name := range layers {
+				planned[path.Join(locale, name)] = true
+				for _, frame := range image.Layers[i].Camera.framePngs(path.Join(locale, name)) {
+					planned[frame] = true
+				}
+				for _, variant := range image.Layers[i].variantPngs(path.Join(locale, name)) {
+					planned[variant] = true
+				}
+				if i == len(layers)-1 {
+					continue
+				}
+				for frame := 1; frame <= image.CrossfadeFrames; frame++ {
+					planned[fmt.Sprintf("%s_xfade%02d.png", path.Join(locale, strings.TrimSuffix(name, ".png")), frame)] = true
+				}
+			}
+			for _, name := range composites {
+				planned[path.Join(locale, name)] = true
+			}
+			cards, err := image.cardNames(runTemplate)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range cards {
+				planned[path.Join(locale, name)] = true
+			}
+		}
+	}
+	return planned, nil
+}
+
+// Find the outputs in a directory which aren't planned any more: layer and
+// composite PNGs (recognised by the stamp this tool adds) and crossfade
+// frames, along with the SVG and other formats written next to each of them.
+// Anything else the directory holds is left alone.
+func staleOutputs(outDir string, planned map[string]bool) ([]string, error) {
+	files, err := listFiles(outDir)
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]bool)
+	for _, file := range files {
+		present[file] = true
+	}
+	siblings := slices.Concat(svgExtensions, slices.Sorted(maps.Values(rasterExtensions)))
+
+	var stale []string
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".png") || planned[file] {
+			continue
+		}
+		if !crossfadeFrame.MatchString(file) && pngText(filepath.Join(outDir, file), "bulletpointer:source") == "" {
+			continue
+		}
+		stale = append(stale, file)
+		for _, ext := range siblings {
+			if sibling := strings.TrimSuffix(file, ".png") + ext; present[sibling] {
+				stale = append(stale, sibling)
+			}
+		}
+	}
+	slices.Sort(stale)
+	return stale, nil
+}
+
+// Delete the outputs in a directory which aren't planned any more, and any
+// subdirectories which that leaves empty, returning what was deleted. With
+// dryRun, nothing is deleted; only the list is returned.
+func pruneOutputs(outDir string, planned map[string]bool, dryRun bool) ([]string, error) {
+	stale, err := staleOutputs(outDir, planned)
+	if err != nil || dryRun {
+		return stale, err
+	}
+	for _, file := range stale {
+		if err := os.Remove(filepath.Join(outDir, filepath.FromSlash(file))); err != nil {
+			return nil, err
+		}
+		// Removing a directory which still has something in it fails,
+		// which is what stops this at the first one still in use.
+		for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+			if os.Remove(filepath.Join(outDir, filepath.FromSlash(dir))) != nil {
+				break
+			}
+		}
+	}
+	return stale, nil
+}
+
+// Delete the stale outputs from an output directory without rendering.
+func cleanCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] in.yaml... outdir")
+	dryRun := flags.Bool("dry-run", false, "list the stale outputs instead of deleting them")
+	options := &RenderOptions{}
+	options.registerFlags(flags)
+	flags.Parse(args)
+	if err := options.takePositional(flags.Args(), true); err != nil {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	images, _, err := options.loadImages()
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	if err := options.validateImages(images); err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	planned, err := plannedOutputs(images, options.NameTemplate)
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	unlock, err := lockOutDir(options.OutDir, options.Force)
+	if err != nil {
+		log.Fatalf("Clean failed: %s\n", err.Error())
+	}
+	defer unlock()
+	stale, err := pruneOutputs(options.OutDir, planned, *dryRun)
+	if err != nil {
+		log.Fatalf("Clean failed: %s\n", err.Error())
+	}
+	if *dryRun {
+		for _, file := range stale {
+			fmt.Println(file)
+		}
+		infof("%d stale outputs in %s\n", len(stale), options.OutDir)
+		return
+	}
+	infof("Removed %d stale outputs from %s\n", len(stale), options.OutDir)
+}
@@ -0,0 +1,166 @@
+// Parse the command line and dispatch to one of the tool's subcommands.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+)
+
+// How chatty the tool should be: -1 for --quiet, 0 by default and 1 for
+// --verbose. Failures are always logged regardless.
+var verbosity = 0
+
+// The format of log messages, as given by --log-format.
+var logFormat = "text"
+
+// Log an informational message, unless --quiet was given.
+func infof(format string, args ...any) {
+	if verbosity >= 0 {
+		log.Printf(format, args...)
+	}
+}
+
+// Log a detailed progress message, only if --verbose was given.
+func debugf(format string, args ...any) {
+	if verbosity > 0 {
+		log.Printf(format, args...)
+	}
+}
+
+// Represent one of the tool's subcommands.
+type command struct {
+	name string
+	args string
+	summary string
+	run func(name string, args []string)
+}
+
+// List the subcommands in the order they are shown in the usage message.
+func commands() []*command {
+	return []*command{
+		{"render", "[options] in.yaml... outdir", "render every layer of every image (the default)", renderCommand},
+		{"validate", "[options] in.yaml...", "check the config and the SVGs it refers to without rendering", validateCommand},
+		{"lint", "[options] in.yaml...", "warn about layers which contradict themselves or change nothing, and unused artwork", lintCommand},
+		{"watch", "[options] in.yaml... outdir", "render, then render again whenever an input changes", watchCommand},
+		{"tui", "[options] in.yaml... outdir", "browse the layers in the terminal and re-render, preview or edit them", tuiCommand},
+		{"serve", "[options] in.yaml...", "serve a live preview which reloads whenever an input changes", serveCommand},
+		{"daemon", "[options]", "run a shared render service with an HTTP API and a job queue", daemonCommand},
+		{"init", "[options] [deck.svg] [in.yaml]", "write a starter config file, generated from an SVG if given", initCommand},
+		{"md2config", "[options] talk.md [in.yaml]", "write a config which fills a template SVG from a Markdown outline", md2configCommand},
+		{"optimize", "[options] in.svg [out.svg]", "strip editor markup, unused definitions and hidden elements from an SVG", optimizeCommand},
+		{"inspect", "[options] file.svg", "list the elements of an SVG with their IDs, labels and display state", inspectCommand},
+		{"clean", "[options] in.yaml... outdir", "delete outputs which the config no longer produces", cleanCommand},
+		{"verify", "[options] outdir", "check the outputs against the checksums written with --checksums", verifyCommand},
+		{"diff", "[options] old_dir new_dir", "compare two directories of rendered slides pixel by pixel", diffCommand},
+		{"test", "[options] --golden dir in.yaml...", "render and compare every slide with its golden PNG, writing a JUnit-style report", testCommand},
+		{"bench", "[options] in.yaml...", "render without keeping the outputs and report where the time goes", benchCommand},
+		{"fmt", "[options] in.yaml...", "rewrite config files with their keys in order and comments kept", fmtCommand},
+		{"schema", "", "write a JSON Schema for config files, for editor completion", schemaCommand},
+		{"assign-ids", "in.svg [out.svg]", "give elements readable IDs to refer to from the config", func(name string, args []string) { assignIDsCommand(args) }},
+	}
+}
+
+// Print the overall usage message, listing every subcommand.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: bulletpointer <command> [options] [arguments]\n\nCommands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nRun \"bulletpointer <command> -h\" for the options of a command.\n"+
+		"For compatibility, \"bulletpointer [options] in.yaml outdir\" is the same as render.\n"+
+		"Config arguments may be globs, such as \"configs/*.yaml\", or - for stdin;\n"+
+		"an output dir of - streams an archive of the outputs to stdout.\n\n"+
+		"Exit codes: 2 for a config error, 3 for a missing input, 4 for a renderer\n"+
+		"failure, 5 when --keep-going carried on past failures and 130 when stopped\n"+
+		"by a signal.")
+}
+
+// Make a flag set for a subcommand, with a usage message showing its
+// arguments and the options common to every command.
+func newFlagSet(name string, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: bulletpointer %s %s\n", name, args)
+		flags.PrintDefaults()
+	}
+	flags.BoolFunc("verbose", "log every layer as it is rendered", func(string) error {
+		verbosity = 1
+		return nil
+	})
+	flags.BoolFunc("quiet", "only log failures", func(string) error {
+		verbosity = -1
+		return nil
+	})
+	flags.Func("log-format", "format of log messages: text or json (default text)", func(value string) error {
+		switch value {
+		case "text":
+		case "json":
+			// This also routes everything written with the log package
+			// through the JSON handler.
+			slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+		default:
+			return fmt.Errorf("unknown log format %q", value)
+		}
+		logFormat = value
+		return nil
+	})
+	return flags
+}
+
+// Main entry point for the program/script.
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(os.Stdout)
+		return
+	}
+	for _, cmd := range commands() {
+		if args[0] == cmd.name {
+			cmd.run(cmd.name, args[1:])
+			return
+		}
+	}
+	// Anything else is the original form of the command line, which only
+	// ever rendered.
+	renderCommand("render", args)
+}
+
+// Parse the options shared by render and watch, which need both a config
+// file and an output directory.
+func parseRenderOptions(name string, args []string, extra func(*flag.FlagSet)) *RenderOptions {
+	flags := newFlagSet(name, "[options] in.yaml... outdir")
+	options := &RenderOptions{}
+	options.registerFlags(flags)
+	if extra != nil {
+		extra(flags)
+	}
+	flags.Parse(args)
+	if err := options.takePositional(flags.Args(), true); err != nil {
+		flags.Usage()
+		os.Exit(2)
+	}
+	return options
+}
+
+// Render every layer of every image once.
+func renderCommand(name string, args []string) {
+	options := parseRenderOptions(name, args, nil)
+	trapSignals()
+	render := options.render
+	if options.OutDir == "-" {
+		render = options.renderToStdout
+	}
+	if err := render(); err != nil {
+		fatal("Render failed: ", err)
+	}
+}
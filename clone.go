@@ -0,0 +1,77 @@
+// Add and delete whole elements for a layer, so that repetition slides (the
+// same icon stamped in one more place per layer) can be built from a single
+// source element.
+
+package main
+
+import (
+	"fmt"
+)
+
+// Represent a copy of an element which a layer adds. The copy goes straight
+// after the original, with the transform (if any) applied on top of the
+// original's own.
+type CloneSpec struct {
+	ID string `yaml:"id"`
+	NewID string `yaml:"new_id"`
+	Transform string `yaml:"transform,omitempty"`
+}
+
+// Make the layer's clones and then delete the elements it removes. Like
+// hiding and showing, both carry on into the following layers.
+func (layer *ImageLayer) cloneAndRemove(index *elementIndex) error {
+	for _, spec := range layer.CloneIDs {
+		if err := spec.clone(index); err != nil {
+			return err
+		}
+		index.refresh()
+	}
+	for _, selector := range layer.RemoveIDs {
+		elements, err := index.resolve(selector)
+		if err != nil {
+			return err
+		}
+		for _, element := range elements {
+			if element.Parent() != nil {
+				element.Parent().RemoveChild(element)
+			}
+		}
+		index.refresh()
+	}
+	return nil
+}
+
+// Copy the element into the document under its new ID. IDs inside the copy
+// get the new ID appended, so that they stay unique too.
+func (spec *CloneSpec) clone(index *elementIndex) error {
+	if spec.NewID == "" {
+		return fmt.Errorf("clone of #%s needs a new_id", spec.ID)
+	}
+	element, err := index.findOne(spec.ID)
+	if err != nil {
+		return err
+	}
+	if len(index.ids[spec.NewID]) > 0 {
+		return fmt.Errorf("cannot clone #%s as #%s, which already exists", spec.ID, spec.NewID)
+	}
+
+	if element.Parent() == nil {
+		return fmt.Errorf("cannot clone the root element")
+	}
+	copied := element.Copy()
+	for _, descendant := range copied.FindElements(".//*[@id]") {
+		descendant.CreateAttr("id", descendant.SelectAttrValue("id", "")+"_"+spec.NewID)
+	}
+	copied.CreateAttr("id", spec.NewID)
+	if spec.Transform != "" {
+		transform := spec.Transform
+		if existing := copied.SelectAttrValue("transform", ""); existing != "" {
+			transform += " " + existing
+		}
+		copied.CreateAttr("transform", transform)
+	}
+
+	parent := element.Parent()
+	parent.InsertChildAt(element.Index()+1, copied)
+	return nil
+}
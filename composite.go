@@ -0,0 +1,64 @@
+// Alpha-composite several rendered layers (or external PNG files) into a new
+// output image, for comparison or before/after frames.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// Represent an additional output of an image that is stacked together from
+// other rendered layers and/or external PNG files.
+type Composite struct {
+	Suffix string `yaml:"suffix"`
+	Stack []*CompositeSource `yaml:"stack"`
+}
+
+// Represent one entry in the stack of a composite: either the suffix of a
+// layer on the same image, or the path to an external PNG file (relative to
+// the YAML file).
+type CompositeSource struct {
+	Layer string `yaml:"layer,omitempty"`
+	File string `yaml:"file,omitempty"`
+}
+
+// Stack the sources of the composite from bottom to top, in the order that
+// they were declared, and write the result. The canvas takes the size of the
+// bottom-most source; the others are drawn over it from the top-left corner.
+func (composite *Composite) writeComposite(inDir string, layerPngs map[string]string, outPng string) error {
+	if len(composite.Stack) == 0 {
+		return fmt.Errorf("composite %s has an empty stack", composite.Suffix)
+	}
+
+	var canvas *image.RGBA
+	for _, source := range composite.Stack {
+		var sourcePng string
+		if source.Layer != "" && source.File != "" {
+			return fmt.Errorf("composite %s: stack entry must have either layer or file, not both", composite.Suffix)
+		} else if source.Layer != "" {
+			var ok bool
+			if sourcePng, ok = layerPngs[source.Layer]; !ok {
+				return fmt.Errorf("composite %s: no layer with suffix %s", composite.Suffix, source.Layer)
+			}
+		} else if source.File != "" {
+			sourcePng = resolvePath(inDir, source.File)
+		} else {
+			return fmt.Errorf("composite %s: stack entry needs a layer or a file", composite.Suffix)
+		}
+
+		sourceImg, err := readPNG(sourcePng)
+		if err != nil {
+			return err
+		}
+
+		bounds := sourceImg.Bounds()
+		if canvas == nil {
+			canvas = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		}
+		draw.Draw(canvas, canvas.Bounds(), sourceImg, bounds.Min, draw.Over)
+	}
+
+	return writePNG(outPng, canvas)
+}
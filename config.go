@@ -0,0 +1,386 @@
+// Load the images to render from one or more YAML config files, following
+// any "include:" entries into further files. A config file is either a bare
+// list of images, or a mapping with "images:" and shared "defaults:".
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Expand a config file argument which may be a glob (or "-" for stdin). A pattern which matches
+// nothing is an error rather than silently rendering nothing; a plain
+// filename is returned as-is so that a missing file is reported when read.
+func expandConfigGlob(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("bad config pattern %q: %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		if strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("no config files match %q", pattern)
+		}
+		return []string{pattern}, nil
+	}
+	return matches, nil
+}
+
+// Resolve a path given in a config file, which is relative to the directory
+// of that file (or the image's base_dir) unless it is absolute. A leading ~/
+// stands for the home directory, except in a daemon job (see jobLimits).
+func resolvePath(dir string, name string) string {
+	if rest, ok := strings.CutPrefix(filepath.ToSlash(name), "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, filepath.FromSlash(rest))
+		}
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+// Represent the settings which can be given once in "defaults:" instead of on
+// every image. Anything an image sets itself takes precedence.
+type ConfigDefaults struct {
+	BaseDir string `yaml:"base_dir,omitempty"`
+	Resolution string `yaml:"resolution,omitempty"`
+	Renderer string `yaml:"renderer,omitempty"`
+	NameTemplate string `yaml:"name_template,omitempty"`
+	Background string `yaml:"background,omitempty"`
+	BackgroundID string `yaml:"background_id,omitempty"`
+	BackgroundColor string `yaml:"background_color,omitempty"`
+	Area string `yaml:"area,omitempty"`
+	Formats []string `yaml:"formats,omitempty"`
+	Quality int `yaml:"quality,omitempty"`
+	CrossfadeFrames int `yaml:"crossfade_frames,omitempty"`
+	NumberPadding int `yaml:"number_padding,omitempty"`
+	RendererArgs []string `yaml:"renderer_args,omitempty"`
+	TextToPath bool `yaml:"text_to_path,omitempty"`
+	InlineAssets bool `yaml:"inline_assets,omitempty"`
+	Hooks *Hooks `yaml:"hooks,omitempty"`
+	Overlays []*Overlay `yaml:"overlays,omitempty"`
+	Numbering *SlideNumbering `yaml:"numbering,omitempty"`
+	Variables map[string]string `yaml:"variables,omitempty"`
+	Colors map[string]string `yaml:"colors,omitempty"`
+	BurnCaptions *BurnIn `yaml:"burn_captions,omitempty"`
+	SafeArea string `yaml:"safe_area,omitempty"`
+	Metadata *CardMetadata `yaml:"metadata,omitempty"`
+	TitleCard *Card `yaml:"title_card,omitempty"`
+	EndCard *Card `yaml:"end_card,omitempty"`
+}
+
+// Fill in whatever the image leaves unset from the defaults. Whether the
+// switches and numbers are set goes by the keys of the image's entry, since
+// false and 0 are worth setting to override the defaults with.
+func (defaults *ConfigDefaults) apply(image *Image, entry *yaml.Node) {
+	if image.BaseDir == "" {
+		image.BaseDir = defaults.BaseDir
+	}
+	if image.Resolution == "" {
+		image.Resolution = defaults.Resolution
+	}
+	if image.Renderer == "" {
+		image.Renderer = defaults.Renderer
+	}
+	if image.NameTemplate == "" {
+		image.NameTemplate = defaults.NameTemplate
+	}
+	if image.Background == "" {
+		image.Background = defaults.Background
+	}
+	if image.BackgroundID == "" {
+		image.BackgroundID = defaults.BackgroundID
+	}
+	if image.BackgroundColor == "" {
+		image.BackgroundColor = defaults.BackgroundColor
+	}
+	if image.Area == "" {
+		image.Area = defaults.Area
+	}
+	if image.Formats == nil {
+		image.Formats = slices.Clone(defaults.Formats)
+	}
+	if !mappingHasKey(entry, "quality") {
+		image.Quality = defaults.Quality
+	}
+	if !mappingHasKey(entry, "crossfade_frames") {
+		image.CrossfadeFrames = defaults.CrossfadeFrames
+	}
+	if !mappingHasKey(entry, "number_padding") {
+		image.NumberPadding = defaults.NumberPadding
+	}
+	if image.RendererArgs == nil {
+		image.RendererArgs = slices.Clone(defaults.RendererArgs)
+	}
+	if !mappingHasKey(entry, "text_to_path") {
+		image.TextToPath = defaults.TextToPath
+	}
+	if !mappingHasKey(entry, "inline_assets") {
+		image.InlineAssets = defaults.InlineAssets
+	}
+	if image.Hooks == nil {
+		image.Hooks = defaults.Hooks
+	}
+	for name, value := range defaults.Variables {
+		if _, ok := image.Variables[name]; !ok {
+			if image.Variables == nil {
+				image.Variables = make(map[string]string)
+			}
+			image.Variables[name] = value
+		}
+	}
+	for from, to := range defaults.Colors {
+		if _, ok := image.Colors[from]; !ok {
+			if image.Colors == nil {
+				image.Colors = make(map[string]string)
+			}
+			image.Colors[from] = to
+		}
+	}
+	if image.Numbering == nil {
+		image.Numbering = defaults.Numbering
+	}
+	if image.BurnCaptions == nil {
+		image.BurnCaptions = defaults.BurnCaptions
+	}
+	if image.SafeArea == "" {
+		image.SafeArea = defaults.SafeArea
+	}
+	image.Metadata = image.Metadata.merge(defaults.Metadata)
+	if image.TitleCard == nil {
+		image.TitleCard = defaults.TitleCard
+	}
+	if image.EndCard == nil {
+		image.EndCard = defaults.EndCard
+	}
+	if image.Overlays == nil {
+		// Copied, since each image expands the variables in them itself.
+		for _, overlay := range defaults.Overlays {
+			copied := *overlay
+			image.Overlays = append(image.Overlays, &copied)
+		}
+	}
+}
+
+// Represent the document form of a config file.
+type configFile struct {
+	Defaults yaml.Node `yaml:"defaults"`
+	Images []yaml.Node `yaml:"images"`
+}
+
+// The config read from stdin, which is kept so that it can be loaded again
+// (by watch mode, say) after stdin has been used up.
+var stdinConfig struct {
+	once sync.Once
+	data []byte
+	err error
+}
+
+// Read a config file, where "-" means stdin.
+func readConfig(config string) ([]byte, error) {
+	if config != "-" {
+		return os.ReadFile(config)
+	}
+	stdinConfig.once.Do(func() {
+		stdinConfig.data, stdinConfig.err = io.ReadAll(os.Stdin)
+	})
+	return stdinConfig.data, stdinConfig.err
+}
+
+// Track the config files read so far, so that each is only loaded once even
+// if it is included from several places (or includes itself).
+type configLoader struct {
+	seen map[string]bool
+	files []string
+	images []*Image
+	limits *jobLimits
+}
+
+// Read one config file, appending its images (and those of anything it
+// includes) in the order they appear. The defaults are those of the files
+// which included this one; its own defaults are layered on top of them and
+// passed on to the files it includes in turn.
+func (loader *configLoader) load(config string, inherited ConfigDefaults) error {
+	key, err := filepath.Abs(config)
+	if err != nil {
+		key = config
+	}
+	if loader.seen[key] {
+		return nil
+	}
+	loader.seen[key] = true
+	loader.files = append(loader.files, config)
+
+	yamlBytes, err := readConfig(config)
+	if err != nil {
+		return fmt.Errorf("problem reading file: %w", err)
+	}
+	configHash := fmt.Sprintf("%x", sha256.Sum256(yamlBytes))
+	var doc yaml.Node
+	if err := yaml.Unmarshal(yamlBytes, &doc); err != nil {
+		return fmt.Errorf("problem parsing YAML in %s: %w", config, err)
+	}
+
+	defaults := inherited
+	var entries []*yaml.Node
+	if len(doc.Content) > 0 {
+		switch root := doc.Content[0]; root.Kind {
+		case yaml.SequenceNode:
+			entries = root.Content
+		case yaml.MappingNode:
+			if err := checkKnownFields(root, reflect.TypeOf(configFile{}), "config"); err != nil {
+				return fmt.Errorf("invalid config %s: %w", config, err)
+			}
+			var file configFile
+			if err := root.Decode(&file); err != nil {
+				return fmt.Errorf("problem parsing YAML in %s: %w", config, err)
+			}
+			if file.Defaults.Kind != 0 {
+				if err := checkKnownFields(&file.Defaults, reflect.TypeOf(ConfigDefaults{}), "defaults"); err != nil {
+					return fmt.Errorf("invalid config %s: %w", config, err)
+				}
+				if err := file.Defaults.Decode(&defaults); err != nil {
+					return fmt.Errorf("bad defaults in %s: %w", config, err)
+				}
+			}
+			for i := range file.Images {
+				entries = append(entries, &file.Images[i])
+			}
+		default:
+			return fmt.Errorf("%s should contain a list of images or a mapping with images:", config)
+		}
+	}
+
+	baseDir := filepath.Dir(config)
+	for _, entry := range entries {
+		if isInclude(entry) {
+			patterns, err := includePatterns(entry.Content[1])
+			if err != nil {
+				return fmt.Errorf("bad include in %s line %d: %w", config, entry.Line, err)
+			}
+			for _, pattern := range patterns {
+				pattern = resolvePath(baseDir, pattern)
+				files, err := expandConfigGlob(pattern)
+				if err != nil {
+					return fmt.Errorf("bad include in %s: %w", config, err)
+				}
+				for _, file := range files {
+					if err := loader.limits.checkPath(baseDir, file); err != nil {
+						return fmt.Errorf("bad include in %s: %w", config, err)
+					}
+					if err := loader.load(file, defaults); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+
+		if err := checkKnownFields(entry, reflect.TypeOf(Image{}), "image"); err != nil {
+			return fmt.Errorf("invalid config %s: %w", config, err)
+		}
+		image := &Image{baseDir: baseDir, configFile: config, configHash: configHash, configLine: entry.Line}
+		if err := entry.Decode(image); err != nil {
+			return fmt.Errorf("problem parsing YAML in %s: %w", config, err)
+		}
+		defaults.apply(image, entry)
+		if image.BaseDir != "" {
+			image.baseDir = resolvePath(baseDir, image.BaseDir)
+		}
+		if err := image.expandVariables(config, loader.limits); err != nil {
+			return fmt.Errorf("problem expanding variables in %s: %w", config, err)
+		}
+		if err := loader.limits.checkImage(image); err != nil {
+			return fmt.Errorf("image %s in %s line %d: %w", image.Filename, config, entry.Line, err)
+		}
+		if image.autoLayers {
+			if err := image.deriveLayers(); err != nil {
+				return &InputError{fmt.Errorf("problem deriving the layers in %s line %d: %w", config, entry.Line, err)}
+			}
+		}
+		loader.images = append(loader.images, image)
+	}
+	return nil
+}
+
+// Report whether a mapping key is the "<<" merge key, which pulls in the keys
+// of another mapping (usually an alias) that the mapping doesn't set itself.
+func isMergeKey(key *yaml.Node) bool {
+	return key.Kind == yaml.ScalarNode && key.ShortTag() == "!!merge"
+}
+
+// Report whether a mapping has a key, either itself or through the mappings
+// it merges in.
+func mappingHasKey(node *yaml.Node, name string) bool {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if isMergeKey(key) {
+			merged := []*yaml.Node{value}
+			if value.Kind == yaml.SequenceNode {
+				merged = value.Content
+			}
+			for _, mapping := range merged {
+				if mappingHasKey(mapping, name) {
+					return true
+				}
+			}
+		} else if key.Value == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether a list entry is an include directive rather than an image.
+func isInclude(entry *yaml.Node) bool {
+	return entry.Kind == yaml.MappingNode && len(entry.Content) == 2 && entry.Content[0].Value == "include"
+}
+
+// Decode the files (or globs) named by an include directive, which may be a
+// single string or a list of them.
+func includePatterns(value *yaml.Node) ([]string, error) {
+	var patterns []string
+	if value.Kind == yaml.ScalarNode {
+		patterns = append(patterns, value.Value)
+	} else if err := value.Decode(&patterns); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// Read the images from the given config files (or globs of them), in order,
+// keeping them to the limits of a daemon job if there are any. Also returns
+// every config file that was read, including the ones that were included
+// from others.
+func loadImages(configs []string, limits *jobLimits) ([]*Image, []string, error) {
+	loader := &configLoader{seen: make(map[string]bool), limits: limits}
+	for _, pattern := range configs {
+		files, err := expandConfigGlob(pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, file := range files {
+			if err := loader.load(file, ConfigDefaults{}); err != nil {
+				return nil, loader.files, err
+			}
+		}
+	}
+	return loader.images, loader.files, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	config := `defaults:
+  text_to_path: true
+  inline_assets: true
+  crossfade_frames: 4
+  quality: 70
+  number_padding: 3
+x-plain: &plain
+  text_to_path: false
+images:
+  - filename: inherits.svg
+    layers: [{suffix: _a}]
+  - filename: overrides.svg
+    text_to_path: false
+    inline_assets: false
+    crossfade_frames: 0
+    quality: 0
+    number_padding: 0
+    layers: [{suffix: _a}]
+  - filename: merges.svg
+    <<: *plain
+    layers: [{suffix: _a}]
+`
+	file := filepath.Join(t.TempDir(), "deck.yaml")
+	if err := os.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	images, _, err := loadImages([]string{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type settings struct {
+		textToPath bool
+		inlineAssets bool
+		crossfadeFrames int
+		quality int
+		numberPadding int
+	}
+	want := map[string]settings{
+		"inherits.svg": {true, true, 4, 70, 3},
+		"overrides.svg": {false, false, 0, 0, 0},
+		"merges.svg": {false, true, 4, 70, 3},
+	}
+	for _, image := range images {
+		got := settings{image.TextToPath, image.InlineAssets, image.CrossfadeFrames, image.Quality, image.NumberPadding}
+		if got != want[image.Filename] {
+			t.Errorf("%s: settings %+v, want %+v", image.Filename, got, want[image.Filename])
+		}
+	}
+}
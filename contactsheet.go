@@ -0,0 +1,121 @@
+// Lay out thumbnails of every slide on grid images, so that a whole deck can
+// be reviewed at a glance instead of one file at a time.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"strings"
+)
+
+// Spacing around the thumbnails, in pixels, and the scale of their labels.
+const (
+	sheetPadding = 12
+	sheetLabelScale = 2
+)
+
+var sheetBackground = color.RGBA{R: 0x20, G: 0x20, B: 0x20, A: 0xff}
+var sheetInk = color.RGBA{R: 0xf0, G: 0xf0, B: 0xf0, A: 0xff}
+
+// Scale an image down to the given width, keeping its aspect ratio, by
+// averaging each block of source pixels which lands on a thumbnail pixel.
+func thumbnail(src image.Image, width int) *image.RGBA {
+	bounds := src.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return image.NewRGBA(image.Rect(0, 0, width, 0))
+	}
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// Compose one sheet from the given slides.
+func contactSheet(slides []*Slide, columns int, thumbWidth int) (*image.RGBA, error) {
+	var thumbs []*image.RGBA
+	cellHeight := 0
+	for _, slide := range slides {
+		img, err := readPNG(slide.PngFile)
+		if err != nil {
+			return nil, err
+		}
+		thumb := thumbnail(img, thumbWidth)
+		thumbs = append(thumbs, thumb)
+		cellHeight = max(cellHeight, thumb.Bounds().Dy())
+	}
+
+	_, labelHeight := textSize("", sheetLabelScale)
+	rowHeight := cellHeight + labelHeight + sheetPadding/2
+	columns = min(columns, len(slides))
+	rows := (len(slides) + columns - 1) / columns
+	sheet := image.NewRGBA(image.Rect(0, 0,
+		sheetPadding+columns*(thumbWidth+sheetPadding),
+		sheetPadding+rows*(rowHeight+sheetPadding)))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(sheetBackground), image.Point{}, draw.Src)
+
+	for i, thumb := range thumbs {
+		x := sheetPadding + (i%columns)*(thumbWidth+sheetPadding)
+		y := sheetPadding + (i/columns)*(rowHeight+sheetPadding)
+		// Transparent slides are shown against white, as they would be on a
+		// typical page or player.
+		cell := image.Rect(x, y, x+thumbWidth, y+thumb.Bounds().Dy())
+		draw.Draw(sheet, cell, image.White, image.Point{}, draw.Src)
+		draw.Draw(sheet, cell, thumb, image.Point{}, draw.Over)
+
+		label := strings.TrimSuffix(filepath.Base(slides[i].PngFile), filepath.Ext(slides[i].PngFile))
+		label = fitText(fmt.Sprintf("%d %s", i+1, label), thumbWidth, sheetLabelScale)
+		drawText(sheet, x, y+cellHeight+sheetPadding/2, label, sheetLabelScale, sheetInk)
+	}
+	return sheet, nil
+}
+
+// Write contact sheets for the slides into the output directory, with at most
+// perSheet slides on each (0 for all on one). Returns the files written.
+func writeContactSheets(outDir string, slides []*Slide, columns int, thumbWidth int, perSheet int) ([]string, error) {
+	if len(slides) == 0 {
+		return nil, nil
+	}
+	if columns <= 0 {
+		return nil, fmt.Errorf("contact sheets need at least one column")
+	}
+	if perSheet <= 0 {
+		perSheet = len(slides)
+	}
+
+	var files []string
+	sheets := (len(slides) + perSheet - 1) / perSheet
+	for start := 0; start < len(slides); start += perSheet {
+		sheet, err := contactSheet(slides[start:min(start+perSheet, len(slides))], columns, thumbWidth)
+		if err != nil {
+			return files, err
+		}
+		file := filepath.Join(outDir, "contact_sheet.png")
+		if sheets > 1 {
+			file = filepath.Join(outDir, fmt.Sprintf("contact_sheet_%02d.png", len(files)+1))
+		}
+		if err := writePNG(file, sheet); err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
@@ -0,0 +1,153 @@
+// Convert the rendered PNG files into other raster formats, for players and
+// platforms which want something other than PNG.
+
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"os/exec"
+)
+
+// The quality used for lossy formats when an image doesn't specify one.
+const defaultQuality = 90
+
+// The file extension used for each raster format other than PNG.
+var rasterExtensions = map[string]string{
+	"jpeg": ".jpg",
+	"webp": ".webp",
+	"tiff": ".tiff",
+}
+
+// Accept the common spellings of the format names.
+func canonicalFormat(format string) string {
+	switch format {
+	case "jpg":
+		return "jpeg"
+	case "tif":
+		return "tiff"
+	}
+	return format
+}
+
+// Write a copy of the PNG file in another raster format, next to the PNG and
+// with the same base name. Returns the name of the new file.
+func convertRaster(pngFile string, format string, quality int) (string, error) {
+	ext, ok := rasterExtensions[format]
+	if !ok {
+		return "", fmt.Errorf("cannot convert to %s", format)
+	}
+	outFile := pngFile[0:(len(pngFile) - 4)] + ext
+
+	// WebP has no encoder in the standard library, so lean on cwebp.
+	if format == "webp" {
+		cwebp, err := exec.LookPath("cwebp")
+		if err != nil {
+			return "", fmt.Errorf("cwebp is needed for WebP output: %w", err)
+		}
+		cmd := exec.Command(cwebp, "-quiet", "-q", fmt.Sprint(quality), pngFile, "-o", outFile)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("cwebp failed on %s: %w: %s", pngFile, err, bytes.TrimSpace(output))
+		}
+		return outFile, nil
+	}
+
+	img, err := readPNG(pngFile)
+	if err != nil {
+		return "", err
+	}
+
+	var data bytes.Buffer
+	switch format {
+	case "jpeg":
+		// JPEG has no alpha channel, so flatten onto white first.
+		flat := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		err = jpeg.Encode(&data, flat, &jpeg.Options{Quality: quality})
+	case "tiff":
+		err = encodeTIFF(&data, img)
+	}
+	if err != nil {
+		return "", fmt.Errorf("encoding %s: %w", outFile, err)
+	}
+	return outFile, os.WriteFile(outFile, data.Bytes(), 0644)
+}
+
+// Encode a baseline little-endian RGBA TIFF as a single deflate-compressed
+// strip, which is all that the standard library lacks for writing TIFFs.
+func encodeTIFF(buf *bytes.Buffer, img image.Image) error {
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+
+	var strip bytes.Buffer
+	zipper := zlib.NewWriter(&strip)
+	if _, err := zipper.Write(nrgba.Pix); err != nil {
+		return err
+	}
+	if err := zipper.Close(); err != nil {
+		return err
+	}
+
+	const (
+		typeShort = 3
+		typeLong = 4
+		numEntries = 12
+	)
+	// Layout: 8 byte header, then the IFD, then the BitsPerSample values,
+	// then the strip itself.
+	ifdOffset := uint32(8)
+	bitsOffset := ifdOffset + 2 + numEntries*12 + 4
+	stripOffset := bitsOffset + 8
+
+	type entry struct {
+		tag uint16
+		kind uint16
+		count uint32
+		value uint32
+	}
+	entries := []entry{
+		{256, typeLong, 1, uint32(bounds.Dx())}, // ImageWidth
+		{257, typeLong, 1, uint32(bounds.Dy())}, // ImageLength
+		{258, typeShort, 4, bitsOffset}, // BitsPerSample
+		{259, typeShort, 1, 8}, // Compression: Adobe deflate
+		{262, typeShort, 1, 2}, // PhotometricInterpretation: RGB
+		{273, typeLong, 1, stripOffset}, // StripOffsets
+		{277, typeShort, 1, 4}, // SamplesPerPixel
+		{278, typeLong, 1, uint32(bounds.Dy())}, // RowsPerStrip
+		{279, typeLong, 1, uint32(strip.Len())}, // StripByteCounts
+		{284, typeShort, 1, 1}, // PlanarConfiguration: chunky
+		{317, typeShort, 1, 1}, // Predictor: none
+		{338, typeShort, 1, 2}, // ExtraSamples: unassociated alpha
+	}
+
+	le := binary.LittleEndian
+	buf.WriteString("II")
+	binary.Write(buf, le, uint16(42))
+	binary.Write(buf, le, ifdOffset)
+	binary.Write(buf, le, uint16(len(entries)))
+	for _, e := range entries {
+		binary.Write(buf, le, e.tag)
+		binary.Write(buf, le, e.kind)
+		binary.Write(buf, le, e.count)
+		if e.kind == typeShort && e.count == 1 {
+			// Short values are left-justified in the 4-byte value field.
+			binary.Write(buf, le, uint16(e.value))
+			binary.Write(buf, le, uint16(0))
+		} else {
+			binary.Write(buf, le, e.value)
+		}
+	}
+	binary.Write(buf, le, uint32(0))
+	binary.Write(buf, le, []uint16{8, 8, 8, 8})
+	buf.Write(strip.Bytes())
+	return nil
+}
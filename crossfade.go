@@ -0,0 +1,53 @@
+// Generate blended transition frames between consecutive layers of an image,
+// so that the rendered stills can be dropped into a timeline with a smooth
+// crossfade already baked in.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Produce the given number of intermediate frames which fade from the "from"
+// PNG into the "to" PNG. The frames are written next to the "from" PNG with
+// an _xfadeNN suffix, so that they sort between the two layers by name.
+// Returns the names of the frames which were written.
+func writeCrossfade(fromPng string, toPng string, frames int) ([]string, error) {
+	fromImg, err := readPNG(fromPng)
+	if err != nil {
+		return nil, err
+	}
+	toImg, err := readPNG(toPng)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := fromImg.Bounds()
+	if bounds.Size() != toImg.Bounds().Size() {
+		return nil, fmt.Errorf("cannot crossfade %s (%v) into %s (%v): sizes differ",
+			fromPng, bounds.Size(), toPng, toImg.Bounds().Size())
+	}
+
+	var outPngs []string
+	prefix := fromPng[0:(len(fromPng) - 4)]
+	for frame := 1; frame <= frames; frame++ {
+		// Spread the frames evenly strictly between the two layers, so that
+		// neither endpoint is duplicated.
+		alpha := uint8(255 * frame / (frames + 1))
+
+		blended := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(blended, blended.Bounds(), fromImg, bounds.Min, draw.Src)
+		draw.DrawMask(blended, blended.Bounds(), toImg, toImg.Bounds().Min,
+			image.NewUniform(color.Alpha{A: alpha}), image.Point{}, draw.Over)
+
+		outPng := fmt.Sprintf("%s_xfade%02d.png", prefix, frame)
+		if err := writePNG(outPng, blended); err != nil {
+			return nil, err
+		}
+		outPngs = append(outPngs, outPng)
+	}
+	return outPngs, nil
+}
@@ -0,0 +1,449 @@
+// Run as a shared render service: configs and their SVGs are submitted over
+// HTTP, queued, rendered one job at a time per worker, and the outputs are
+// fetched back once the job is done.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Represent one submitted render and how it is getting on.
+type Job struct {
+	ID string `json:"id"`
+	Status string `json:"status"`
+	Error string `json:"error,omitempty"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Outputs []string `json:"outputs,omitempty"`
+
+	config string
+	dir string
+}
+
+// Hold the queue of jobs and everything known about them.
+type renderDaemon struct {
+	mutex sync.Mutex
+	jobs map[string]*Job
+	queue chan *Job
+	workDir string
+	options RenderOptions
+	maxUpload int64
+	allowHooks bool
+	allowRemote bool
+}
+
+// Represent what the daemon lets the config of a job do, since it comes from
+// whoever can reach the API: hooks and command transforms run shell commands
+// on the host, and renderer arguments can have the renderer write files
+// anywhere, so they are refused unless the daemon is started with
+// --allow-hooks, and every file the config and its SVGs refer to has to be
+// one of those uploaded with the job, since what it reads may end up in the
+// outputs which are fetched back. Remote files are refused too unless the
+// daemon is started with --allow-remote, since they are fetched from wherever
+// the daemon can reach; even then they are fetched without its credentials.
+type jobLimits struct {
+	allowHooks bool
+	allowRemote bool
+	dir string
+}
+
+// Report whether a path is inside a directory, going by their names alone.
+func insideDir(dir string, name string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	if name, err = filepath.Abs(name); err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, name)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// Check that a file the config refers to, resolved against dir as the config
+// would be, is one of the job's own. A ~/ path is refused outright, since the
+// home directory is the daemon's rather than that of whoever submitted the
+// job.
+func (limits *jobLimits) checkPath(dir string, name string) error {
+	if limits == nil || name == "" {
+		return nil
+	}
+	if isRemote(name) {
+		if !limits.allowRemote {
+			return fmt.Errorf("%s is remote, which only a daemon started with --allow-remote fetches", name)
+		}
+		return nil
+	}
+	if strings.HasPrefix(filepath.ToSlash(name), "~/") {
+		return fmt.Errorf("%s is in the home directory, which daemon jobs can't use", name)
+	}
+	if !insideDir(limits.dir, resolvePath(dir, name)) {
+		return fmt.Errorf("%s is outside the files uploaded with the job", name)
+	}
+	return nil
+}
+
+// Check that every file an element and everything inside it link to, with
+// relative links resolved against dir, is one of the job's own, or a remote
+// one if those are allowed.
+func (limits *jobLimits) checkLinks(root *etree.Element, dir string) error {
+	if limits == nil || root == nil {
+		return nil
+	}
+	var outside []string
+	for _, ref := range linkedFiles(root) {
+		ok := !isAssetRef(ref) || insideDir(limits.dir, assetPath(dir, ref))
+		if isRemote(strings.TrimSpace(ref)) {
+			ok = limits.allowRemote
+		}
+		if !ok && !slices.Contains(outside, ref) {
+			outside = append(outside, ref)
+		}
+	}
+	if len(outside) > 0 {
+		return fmt.Errorf("links to files outside those uploaded with the job: %s", strings.Join(outside, ", "))
+	}
+	return nil
+}
+
+// Check an image of a job's config against the limits. Anything goes when
+// there are none.
+func (limits *jobLimits) checkImage(image *Image) error {
+	if limits == nil {
+		return nil
+	}
+	names := []string{image.Filename, image.Subtitles}
+	for _, overlay := range image.Overlays {
+		names = append(names, overlay.File)
+	}
+	for _, layer := range image.Layers {
+		names = append(names, layer.Audio)
+		for _, overlay := range layer.Overlays {
+			names = append(names, overlay.File)
+		}
+	}
+	for _, composite := range image.Composites {
+		for _, source := range composite.Stack {
+			names = append(names, source.File)
+		}
+	}
+	for _, card := range image.cards() {
+		names = append(names, card.Template)
+	}
+	for _, name := range names {
+		if err := limits.checkPath(image.baseDir, name); err != nil {
+			return err
+		}
+	}
+
+	if limits.allowHooks {
+		return nil
+	}
+	if hooks := image.Hooks; hooks != nil && len(hooks.PreLayer)+len(hooks.PostLayer)+len(hooks.PostRun) > 0 {
+		return fmt.Errorf("hooks are only run by a daemon started with --allow-hooks")
+	}
+	if len(image.RendererArgs) > 0 {
+		return fmt.Errorf("renderer_args are only passed on by a daemon started with --allow-hooks")
+	}
+	specs := image.Transforms
+	for _, layer := range image.Layers {
+		specs = append(slices.Clip(specs), layer.Transforms...)
+	}
+	for _, spec := range specs {
+		if spec.Command != "" {
+			return fmt.Errorf("command transforms are only run by a daemon started with --allow-hooks")
+		}
+	}
+	return nil
+}
+
+// Make a random job ID.
+func newJobID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Write a value as the JSON response.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+// Take a snapshot of a job, safe to encode while workers carry on.
+func (daemon *renderDaemon) snapshot(id string) (Job, bool) {
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+	job, ok := daemon.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Accept a job as a multipart form. Every file part is saved under its field
+// name, which is its path relative to the config; the "config" field names
+// the config file (config.yaml by default).
+func (daemon *renderDaemon) submit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, daemon.maxUpload)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "expected a multipart form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job := &Job{ID: newJobID(), Status: "queued", SubmittedAt: time.Now(), config: "config.yaml"}
+	job.dir = filepath.Join(daemon.workDir, job.ID)
+	inDir := filepath.Join(job.dir, "in")
+	fail := func(status int, message string) {
+		os.RemoveAll(job.dir)
+		http.Error(w, message, status)
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			fail(http.StatusBadRequest, "problem reading form: "+err.Error())
+			return
+		}
+		name := part.FormName()
+		if part.FileName() == "" {
+			if name == "config" {
+				value, _ := io.ReadAll(part)
+				job.config = string(value)
+			}
+			continue
+		}
+		if !filepath.IsLocal(name) {
+			fail(http.StatusBadRequest, fmt.Sprintf("file path %q must be relative and stay inside the job", name))
+			return
+		}
+		file := filepath.Join(inDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		out, err := os.Create(file)
+		if err == nil {
+			_, err = io.Copy(out, part)
+			out.Close()
+		}
+		if err != nil {
+			fail(http.StatusBadRequest, "problem saving "+name+": "+err.Error())
+			return
+		}
+	}
+	if !filepath.IsLocal(job.config) {
+		fail(http.StatusBadRequest, "config must be a relative path")
+		return
+	}
+	if _, err := os.Stat(filepath.Join(inDir, job.config)); err != nil {
+		fail(http.StatusBadRequest, fmt.Sprintf("config %s was not uploaded", job.config))
+		return
+	}
+
+	daemon.mutex.Lock()
+	daemon.jobs[job.ID] = job
+	daemon.mutex.Unlock()
+	select {
+	case daemon.queue <- job:
+	default:
+		daemon.finish(job, fmt.Errorf("the queue is full"))
+		writeJSON(w, http.StatusServiceUnavailable, job)
+		return
+	}
+	infof("Queued job %s\n", job.ID)
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	snapshot, _ := daemon.snapshot(job.ID)
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+// Record the end of a job, along with the files it produced.
+func (daemon *renderDaemon) finish(job *Job, err error) {
+	outputs, _ := listFiles(filepath.Join(job.dir, "out"))
+	now := time.Now()
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+	job.FinishedAt = &now
+	job.Outputs = outputs
+	if err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+	} else {
+		job.Status = "done"
+	}
+}
+
+// List the files under a directory, relative to it and with forward slashes.
+// The lock of a run under way isn't one of them.
+func listFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || entry.Name() == lockFileName {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err == nil {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	slices.Sort(files)
+	return files, err
+}
+
+// Take jobs off the queue and render them, until the queue is closed.
+func (daemon *renderDaemon) work() {
+	for job := range daemon.queue {
+		if isInterrupted() {
+			daemon.finish(job, errInterrupted)
+			continue
+		}
+		now := time.Now()
+		daemon.mutex.Lock()
+		job.Status = "running"
+		job.StartedAt = &now
+		daemon.mutex.Unlock()
+
+		options := daemon.options
+		options.Configs = []string{filepath.Join(job.dir, "in", job.config)}
+		options.OutDir = filepath.Join(job.dir, "out")
+		options.Mkdir = true
+		options.KeepGoing = true
+		options.Progress = false
+		options.Report = filepath.Join(options.OutDir, "report.json")
+		options.limits = &jobLimits{allowHooks: daemon.allowHooks, allowRemote: daemon.allowRemote, dir: filepath.Join(job.dir, "in")}
+		_, err := options.renderSlides()
+		daemon.finish(job, err)
+		infof("Finished job %s: %s\n", job.ID, job.Status)
+	}
+}
+
+// Build the HTTP routes for the daemon:
+//
+//	POST   /jobs                   submit a job (multipart form)
+//	GET    /jobs                   list every job
+//	GET    /jobs/{id}              the status of a job
+//	GET    /jobs/{id}/files/{path} fetch one of a job's outputs
+//	DELETE /jobs/{id}              remove a finished job and its files
+func (daemon *renderDaemon) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", daemon.submit)
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		daemon.mutex.Lock()
+		jobs := []Job{}
+		for _, job := range daemon.jobs {
+			jobs = append(jobs, *job)
+		}
+		daemon.mutex.Unlock()
+		slices.SortFunc(jobs, func(a, b Job) int { return a.SubmittedAt.Compare(b.SubmittedAt) })
+		writeJSON(w, http.StatusOK, jobs)
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := daemon.snapshot(r.PathValue("id"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})
+	mux.HandleFunc("GET /jobs/{id}/files/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := daemon.snapshot(r.PathValue("id"))
+		path := r.PathValue("path")
+		if !ok || !slices.Contains(job.Outputs, path) {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join(job.dir, "out", filepath.FromSlash(path)))
+	})
+	mux.HandleFunc("DELETE /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		daemon.mutex.Lock()
+		job, ok := daemon.jobs[r.PathValue("id")]
+		if ok && (job.Status == "queued" || job.Status == "running") {
+			daemon.mutex.Unlock()
+			http.Error(w, "job has not finished", http.StatusConflict)
+			return
+		}
+		delete(daemon.jobs, r.PathValue("id"))
+		daemon.mutex.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		os.RemoveAll(job.dir)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+// Entry point for "bulletpointer daemon". The render options given on the
+// command line apply to every job, except for the paths which each job has
+// to itself.
+func daemonCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options]")
+	daemon := &renderDaemon{jobs: make(map[string]*Job)}
+	daemon.options.registerFlags(flags)
+	listen := flags.String("listen", "localhost:8080", "the address to serve the API on")
+	flags.StringVar(&daemon.workDir, "work-dir", "", "where jobs' inputs and outputs are kept (default: a temporary dir)")
+	workers := flags.Int("workers", 1, "how many jobs to render at once")
+	queueSize := flags.Int("queue-size", 100, "how many jobs may wait before new ones are refused")
+	flags.Int64Var(&daemon.maxUpload, "max-upload", 256<<20, "the largest job upload accepted, in bytes")
+	flags.BoolVar(&daemon.allowHooks, "allow-hooks", false, "run the hooks and command transforms and pass on the renderer_args of submitted configs, which can run any command on this machine")
+	flags.BoolVar(&daemon.allowRemote, "allow-remote", false, "fetch the http(s):// and s3:// files which submitted configs and their SVGs refer to, from anywhere this machine can reach")
+	flags.Parse(args)
+	if flags.NArg() != 0 || *workers < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if daemon.workDir == "" {
+		workDir, err := os.MkdirTemp("", "bulletpointer-daemon-")
+		if err != nil {
+			log.Fatalf("Could not create work dir: %s\n", err.Error())
+		}
+		defer os.RemoveAll(workDir)
+		daemon.workDir = workDir
+	} else if err := os.MkdirAll(daemon.workDir, 0755); err != nil {
+		log.Fatalf("Could not create work dir: %s\n", err.Error())
+	}
+
+	trapSignals()
+	daemon.queue = make(chan *Job, *queueSize)
+	var working sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		working.Add(1)
+		go func() {
+			defer working.Done()
+			daemon.work()
+		}()
+	}
+	infof("Serving the render API on http://%s/jobs (work dir %s)\n", *listen, daemon.workDir)
+	if err := serveUntilInterrupted(&http.Server{Addr: *listen, Handler: daemon.routes()}); err != nil {
+		log.Fatalf("Could not serve the API: %s\n", err.Error())
+	}
+	// Nothing can be submitted any more, so the jobs still queued are
+	// failed and those under way stopped before the work dir goes.
+	close(daemon.queue)
+	working.Wait()
+}
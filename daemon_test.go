@@ -0,0 +1,197 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+// Load a config from a job's directory, as a daemon worker would.
+func loadJobConfig(t *testing.T, limits *jobLimits, config string) ([]*Image, error) {
+	t.Helper()
+	file := filepath.Join(limits.dir, "config.yaml")
+	if err := os.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	images, _, err := loadImages([]string{file}, limits)
+	return images, err
+}
+
+func TestJobLimitsConfig(t *testing.T) {
+	t.Setenv("BP_TEST_SECRET", "hunter2")
+	outside := filepath.Join(t.TempDir(), "elsewhere.svg")
+	tests := []struct {
+		name string
+		config string
+		allowHooks bool
+		allowRemote bool
+		err string
+	}{
+		{
+			name: "the job's own files",
+			config: "- filename: deck.svg\n  subtitles: sub/narration.srt\n  overlays: [{file: logo.svg}]\n  layers: [{suffix: _a, audio: a.wav}]\n",
+		},
+		{
+			name: "built-in variables",
+			config: "- filename: ${CONFIG_DIR}/deck.svg\n  layers: [{suffix: _a, title: \"${CONFIG_NAME}\"}]\n",
+		},
+		{
+			name: "a parent directory",
+			config: "- filename: ../deck.svg\n  layers: [{suffix: _a}]\n",
+			err: "../deck.svg is outside the files uploaded with the job",
+		},
+		{
+			name: "a way out through base_dir",
+			config: "- filename: deck.svg\n  base_dir: sub/../..\n  layers: [{suffix: _a}]\n",
+			err: "deck.svg is outside the files uploaded with the job",
+		},
+		{
+			name: "an absolute path",
+			config: "- filename: " + outside + "\n  layers: [{suffix: _a}]\n",
+			err: outside + " is outside the files uploaded with the job",
+		},
+		{
+			name: "a layer's overlay",
+			config: "- filename: deck.svg\n  layers: [{suffix: _a, overlays: [{file: /etc/passwd}]}]\n",
+			err: "/etc/passwd is outside the files uploaded with the job",
+		},
+		{
+			name: "a composite's file",
+			config: "- filename: deck.svg\n  layers: [{suffix: _a}]\n  composites: [{suffix: _c, stack: [{file: ../x.png}]}]\n",
+			err: "../x.png is outside the files uploaded with the job",
+		},
+		{
+			name: "an include",
+			config: "- include: ../other.yaml\n",
+			err: "is outside the files uploaded with the job",
+		},
+		{
+			name: "the home directory",
+			config: "- filename: ~/deck.svg\n  layers: [{suffix: _a}]\n",
+			err: "~/deck.svg is in the home directory, which daemon jobs can't use",
+		},
+		{
+			name: "the home directory from the environment",
+			config: "- filename: ${HOME}/deck.svg\n  layers: [{suffix: _a}]\n",
+			err: "undefined variable HOME",
+		},
+		{
+			name: "a secret from the environment",
+			config: "- filename: deck.svg\n  layers: [{suffix: _a, notes: \"${BP_TEST_SECRET}\"}]\n",
+			err: "undefined variable BP_TEST_SECRET",
+		},
+		{
+			name: "a remote file",
+			config: "- filename: https://169.254.169.254/deck.svg\n  layers: [{suffix: _a}]\n",
+			err: "https://169.254.169.254/deck.svg is remote, which only a daemon started with --allow-remote fetches",
+		},
+		{
+			name: "a remote file when allowed",
+			config: "- filename: s3://bucket/deck.svg\n  layers: [{suffix: _a}]\n",
+			allowRemote: true,
+		},
+		{
+			name: "renderer_args",
+			config: "- filename: deck.svg\n  renderer_args: [--export-filename=/tmp/x.svg]\n  layers: [{suffix: _a}]\n",
+			err: "renderer_args are only passed on by a daemon started with --allow-hooks",
+		},
+		{
+			name: "renderer_args from the defaults",
+			config: "defaults:\n  renderer_args: [--actions=quit]\nimages:\n  - filename: deck.svg\n    layers: [{suffix: _a}]\n",
+			err: "renderer_args are only passed on by a daemon started with --allow-hooks",
+		},
+		{
+			name: "hooks",
+			config: "- filename: deck.svg\n  hooks: {post_run: [touch /tmp/x]}\n  layers: [{suffix: _a}]\n",
+			err: "hooks are only run by a daemon started with --allow-hooks",
+		},
+		{
+			name: "a command transform",
+			config: "- filename: deck.svg\n  layers: [{suffix: _a, transforms: [{command: sh -c true}]}]\n",
+			err: "command transforms are only run by a daemon started with --allow-hooks",
+		},
+		{
+			name: "hooks, transforms and renderer_args when allowed",
+			config: "- filename: deck.svg\n  hooks: {post_run: [\"true\"]}\n  renderer_args: [--export-dpi=96]\n  transforms: [{command: cat}]\n  layers: [{suffix: _a}]\n",
+			allowHooks: true,
+		},
+	}
+	for _, test := range tests {
+		limits := &jobLimits{allowHooks: test.allowHooks, allowRemote: test.allowRemote, dir: filepath.Join(t.TempDir(), "in")}
+		if err := os.MkdirAll(limits.dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadJobConfig(t, limits, test.config)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: error = %v", test.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: error = %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestJobLimitsDefaultedVariables(t *testing.T) {
+	t.Setenv("BP_TEST_SECRET", "hunter2")
+	limits := &jobLimits{dir: t.TempDir()}
+	images, err := loadJobConfig(t, limits, "- filename: deck.svg\n  layers: [{suffix: _a, title: \"${BP_TEST_SECRET:-none}\"}]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := images[0].Layers[0].Title; title != "none" {
+		t.Errorf("title = %q, want the default rather than the environment", title)
+	}
+}
+
+func TestJobLimitsCheckLinks(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		svg string
+		allowRemote bool
+		err string
+	}{
+		{svg: `<image href="img/photo.png"/>`},
+		{svg: `<image xlink:href="file://` + filepath.Join(dir, "photo.png") + `"/>`},
+		{svg: `<use href="#logo"/><a href="https://example.com/">link</a>`},
+		{svg: `<image href="data:image/png;base64,AAAA"/>`},
+		{svg: `<image href="../photo.png"/>`, err: "../photo.png"},
+		{svg: `<image xlink:href="/etc/passwd"/>`, err: "/etc/passwd"},
+		{svg: `<image href="file:///etc/passwd"/>`, err: "file:///etc/passwd"},
+		{svg: `<g style="fill:url(#grad)"/><style>@font-face { src: url("../font.ttf") }</style>`, err: "../font.ttf"},
+		{svg: `<rect style="fill:url(/tmp/x.svg#p)"/>`, err: "/tmp/x.svg#p"},
+		{svg: `<image href="http://169.254.169.254/latest"/>`, err: "http://169.254.169.254/latest"},
+		{svg: `<image href="s3://bucket/key.png"/>`, err: "s3://bucket/key.png"},
+		{svg: `<image href="s3://bucket/key.png"/>`, allowRemote: true},
+	}
+	for _, test := range tests {
+		doc := etree.NewDocument()
+		svg := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">` + test.svg + `</svg>`
+		if err := doc.ReadFromString(svg); err != nil {
+			t.Fatal(err)
+		}
+		limits := &jobLimits{allowRemote: test.allowRemote, dir: dir}
+		err := limits.checkLinks(doc.Root(), dir)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("checkLinks(%s) error = %v", test.svg, err)
+			}
+		} else if err == nil || !strings.HasSuffix(err.Error(), ": "+test.err) {
+			t.Errorf("checkLinks(%s) error = %v, want it to name %s", test.svg, err, test.err)
+		}
+	}
+}
+
+func TestJobLimitsNone(t *testing.T) {
+	var limits *jobLimits
+	image := &Image{Filename: "/etc/passwd", RendererArgs: []string{"--actions=quit"}, Hooks: &Hooks{PostRun: []string{"true"}}}
+	if err := limits.checkImage(image); err != nil {
+		t.Errorf("checkImage without limits error = %v", err)
+	}
+	if err := limits.checkPath("", "https://example.com/deck.svg"); err != nil {
+		t.Errorf("checkPath without limits error = %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+// Compare two directories of rendered slides pixel by pixel, to check that a
+// change to the artwork (or the tool) didn't change what any slide looks like.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Represent the result of comparing one slide between the two directories.
+type slideDiff struct {
+	Name string
+	Status string
+	Percent float64
+}
+
+// List the PNG files under a directory, relative to it.
+func listPNGs(dir string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(path), ".png") {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			names = append(names, rel)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// Report whether two colors differ by more than the tolerance in any channel
+// (on the 0-255 scale).
+func colorsDiffer(a color.Color, b color.Color, tolerance int) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	for _, pair := range [][2]uint32{{ar, br}, {ag, bg}, {ab, bb}, {aa, ba}} {
+		delta := int(pair[0]>>8) - int(pair[1]>>8)
+		if delta > tolerance || -delta > tolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare two images of the same size, returning the percentage of pixels
+// which differ and an image showing where: the new image faded to grey, with
+// the changed pixels in red.
+func compareImages(oldImg image.Image, newImg image.Image, tolerance int) (float64, *image.RGBA) {
+	bounds := newImg.Bounds()
+	visual := image.NewRGBA(bounds)
+	changed := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			oldPixel := oldImg.At(x-bounds.Min.X+oldImg.Bounds().Min.X, y-bounds.Min.Y+oldImg.Bounds().Min.Y)
+			newPixel := newImg.At(x, y)
+			if colorsDiffer(oldPixel, newPixel, tolerance) {
+				changed++
+				visual.Set(x, y, color.RGBA{R: 255, A: 255})
+				continue
+			}
+			grey := color.GrayModel.Convert(newPixel).(color.Gray)
+			faded := 192 + grey.Y/4
+			visual.Set(x, y, color.RGBA{R: faded, G: faded, B: faded, A: 255})
+		}
+	}
+	total := bounds.Dx() * bounds.Dy()
+	if total == 0 {
+		return 0, visual
+	}
+	return 100 * float64(changed) / float64(total), visual
+}
+
+// Compare one slide which exists in both directories, writing a visual diff
+// into diffDir (if given) when it has changed.
+func diffSlide(oldDir string, newDir string, name string, tolerance int, diffDir string) (*slideDiff, error) {
+	oldImg, err := readPNG(filepath.Join(oldDir, name))
+	if err != nil {
+		return nil, err
+	}
+	newImg, err := readPNG(filepath.Join(newDir, name))
+	if err != nil {
+		return nil, err
+	}
+	if oldImg.Bounds().Size() != newImg.Bounds().Size() {
+		return &slideDiff{Name: name, Status: fmt.Sprintf("resized %dx%d -> %dx%d",
+			oldImg.Bounds().Dx(), oldImg.Bounds().Dy(), newImg.Bounds().Dx(), newImg.Bounds().Dy()), Percent: 100}, nil
+	}
+
+	percent, visual := compareImages(oldImg, newImg, tolerance)
+	if percent == 0 {
+		return &slideDiff{Name: name, Status: "same"}, nil
+	}
+	if diffDir != "" {
+		diffFile := filepath.Join(diffDir, name)
+		if err := os.MkdirAll(filepath.Dir(diffFile), 0755); err != nil {
+			return nil, err
+		}
+		if err := writePNG(diffFile, visual); err != nil {
+			return nil, err
+		}
+	}
+	return &slideDiff{Name: name, Status: "changed", Percent: percent}, nil
+}
+
+// Compare every slide between two directories, in name order. Slides only in
+// one of them are reported as added or removed.
+func diffDirs(oldDir string, newDir string, tolerance int, diffDir string) ([]*slideDiff, error) {
+	oldNames, err := listPNGs(oldDir)
+	if err != nil {
+		return nil, fmt.Errorf("problem reading %s: %w", oldDir, err)
+	}
+	newNames, err := listPNGs(newDir)
+	if err != nil {
+		return nil, fmt.Errorf("problem reading %s: %w", newDir, err)
+	}
+
+	var diffs []*slideDiff
+	for _, name := range oldNames {
+		if !slices.Contains(newNames, name) {
+			diffs = append(diffs, &slideDiff{Name: name, Status: "removed", Percent: 100})
+		}
+	}
+	for _, name := range newNames {
+		if !slices.Contains(oldNames, name) {
+			diffs = append(diffs, &slideDiff{Name: name, Status: "added", Percent: 100})
+			continue
+		}
+		diff, err := diffSlide(oldDir, newDir, name, tolerance, diffDir)
+		if err != nil {
+			return nil, fmt.Errorf("problem comparing %s: %w", name, err)
+		}
+		diffs = append(diffs, diff)
+	}
+	slices.SortFunc(diffs, func(a, b *slideDiff) int { return strings.Compare(a.Name, b.Name) })
+	return diffs, nil
+}
+
+// Write a table of the slides which differ (or all of them), returning how
+// many differ.
+func writeDiffTable(w io.Writer, diffs []*slideDiff, showSame bool) int {
+	differences := 0
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "SLIDE\tSTATUS\tCHANGED")
+	for _, diff := range diffs {
+		if diff.Status != "same" {
+			differences++
+		} else if !showSame {
+			continue
+		}
+		fmt.Fprintf(table, "%s\t%s\t%.2f%%\n", filepath.ToSlash(diff.Name), diff.Status, diff.Percent)
+	}
+	table.Flush()
+	return differences
+}
+
+// Entry point for "bulletpointer diff old_dir new_dir". Exits with status 1
+// if any slide was changed, added or removed.
+func diffCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] old_dir new_dir")
+	tolerance := flags.Int("tolerance", 0, "ignore per-channel differences up to this much (0-255), such as from antialiasing")
+	diffDir := flags.String("diff-dir", "", "write an image highlighting the changed pixels of each changed slide into this dir")
+	showSame := flags.Bool("all", false, "list unchanged slides too")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	diffs, err := diffDirs(flags.Arg(0), flags.Arg(1), *tolerance, *diffDir)
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	differences := writeDiffTable(os.Stdout, diffs, *showSame)
+	infof("%d of %d slides differ\n", differences, len(diffs))
+	if differences > 0 {
+		os.Exit(1)
+	}
+}
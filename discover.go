@@ -0,0 +1,78 @@
+// Find a working Inkscape on whichever platform we're running on, rather
+// than assuming the Linux flatpak.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// List the commands which might start Inkscape, most preferred first: one
+// on the PATH, then the standard install locations for the platform, then
+// the flatpak.
+func rendererCandidates() [][]string {
+	var candidates [][]string
+	if path, err := exec.LookPath("inkscape"); err == nil {
+		candidates = append(candidates, []string{path})
+	}
+
+	var locations []string
+	switch runtime.GOOS {
+	case "windows":
+		for _, variable := range []string{"ProgramFiles", "ProgramFiles(x86)", "LOCALAPPDATA"} {
+			if dir := os.Getenv(variable); dir != "" {
+				// Inkscape 1.x keeps its executables in bin; 0.92 did not.
+				locations = append(locations,
+					filepath.Join(dir, "Inkscape", "bin", "inkscape.com"),
+					filepath.Join(dir, "Inkscape", "bin", "inkscape.exe"),
+					filepath.Join(dir, "Inkscape", "inkscape.com"),
+					filepath.Join(dir, "Inkscape", "inkscape.exe"))
+			}
+		}
+	case "darwin":
+		locations = append(locations, "/Applications/Inkscape.app/Contents/MacOS/inkscape")
+		if home, err := os.UserHomeDir(); err == nil {
+			locations = append(locations, filepath.Join(home, "Applications", "Inkscape.app", "Contents", "MacOS", "inkscape"))
+		}
+		locations = append(locations, "/opt/homebrew/bin/inkscape", "/usr/local/bin/inkscape")
+	}
+	for _, location := range locations {
+		if info, err := os.Stat(location); err == nil && info.Mode().IsRegular() {
+			candidates = append(candidates, []string{location})
+		}
+	}
+
+	if path, err := exec.LookPath("flatpak"); err == nil {
+		candidates = append(candidates, []string{path, "run", "org.inkscape.Inkscape"})
+	} else if runtime.GOOS == "linux" {
+		candidates = append(candidates, flatpakInkscape)
+	}
+	return candidates
+}
+
+// Settle on the command which starts the renderer: the given executable if
+// there is one, or otherwise the first candidate that actually works.
+func (renderer *Renderer) discover(executable string) error {
+	if executable != "" {
+		renderer.Command = []string{executable}
+		return renderer.probe()
+	}
+
+	var problems []error
+	for _, candidate := range rendererCandidates() {
+		renderer.Command = candidate
+		err := renderer.probe()
+		if err == nil {
+			return nil
+		}
+		debugf("%s\n", err.Error())
+		problems = append(problems, err)
+	}
+	renderer.Command = nil
+	return fmt.Errorf("could not find a working Inkscape; install it or point --inkscape at it: %w", errors.Join(problems...))
+}
@@ -0,0 +1,52 @@
+// Run Inkscape inside a container instead of on the host, so that machines
+// without it installed can still render, and every host renders alike.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+)
+
+// The container image used for "renderer: docker" unless --docker-image says
+// otherwise. It is built from inkscape.Dockerfile; pin a digest with the flag
+// to be sure of exactly the same renderer everywhere.
+const defaultDockerImage = "bulletpointer-inkscape:1.2.2"
+
+// Build the "docker run" command which starts Inkscape in the container. The
+// working directory and the directories of the given files are bind-mounted
+// at the same paths, so that the arguments mean the same thing inside as out.
+func (renderer *Renderer) dockerCommand(files []string) []string {
+	var dirs []string
+	workDir, err := os.Getwd()
+	if err == nil {
+		dirs = append(dirs, workDir)
+	}
+	mounted := func(dir string) bool {
+		return slices.ContainsFunc(dirs, func(parent string) bool {
+			rel, err := filepath.Rel(parent, dir)
+			return err == nil && filepath.IsLocal(rel)
+		})
+	}
+	for _, file := range files {
+		if file, err := filepath.Abs(file); err == nil && !mounted(filepath.Dir(file)) {
+			dirs = append(dirs, filepath.Dir(file))
+		}
+	}
+
+	command := []string{"docker", "run", "--rm", "--network=none", "--env=HOME=/tmp"}
+	if runtime.GOOS != "windows" {
+		// Otherwise the outputs end up owned by root.
+		command = append(command, fmt.Sprintf("--user=%d:%d", os.Getuid(), os.Getgid()))
+	}
+	for _, dir := range dirs {
+		command = append(command, fmt.Sprintf("--volume=%s:%s", dir, dir))
+	}
+	if workDir != "" {
+		command = append(command, fmt.Sprintf("--workdir=%s", workDir))
+	}
+	return append(command, renderer.Docker, "inkscape")
+}
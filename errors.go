@@ -0,0 +1,87 @@
+// Sort failures into classes with their own exit codes, so that scripts and
+// CI jobs can tell a broken config from a missing file or a renderer which
+// fell over, without parsing the log.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// The exit codes for each class of failure. Anything not in one of the
+// classes exits with 1; bad command lines exit with 2, like bad configs. A
+// run stopped by a signal exits as shells expect of one killed by SIGINT.
+const (
+	exitFailure = 1
+	exitConfig = 2
+	exitInput = 3
+	exitRender = 4
+	exitPartial = 5
+	exitInterrupted = 130
+)
+
+// A ConfigError is a mistake in the config or on the command line.
+type ConfigError struct {
+	Err error
+}
+
+func (err *ConfigError) Error() string { return err.Err.Error() }
+func (err *ConfigError) Unwrap() error { return err.Err }
+
+// An InputError is an SVG (or a file it links to) which is missing or can't
+// be read.
+type InputError struct {
+	Err error
+}
+
+func (err *InputError) Error() string { return err.Err.Error() }
+func (err *InputError) Unwrap() error { return err.Err }
+
+// A RenderError is the renderer failing, or not being there at all.
+type RenderError struct {
+	Err error
+}
+
+func (err *RenderError) Error() string { return err.Err.Error() }
+func (err *RenderError) Unwrap() error { return err.Err }
+
+// A PartialError is a --keep-going run which carried on past failures, with
+// the rest of its outputs written.
+type PartialError struct {
+	Failures []*Failure
+}
+
+func (err *PartialError) Error() string {
+	return fmt.Sprintf("%d of the outputs failed", len(err.Failures))
+}
+
+// Pick the exit code for an error by its class.
+func exitCode(err error) int {
+	var configErr *ConfigError
+	var inputErr *InputError
+	var renderErr *RenderError
+	var partialErr *PartialError
+	switch {
+	case errors.Is(err, errInterrupted):
+		return exitInterrupted
+	case errors.As(err, &partialErr):
+		return exitPartial
+	case errors.As(err, &configErr):
+		return exitConfig
+	case errors.As(err, &inputErr):
+		return exitInput
+	case errors.As(err, &renderErr):
+		return exitRender
+	}
+	return exitFailure
+}
+
+// Log an error, with what failed as a prefix, and exit with its class's code.
+func fatal(prefix string, err error) {
+	log.Printf("%s%s\n", prefix, err.Error())
+	releaseLocks()
+	os.Exit(exitCode(err))
+}
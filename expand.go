@@ -0,0 +1,113 @@
+// Expand ${VARIABLE} references in config values, so that one config can be
+// used on machines which keep their assets in different places.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Match ${NAME} or ${NAME:-default}.
+var variableRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// Replace every variable reference in a value. Built-in variables take
+// precedence over the environment, which is only looked at when useEnv is set;
+// a variable which is neither is an error, unless the reference gives a
+// default.
+func expandVariables(value string, builtins map[string]string, useEnv bool) (string, error) {
+	var missing []string
+	expanded := variableRef.ReplaceAllStringFunc(value, func(ref string) string {
+		match := variableRef.FindStringSubmatch(ref)
+		if builtin, ok := builtins[match[1]]; ok {
+			return builtin
+		}
+		if env, ok := os.LookupEnv(match[1]); ok && useEnv {
+			return env
+		}
+		if strings.Contains(ref, ":-") {
+			return match[2]
+		}
+		missing = append(missing, match[1])
+		return ref
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable %s in %q", strings.Join(missing, ", "), value)
+	}
+	return expanded, nil
+}
+
+// Expand the variables in the image's filenames, suffixes, titles and notes,
+// renderer arguments, attribute values, text variables and transform options.
+// The built-ins are CONFIG_DIR and CONFIG_NAME, for the config file the image
+// came from, and IMAGE_BASE, the SVG's name without its extension (which is
+// not available in the filename itself). Only the built-ins are defined for a
+// daemon job, whose outputs would otherwise give away the daemon's environment.
+func (image *Image) expandVariables(config string, limits *jobLimits) error {
+	configDir, err := filepath.Abs(filepath.Dir(config))
+	if err != nil {
+		return err
+	}
+	builtins := map[string]string{
+		"CONFIG_DIR": configDir,
+		"CONFIG_NAME": strings.TrimSuffix(filepath.Base(config), filepath.Ext(config)),
+	}
+
+	expand := func(value *string) {
+		if err == nil {
+			*value, err = expandVariables(*value, builtins, limits == nil)
+		}
+	}
+
+	expand(&image.Filename)
+	base := remoteBase(image.Filename)
+	builtins["IMAGE_BASE"] = strings.TrimSuffix(base, filepath.Ext(base))
+
+	expand(&image.Subtitles)
+	for i := range image.RendererArgs {
+		expand(&image.RendererArgs[i])
+	}
+	expandOptions := func(specs []*TransformSpec) {
+		for _, spec := range specs {
+			for name, value := range spec.Options {
+				expand(&value)
+				spec.Options[name] = value
+			}
+		}
+	}
+	expandOptions(image.Transforms)
+	for name, value := range image.Variables {
+		expand(&value)
+		image.Variables[name] = value
+	}
+	for _, overlay := range image.Overlays {
+		expand(&overlay.File)
+	}
+	for _, layer := range image.Layers {
+		expand(&layer.Suffix)
+		expand(&layer.Audio)
+		expand(&layer.Title)
+		expand(&layer.Notes)
+		for _, attrs := range layer.SetAttrs {
+			for _, value := range attrs {
+				if value != nil {
+					expand(value)
+				}
+			}
+		}
+		expandOptions(layer.Transforms)
+		for _, overlay := range layer.Overlays {
+			expand(&overlay.File)
+		}
+	}
+	for _, composite := range image.Composites {
+		expand(&composite.Suffix)
+		for _, source := range composite.Stack {
+			expand(&source.File)
+		}
+	}
+	return err
+}
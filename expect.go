@@ -0,0 +1,128 @@
+// Check the state of the document after a layer's toggles have been applied,
+// which catches mistakes caused by state carried over from earlier layers.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Represent the assertions made about a layer once its toggles are applied.
+type LayerExpectation struct {
+	Visible []string `yaml:"visible,omitempty"`
+	Hidden []string `yaml:"hidden,omitempty"`
+
+	// Log mismatches instead of failing the layer.
+	Warn bool `yaml:"warn,omitempty"`
+}
+
+// Report whether an element will actually be drawn, which means neither it
+// nor any of its ancestors is set not to display, and it isn't left with
+// visibility hidden.
+func isVisible(element *etree.Element) bool {
+	if visibilityHidden(element) {
+		return false
+	}
+	for ; element != nil; element = element.Parent() {
+		if displayNone(element) {
+			return false
+		}
+	}
+	return true
+}
+
+// Find the nearest ancestor of an element which is hidden, which hides the
+// element too whatever its own style says. Returns nil if there isn't one.
+func hiddenAncestor(element *etree.Element) *etree.Element {
+	for ancestor := element.Parent(); ancestor != nil; ancestor = ancestor.Parent() {
+		if displayNone(ancestor) {
+			return ancestor
+		}
+	}
+	return nil
+}
+
+// Name an element for a message by its ID, or by its tag if it has none.
+func elementName(element *etree.Element) string {
+	if id := element.SelectAttrValue("id", ""); id != "" {
+		return "#" + id
+	}
+	return "<" + element.Tag + ">"
+}
+
+// Check every expected ID against the document, returning a single error
+// listing all of the mismatches.
+func (expect *LayerExpectation) check(index *elementIndex) error {
+	var problems []string
+	verify := func(selectors []string, visible bool) {
+		for _, selector := range selectors {
+			elements, err := index.resolve(selector)
+			if err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			for _, element := range elements {
+				if isVisible(element) != visible {
+					state := "hidden"
+					if !visible {
+						state = "visible"
+					}
+					problems = append(problems, fmt.Sprintf("%s is %s", elementName(element), state))
+				}
+			}
+		}
+	}
+	verify(expect.Visible, true)
+	verify(expect.Hidden, false)
+	if len(problems) > 0 {
+		return fmt.Errorf("expectations not met: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Deal with the layer's shown elements that are still hidden because one of
+// their ancestors is. With show_with_ancestors the ancestors are shown too;
+// otherwise a warning names the one in the way, since the slide would
+// silently come out without the element.
+func (layer *ImageLayer) showAncestors(image *Image, index *elementIndex) error {
+	for _, selector := range layer.ShowIDs {
+		elements, err := index.resolve(selector)
+		if err != nil {
+			return err
+		}
+		for _, element := range elements {
+			ancestor := hiddenAncestor(element)
+			if ancestor == nil {
+				continue
+			}
+			if !layer.ShowWithAncestors && !image.ShowWithAncestors {
+				log.Printf("WARNING %s layer %s: %s is shown but is inside hidden %s (set show_with_ancestors to show it as well)\n",
+					image.Filename, layer.Suffix, elementName(element), elementName(ancestor))
+				continue
+			}
+			for ; ancestor != nil; ancestor = hiddenAncestor(element) {
+				debugf("Showing %s for %s in %s layer %s\n", elementName(ancestor), elementName(element), image.Filename, layer.Suffix)
+				setHidden(ancestor, false)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply the layer's expectations, if it has any, either failing the layer or
+// just logging a warning on a mismatch.
+func (layer *ImageLayer) checkExpectations(image *Image, index *elementIndex) error {
+	if layer.Expect == nil {
+		return nil
+	}
+	err := layer.Expect.check(index)
+	if err != nil && layer.Expect.Warn {
+		log.Printf("WARNING %s layer %s: %s\n", image.Filename, layer.Suffix, err.Error())
+		return nil
+	}
+	return err
+}
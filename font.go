@@ -0,0 +1,139 @@
+// A tiny built-in bitmap font, for the few places where text is drawn onto
+// images directly in Go (labels and the like) rather than by the renderer.
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"unicode"
+)
+
+// The size of each glyph in font pixels, and the gap after it.
+const (
+	glyphWidth = 5
+	glyphHeight = 7
+	glyphSpacing = 1
+)
+
+// Each glyph is seven rows of five pixels, with the leftmost pixel in the
+// highest bit. Lowercase letters are drawn with the uppercase glyphs, and
+// anything missing is drawn as a box.
+var glyphs = map[rune][glyphHeight]uint8{
+	' ': {0, 0, 0, 0, 0, 0, 0},
+	'0': {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1': {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2': {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3': {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4': {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5': {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6': {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7': {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9': {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	'A': {0x0e, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'B': {0x1e, 0x11, 0x11, 0x1e, 0x11, 0x11, 0x1e},
+	'C': {0x0e, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0e},
+	'D': {0x1c, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1c},
+	'E': {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f},
+	'F': {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x10},
+	'G': {0x0e, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0f},
+	'H': {0x11, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'I': {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'J': {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0c},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L': {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1f},
+	'M': {0x11, 0x1b, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N': {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O': {0x0e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'P': {0x1e, 0x11, 0x11, 0x1e, 0x10, 0x10, 0x10},
+	'Q': {0x0e, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0d},
+	'R': {0x1e, 0x11, 0x11, 0x1e, 0x14, 0x12, 0x11},
+	'S': {0x0f, 0x10, 0x10, 0x0e, 0x01, 0x01, 0x1e},
+	'T': {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'V': {0x11, 0x11, 0x11, 0x11, 0x11, 0x0a, 0x04},
+	'W': {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0a},
+	'X': {0x11, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x11},
+	'Y': {0x11, 0x11, 0x11, 0x0a, 0x04, 0x04, 0x04},
+	'Z': {0x1f, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1f},
+	'.': {0, 0, 0, 0, 0, 0x0c, 0x0c},
+	',': {0, 0, 0, 0, 0x0c, 0x04, 0x08},
+	':': {0, 0x0c, 0x0c, 0, 0x0c, 0x0c, 0},
+	';': {0, 0x0c, 0x0c, 0, 0x0c, 0x04, 0x08},
+	'!': {0x04, 0x04, 0x04, 0x04, 0x04, 0, 0x04},
+	'?': {0x0e, 0x11, 0x01, 0x02, 0x04, 0, 0x04},
+	'-': {0, 0, 0, 0x1f, 0, 0, 0},
+	'_': {0, 0, 0, 0, 0, 0, 0x1f},
+	'+': {0, 0x04, 0x04, 0x1f, 0x04, 0x04, 0},
+	'=': {0, 0, 0x1f, 0, 0x1f, 0, 0},
+	'/': {0x01, 0x01, 0x02, 0x04, 0x08, 0x10, 0x10},
+	'\\': {0x10, 0x10, 0x08, 0x04, 0x02, 0x01, 0x01},
+	'(': {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')': {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'[': {0x0e, 0x08, 0x08, 0x08, 0x08, 0x08, 0x0e},
+	']': {0x0e, 0x02, 0x02, 0x02, 0x02, 0x02, 0x0e},
+	'#': {0x0a, 0x0a, 0x1f, 0x0a, 0x1f, 0x0a, 0x0a},
+	'%': {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03},
+	'&': {0x0c, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0d},
+	'\'': {0x04, 0x04, 0x08, 0, 0, 0, 0},
+	'"': {0x0a, 0x0a, 0, 0, 0, 0, 0},
+	'*': {0, 0x04, 0x15, 0x0e, 0x15, 0x04, 0},
+	'<': {0x02, 0x04, 0x08, 0x10, 0x08, 0x04, 0x02},
+	'>': {0x08, 0x04, 0x02, 0x01, 0x02, 0x04, 0x08},
+	'@': {0x0e, 0x11, 0x17, 0x15, 0x17, 0x10, 0x0f},
+}
+
+// Drawn in place of any character the font doesn't have.
+var missingGlyph = [glyphHeight]uint8{0x1f, 0x11, 0x11, 0x11, 0x11, 0x11, 0x1f}
+
+// Measure the size in pixels of a line of text drawn at the given scale.
+func textSize(text string, scale int) (int, int) {
+	count := len([]rune(text))
+	if count == 0 {
+		return 0, glyphHeight * scale
+	}
+	return (count*(glyphWidth+glyphSpacing) - glyphSpacing) * scale, glyphHeight * scale
+}
+
+// Draw a line of text with its top-left corner at the given point, with each
+// font pixel drawn as a scale x scale square.
+func drawText(img *image.RGBA, x int, y int, text string, scale int, ink color.Color) {
+	for _, r := range text {
+		glyph, ok := glyphs[unicode.ToUpper(r)]
+		if !ok {
+			glyph = missingGlyph
+		}
+		for row := 0; row < glyphHeight; row++ {
+			for col := 0; col < glyphWidth; col++ {
+				if glyph[row]&(1<<(glyphWidth-1-col)) == 0 {
+					continue
+				}
+				for dy := 0; dy < scale; dy++ {
+					for dx := 0; dx < scale; dx++ {
+						img.Set(x+col*scale+dx, y+row*scale+dy, ink)
+					}
+				}
+			}
+		}
+		x += (glyphWidth + glyphSpacing) * scale
+	}
+}
+
+// Shorten text to fit within a width in pixels at the given scale, marking
+// the cut with "..." at the end.
+func fitText(text string, width int, scale int) string {
+	if w, _ := textSize(text, scale); w <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := strings.TrimSpace(string(runes)) + "..."
+		if w, _ := textSize(candidate, scale); w <= width {
+			return candidate
+		}
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+// Catch fonts which the renderer doesn't have before they are silently
+// substituted, which makes a render on one machine differ from another.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/beevik/etree"
+)
+
+// Pick the font-family declarations out of a style attribute or stylesheet.
+var fontFamilyDecl = regexp.MustCompile(`font-family\s*:\s*([^;}]+)`)
+
+// The CSS generic families, which always resolve to something.
+var genericFonts = []string{"serif", "sans-serif", "sans", "monospace", "cursive", "fantasy", "system-ui"}
+
+// Split a font-family value into the names it lists, without quotes.
+func fontFamilies(value string) []string {
+	var families []string
+	for _, family := range strings.Split(value, ",") {
+		family = strings.Trim(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(family), "!important")), `'"`)
+		if family != "" {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
+// List the fonts that the document asks for first in each of its font-family
+// settings (a fallback further down the list is a substitution too), other
+// than the generic families.
+func documentFonts(doc *etree.Document) []string {
+	var fonts []string
+	add := func(value string) {
+		families := fontFamilies(value)
+		if len(families) == 0 || slices.Contains(genericFonts, strings.ToLower(families[0])) {
+			return
+		}
+		if !slices.Contains(fonts, families[0]) {
+			fonts = append(fonts, families[0])
+		}
+	}
+	var walk func(element *etree.Element)
+	walk = func(element *etree.Element) {
+		add(element.SelectAttrValue("font-family", ""))
+		for _, match := range fontFamilyDecl.FindAllStringSubmatch(element.SelectAttrValue("style", ""), -1) {
+			add(match[1])
+		}
+		if element.Tag == "style" {
+			for _, match := range fontFamilyDecl.FindAllStringSubmatch(element.Text(), -1) {
+				add(match[1])
+			}
+		}
+		for _, child := range element.ChildElements() {
+			walk(child)
+		}
+	}
+	if root := doc.Root(); root != nil {
+		walk(root)
+	}
+	return fonts
+}
+
+// Represent the fonts which the renderer can see, looked up once per run.
+type fontList struct {
+	once sync.Once
+	families map[string]bool
+	err error
+}
+
+// Build the fc-list command which lists the fonts the renderer can see:
+// inside the flatpak sandbox or the container if that's where it runs.
+func (renderer *Renderer) fontListCommand() []string {
+	command := slices.Clone(renderer.command())
+	switch {
+	case renderer.Docker != "":
+		command[len(command)-1] = "fc-list"
+	case len(command) == 3 && command[1] == "run" && strings.HasSuffix(command[0], "flatpak"):
+		command = []string{command[0], "run", "--command=fc-list", command[2]}
+	default:
+		command = []string{"fc-list"}
+	}
+	return append(command, ":", "family")
+}
+
+// Report the (lowercased) families of every font the renderer can see.
+func (renderer *Renderer) fontFamilies() (map[string]bool, error) {
+	renderer.fonts.once.Do(func() {
+		command := renderer.fontListCommand()
+		output, err := exec.Command(command[0], command[1:]...).Output()
+		if err != nil {
+			renderer.fonts.err = fmt.Errorf("could not list fonts with %s: %w", strings.Join(command, " "), err)
+			return
+		}
+		renderer.fonts.families = make(map[string]bool)
+		for _, line := range strings.Split(string(output), "\n") {
+			// Fonts list their family under several names (and languages).
+			for _, family := range strings.Split(line, ",") {
+				family = strings.ReplaceAll(strings.TrimSpace(family), `\-`, "-")
+				if family != "" {
+					renderer.fonts.families[strings.ToLower(family)] = true
+				}
+			}
+		}
+	})
+	return renderer.fonts.families, renderer.fonts.err
+}
+
+// Warn about every font the image uses which the renderer doesn't have, and
+// which it would quietly replace with something else. When the fonts can't
+// be listed at all, that is only mentioned with --verbose.
+func (image *Image) checkFonts(renderer *Renderer, doc *etree.Document) {
+	families, err := renderer.fontFamilies()
+	if err != nil {
+		debugf("Not checking fonts: %s\n", err.Error())
+		return
+	}
+	for _, font := range documentFonts(doc) {
+		if !families[strings.ToLower(font)] {
+			log.Printf("WARNING %s: font %q is not installed for the renderer and will be substituted\n", image.Filename, font)
+		}
+	}
+}
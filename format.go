@@ -0,0 +1,199 @@
+// Rewrite config files into one layout, so that files edited (and merged) by
+// several people keep readable diffs: keys in the order the format defines
+// them in, two-space indentation, and the comments kept where they were.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The shape of a config file written as a mapping, for ordering its keys.
+type formattedConfig struct {
+	Defaults *ConfigDefaults `yaml:"defaults"`
+	Images []*Image `yaml:"images"`
+}
+
+// Report whether a type is a list of mappings (such as layers), which go
+// after the plain settings so that those aren't lost below a long list.
+func isMappingList(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && indirectType(t.Elem()).Kind() == reflect.Struct
+}
+
+// Collect the anchors defined within a node, and the anchors which the
+// aliases within it refer to.
+func collectAnchors(node *yaml.Node, anchors map[string]bool, aliases map[string]bool) {
+	if node.Anchor != "" {
+		anchors[node.Anchor] = true
+	}
+	if node.Kind == yaml.AliasNode {
+		aliases[node.Alias.Anchor] = true
+		return
+	}
+	for _, child := range node.Content {
+		collectAnchors(child, anchors, aliases)
+	}
+}
+
+// Sort the keys of every mapping which decodes into a struct into the order
+// of the struct's fields, with lists of mappings last and unknown keys (such
+// as "x-" ones holding anchors) and merge keys first. Maps and unknown
+// values are left in their own order. A key whose value defines an anchor is
+// kept ahead of any key which uses it, since an alias can't come before its
+// anchor.
+func sortConfigKeys(node *yaml.Node, t reflect.Type) {
+	t = indirectType(t)
+	switch {
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for _, item := range node.Content {
+			sortConfigKeys(item, t.Elem())
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 1; i < len(node.Content); i += 2 {
+			sortConfigKeys(node.Content[i], t.Elem())
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct && t != reflect.TypeOf(yaml.Node{}):
+		fields := yamlFields(t)
+		rank := func(key *yaml.Node) int {
+			index := slices.IndexFunc(fields, func(field yamlField) bool { return field.name == key.Value })
+			if index < 0 {
+				return -1
+			}
+			if isMappingList(fields[index].fieldType) {
+				return len(fields) + index
+			}
+			return index
+		}
+		type pair struct {
+			key, value *yaml.Node
+		}
+		var pairs []pair
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if isMergeKey(key) {
+				// Otherwise the tag is written out, as "!!merge <<:".
+				key.Tag = ""
+			}
+			if index := slices.IndexFunc(fields, func(field yamlField) bool { return field.name == key.Value }); index >= 0 {
+				sortConfigKeys(value, fields[index].fieldType)
+			}
+			pairs = append(pairs, pair{key, value})
+		}
+		slices.SortStableFunc(pairs, func(a, b pair) int { return rank(a.key) - rank(b.key) })
+
+		// Move any pair defining an anchor up to before the first pair
+		// which uses it, which terminates since each move only ever takes a
+		// pair further up.
+		for moved := true; moved; {
+			moved = false
+			for i := 0; i < len(pairs) && !moved; i++ {
+				aliases := make(map[string]bool)
+				collectAnchors(pairs[i].value, make(map[string]bool), aliases)
+				for j := i + 1; j < len(pairs) && !moved; j++ {
+					anchors := make(map[string]bool)
+					collectAnchors(pairs[j].value, anchors, make(map[string]bool))
+					for anchor := range anchors {
+						if aliases[anchor] {
+							definer := pairs[j]
+							pairs = slices.Insert(slices.Delete(pairs, j, j+1), i, definer)
+							moved = true
+							break
+						}
+					}
+				}
+			}
+		}
+		node.Content = node.Content[:0]
+		for _, p := range pairs {
+			node.Content = append(node.Content, p.key, p.value)
+		}
+	}
+}
+
+// Format a config file's contents, keeping its comments, anchors and form
+// (a list of images, or a mapping with defaults: and images:).
+func formatConfig(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return data, nil
+	}
+	if root := doc.Content[0]; root.Kind == yaml.SequenceNode {
+		sortConfigKeys(root, reflect.TypeOf([]*Image{}))
+	} else {
+		sortConfigKeys(root, reflect.TypeOf(formattedConfig{}))
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Entry point for "bulletpointer fmt [options] in.yaml...". The formatted
+// configs are written to stdout, unless they are to be rewritten in place or
+// only checked.
+func fmtCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] in.yaml...")
+	write := flags.Bool("w", false, "rewrite the config files in place instead of printing them")
+	check := flags.Bool("check", false, "only list the config files which aren't formatted, failing if there are any")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var configs []string
+	for _, pattern := range flags.Args() {
+		files, err := expandConfigGlob(pattern)
+		if err != nil {
+			log.Fatalf("%s\n", err.Error())
+		}
+		configs = append(configs, files...)
+	}
+	unformatted := 0
+	for _, config := range configs {
+		data, err := readConfig(config)
+		if err != nil {
+			log.Fatalf("Problem reading %s: %s\n", config, err.Error())
+		}
+		formatted, err := formatConfig(data)
+		if err != nil {
+			log.Fatalf("Problem parsing YAML in %s: %s\n", config, err.Error())
+		}
+		switch {
+		case *check:
+			if !bytes.Equal(data, formatted) {
+				fmt.Println(config)
+				unformatted++
+			}
+		case *write && config != "-":
+			if bytes.Equal(data, formatted) {
+				continue
+			}
+			if err := os.WriteFile(config, formatted, 0644); err != nil {
+				log.Fatalf("Problem writing %s: %s\n", config, err.Error())
+			}
+			debugf("Formatted %s\n", config)
+		default:
+			os.Stdout.Write(formatted)
+		}
+	}
+	if unformatted > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+var formatTests = []struct {
+	name string
+	in string
+	want string
+}{
+	{
+		name: "mapping with anchors and comments",
+		in: `# The deck
+x-bullet: &bullet
+  duration: 2
+  tags: [bullet]
+images:
+    - layers:
+        - <<: *bullet
+          show_ids: [b1]   # first
+          suffix: _a
+        - suffix: _b
+          <<: *bullet
+      filename: deck.svg
+      # shown as-is
+      resolution: 96
+defaults:
+    renderer: inkscape
+    base_dir: svgs
+`,
+		want: `# The deck
+x-bullet: &bullet
+  duration: 2
+  tags: [bullet]
+defaults:
+  base_dir: svgs
+  renderer: inkscape
+images:
+  - filename: deck.svg
+    # shown as-is
+    resolution: 96
+    layers:
+      - <<: *bullet
+        suffix: _a
+        show_ids: [b1] # first
+      - <<: *bullet
+        suffix: _b
+`,
+	},
+	{
+		name: "anchor kept ahead of its alias",
+		in: `- layers:
+    - suffix: _a
+      tags: &t [png]
+  formats: *t
+  filename: deck.svg
+`,
+		want: `- filename: deck.svg
+  layers:
+    - suffix: _a
+      tags: &t [png]
+  formats: *t
+`,
+	},
+	{
+		name: "maps and unknown keys keep their order",
+		in: `- filename: deck.svg
+  colors: {zest: "#f00", apple: "#0f0"}
+  layers:
+    - suffix: _a
+      set_attrs:
+        title: {y: "10", x: "5"}
+  x-notes: kept
+`,
+		want: `- x-notes: kept
+  filename: deck.svg
+  colors: {zest: "#f00", apple: "#0f0"}
+  layers:
+    - suffix: _a
+      set_attrs:
+        title: {y: "10", x: "5"}
+`,
+	},
+	{
+		name: "empty",
+		in: ``,
+		want: ``,
+	},
+}
+
+func TestFormatConfig(t *testing.T) {
+	for _, test := range formatTests {
+		got, err := formatConfig([]byte(test.in))
+		if err != nil {
+			t.Errorf("%s: formatConfig error = %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: formatConfig =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFormatConfigRoundTrip(t *testing.T) {
+	for _, test := range formatTests {
+		once, err := formatConfig([]byte(test.in))
+		if err != nil {
+			t.Errorf("%s: formatConfig error = %v", test.name, err)
+			continue
+		}
+		twice, err := formatConfig(once)
+		if err != nil {
+			t.Errorf("%s: formatting again error = %v", test.name, err)
+			continue
+		}
+		if string(twice) != string(once) {
+			t.Errorf("%s: formatting again changed it to\n%s\nfrom\n%s", test.name, twice, once)
+		}
+
+		// Whatever the layout, the config has to mean the same, which is
+		// compared by what it decodes to written out again, since where
+		// things were in the file is remembered for messages.
+		decode := func(data []byte) string {
+			var node yaml.Node
+			if err := yaml.Unmarshal(data, &node); err != nil || len(node.Content) == 0 {
+				return ""
+			}
+			var decoded any
+			if node.Content[0].Kind == yaml.SequenceNode {
+				var images []*Image
+				if err := node.Decode(&images); err != nil {
+					t.Fatalf("%s: %v", test.name, err)
+				}
+				decoded = images
+			} else {
+				var config formattedConfig
+				if err := node.Decode(&config); err != nil {
+					t.Fatalf("%s: %v", test.name, err)
+				}
+				decoded = config
+			}
+			encoded, err := yaml.Marshal(decoded)
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			return string(encoded)
+		}
+		if before, after := decode([]byte(test.in)), decode(once); before != after {
+			t.Errorf("%s: formatting changed what the config decodes to, from\n%s\nto\n%s", test.name, before, after)
+		}
+	}
+}
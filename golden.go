@@ -0,0 +1,211 @@
+// Test a deck against golden images: render it into a scratch directory and
+// compare every slide with the PNG committed for it, so that a change to the
+// artwork, the config or the tool which alters a slide fails CI the way a
+// broken unit test does. The results are written as a JUnit-style report,
+// which CI systems know how to show.
+
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Represent a JUnit-style report, holding the one suite of a test run.
+type junitReport struct {
+	XMLName xml.Name `xml:"testsuites"`
+	Suites []*junitSuite `xml:"testsuite"`
+}
+
+// Represent the test suite of a deck, with a case for each slide.
+type junitSuite struct {
+	Name string `xml:"name,attr"`
+	Tests int `xml:"tests,attr"`
+	Failures int `xml:"failures,attr"`
+	Time float64 `xml:"time,attr"`
+	Cases []*junitCase `xml:"testcase"`
+}
+
+// Represent the test case of one slide, failed if it differs too much from
+// its golden image.
+type junitCase struct {
+	Name string `xml:"name,attr"`
+	Classname string `xml:"classname,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+}
+
+// Represent why a slide's test case failed.
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// Report why a slide fails against its golden image, or "" if it passes: when
+// it is missing on either side, has changed size, or has more than threshold
+// percent of its pixels changed.
+func goldenFailure(diff *slideDiff, threshold float64) string {
+	switch diff.Status {
+	case "same":
+		return ""
+	case "added":
+		return "there is no golden image for this slide (use --update to add one)"
+	case "removed":
+		return "the golden image is for a slide which is no longer rendered"
+	case "changed":
+		if diff.Percent <= threshold {
+			return ""
+		}
+		return fmt.Sprintf("%.2f%% of the pixels changed, more than the %.2f%% allowed", diff.Percent, threshold)
+	default:
+		return diff.Status
+	}
+}
+
+// Build the report of a deck's slides compared with the golden images.
+func goldenReport(name string, diffs []*slideDiff, threshold float64, elapsed time.Duration) *junitReport {
+	suite := &junitSuite{Name: name, Tests: len(diffs), Time: elapsed.Seconds()}
+	for _, diff := range diffs {
+		testCase := &junitCase{Name: filepath.ToSlash(diff.Name), Classname: name}
+		if message := goldenFailure(diff, threshold); message != "" {
+			testCase.Failure = &junitFailure{Message: message, Type: diff.Status}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	return &junitReport{Suites: []*junitSuite{suite}}
+}
+
+// Write a JUnit-style report to a file, or to stdout for "-".
+func (report *junitReport) write(filename string) error {
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	if filename == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// Copy a file, creating the directory it goes into.
+func copyFile(from string, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Replace the golden images with the slides just rendered, removing those of
+// slides which are no longer rendered. Returns how many were written.
+func updateGolden(renderedDir string, goldenDir string) (int, error) {
+	rendered, err := listPNGs(renderedDir)
+	if err != nil {
+		return 0, err
+	}
+	golden, err := listPNGs(goldenDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	for _, name := range golden {
+		if !slices.Contains(rendered, name) {
+			if err := os.Remove(filepath.Join(goldenDir, name)); err != nil {
+				return 0, err
+			}
+		}
+	}
+	for _, name := range rendered {
+		if err := copyFile(filepath.Join(renderedDir, name), filepath.Join(goldenDir, name)); err != nil {
+			return 0, err
+		}
+	}
+	return len(rendered), nil
+}
+
+// Entry point for "bulletpointer test [options] --golden dir in.yaml...".
+// Exits with status 1 if any slide fails against its golden image.
+func testCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] --golden dir in.yaml...")
+	options := &RenderOptions{}
+	options.registerFlags(flags)
+	goldenDir := flags.String("golden", "", "compare the slides with the golden PNGs in this dir (required)")
+	threshold := flags.Float64("threshold", 0, "pass slides with up to this percentage of their pixels changed")
+	tolerance := flags.Int("tolerance", 0, "ignore per-channel differences up to this much (0-255), such as from antialiasing")
+	junit := flags.String("junit", "-", "write the JUnit-style report to this file (- for stdout)")
+	update := flags.Bool("update", false, "replace the golden PNGs with the slides as they render now, instead of testing")
+	flags.Parse(args)
+	if err := options.takePositional(flags.Args(), false); err != nil || *goldenDir == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	outDir, err := os.MkdirTemp("", "bulletpointer-test-")
+	if err != nil {
+		fatal("", fmt.Errorf("could not create output dir: %w", err))
+	}
+	defer os.RemoveAll(outDir)
+	options.OutDir = outDir
+	options.Resume = false
+
+	trapSignals()
+	start := time.Now()
+	if _, err := options.renderSlides(); err != nil {
+		os.RemoveAll(outDir)
+		fatal("Render failed: ", err)
+	}
+	elapsed := time.Since(start)
+
+	if *update {
+		written, err := updateGolden(outDir, *goldenDir)
+		if err != nil {
+			os.RemoveAll(outDir)
+			fatal("", fmt.Errorf("problem updating %s: %w", *goldenDir, err))
+		}
+		infof("Wrote %d golden images to %s\n", written, *goldenDir)
+		return
+	}
+
+	if _, err := os.Stat(*goldenDir); err != nil {
+		os.RemoveAll(outDir)
+		fatal("", &ConfigError{fmt.Errorf("no golden images in %s (use --update to write them): %w", *goldenDir, err)})
+	}
+	diffs, err := diffDirs(*goldenDir, outDir, *tolerance, options.DiffDir)
+	if err != nil {
+		os.RemoveAll(outDir)
+		fatal("", err)
+	}
+	suite := strings.TrimSuffix(filepath.Base(options.Configs[0]), filepath.Ext(options.Configs[0]))
+	report := goldenReport(suite, diffs, *threshold, elapsed)
+	if err := report.write(*junit); err != nil {
+		os.RemoveAll(outDir)
+		fatal("", fmt.Errorf("could not write the report: %w", err))
+	}
+	failures := report.Suites[0].Failures
+	infof("%d of %d slides failed against %s\n", failures, len(diffs), *goldenDir)
+	if failures > 0 {
+		os.RemoveAll(outDir)
+		os.Exit(1)
+	}
+}
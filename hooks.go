@@ -0,0 +1,115 @@
+// Run the user's own commands at points during a render (after each layer,
+// at the end of the run, ...), for post-processing and notifications that
+// don't belong in the tool itself.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+)
+
+// Represent the commands to run around each layer and at the end of the run.
+// Each one is run by the shell, with details of what was just done in
+// BULLETPOINTER_* environment variables.
+type Hooks struct {
+	PreLayer []string `yaml:"pre_layer,omitempty"`
+	PostLayer []string `yaml:"post_layer,omitempty"`
+	PostRun []string `yaml:"post_run,omitempty"`
+}
+
+// Run each of the hook commands in turn in the given directory, stopping at
+// the first one that fails.
+func runHooks(which string, commands []string, dir string, env []string) error {
+	for _, command := range commands {
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", command)
+		} else {
+			cmd = exec.Command("sh", "-c", command)
+		}
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Stdout = log.Writer()
+		cmd.Stderr = log.Writer()
+		debugf("Running %s hook: %s\n", which, command)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook %q failed: %w", which, command, err)
+		}
+	}
+	return nil
+}
+
+// Make a path absolute, since hooks run in a different directory. An empty
+// path stays empty.
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Describe a layer to its hooks.
+func layerHookEnv(image *Image, slide *Slide) []string {
+	return []string{
+		"BULLETPOINTER_CONFIG=" + image.configFile,
+		"BULLETPOINTER_IMAGE=" + image.Filename,
+		"BULLETPOINTER_LAYER=" + slide.Layer,
+		"BULLETPOINTER_SVG=" + absPath(slide.SvgFile),
+		"BULLETPOINTER_PNG=" + absPath(slide.PngFile),
+		"BULLETPOINTER_DURATION=" + strconv.FormatFloat(slide.seconds(), 'f', -1, 64),
+	}
+}
+
+// Run the pre_layer hooks of an image, before the layer is rendered.
+func (image *Image) preLayerHooks(slide *Slide) error {
+	if image.Hooks == nil {
+		return nil
+	}
+	return runHooks("pre_layer", image.Hooks.PreLayer, filepath.Dir(image.configFile), layerHookEnv(image, slide))
+}
+
+// Run the post_layer hooks of an image, once the layer's PNG is written.
+func (image *Image) postLayerHooks(slide *Slide) error {
+	if image.Hooks == nil {
+		return nil
+	}
+	return runHooks("post_layer", image.Hooks.PostLayer, filepath.Dir(image.configFile), layerHookEnv(image, slide))
+}
+
+// Run the post_run hooks of every image once everything else is done. A
+// command which several images share (from the defaults, say) is only run
+// once.
+func (run *Run) postRunHooks(images []*Image, slides []*Slide) error {
+	var commands []string
+	for _, image := range images {
+		if image.Hooks == nil {
+			continue
+		}
+		for _, command := range image.Hooks.PostRun {
+			if !slices.Contains(commands, command) {
+				commands = append(commands, command)
+			}
+		}
+	}
+	status := "ok"
+	if len(run.Failures) > 0 {
+		status = "failed"
+	}
+	env := []string{
+		"BULLETPOINTER_OUT_DIR=" + absPath(run.OutDir),
+		"BULLETPOINTER_STATUS=" + status,
+		"BULLETPOINTER_OUTPUTS=" + strconv.Itoa(len(slides)),
+		"BULLETPOINTER_FAILED=" + strconv.Itoa(len(run.Failures)),
+	}
+	return runHooks("post_run", commands, ".", env)
+}
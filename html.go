@@ -0,0 +1,177 @@
+// Write an HTML page which steps through the slides in a browser, so that
+// the sequence can be reviewed without rendering a video.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+)
+
+// Represent one slide as it is shown on the preview page.
+type htmlSlide struct {
+	Src template.URL
+	Image string
+	Label string
+	Seconds float64
+}
+
+// Represent everything the preview page is built from.
+type htmlPreview struct {
+	Title string
+	Slides []*htmlSlide
+	Reveal bool
+
+	// A URL to poll for changes, which reloads the page when they happen.
+	// Empty for a static page.
+	ReloadURL string
+}
+
+// Helpers for the preview page template.
+var previewFuncs = template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+	"mul": func(seconds float64) float64 { return seconds * 1000 },
+}
+
+var previewTemplate = template.Must(template.New("preview").Funcs(previewFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+{{- if .Reveal}}
+<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/reveal.js@5/dist/reveal.css">
+<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/reveal.js@5/dist/theme/black.css">
+{{- else}}
+<style>
+body { margin: 0; font-family: sans-serif; background: #202020; color: #f0f0f0; display: flex; height: 100vh; }
+nav { width: 16em; overflow-y: auto; background: #181818; padding: 0.5em; box-sizing: border-box; }
+nav a { display: block; color: inherit; text-decoration: none; padding: 0.2em 0.4em; font-size: 0.9em; }
+nav a.current { background: #404040; }
+nav h2 { font-size: 0.8em; margin: 0.8em 0 0.2em; color: #a0a0a0; }
+main { flex: 1; display: flex; flex-direction: column; align-items: center; justify-content: center; }
+main img { max-width: 95%; max-height: 85vh; background: #ffffff; }
+#caption { margin-top: 0.6em; }
+</style>
+{{- end}}
+</head>
+<body>
+{{- if .Reveal}}
+<div class="reveal"><div class="slides">
+{{- range .Slides}}
+<section data-background-image="{{.Src}}" data-background-size="contain" data-autoslide="{{printf "%.0f" (mul .Seconds)}}"></section>
+{{- end}}
+</div></div>
+<script src="https://cdn.jsdelivr.net/npm/reveal.js@5/dist/reveal.js"></script>
+<script>Reveal.initialize({ hash: true });</script>
+{{- else}}
+<nav>
+{{- $image := "-"}}
+{{- range $i, $slide := .Slides}}
+{{- if ne $slide.Image $image}}{{$image = $slide.Image}}<h2>{{if $slide.Image}}{{$slide.Image}}{{else}}(generated){{end}}</h2>{{end}}
+<a href="#{{$i}}" data-index="{{$i}}">{{$i | inc}}. {{$slide.Label}}</a>
+{{- end}}
+</nav>
+<main>
+<img id="slide" alt="">
+<div id="caption"></div>
+<div><button id="prev">&larr;</button> <button id="play">Play</button> <button id="next">&rarr;</button></div>
+</main>
+<script>
+const slides = [{{range .Slides}}{src: {{.Src}}, label: {{.Label}}, seconds: {{.Seconds}}},{{end}}];
+let current = 0, timer = null;
+function show(i) {
+  if (slides.length === 0) return;
+  current = Math.max(0, Math.min(slides.length - 1, i));
+  document.getElementById("slide").src = slides[current].src;
+  document.getElementById("caption").textContent = (current + 1) + " / " + slides.length + ": " + slides[current].label;
+  document.querySelectorAll("nav a").forEach(a => a.classList.toggle("current", Number(a.dataset.index) === current));
+  history.replaceState(null, "", "#" + current);
+}
+function play() {
+  if (timer) { clearTimeout(timer); timer = null; document.getElementById("play").textContent = "Play"; return; }
+  document.getElementById("play").textContent = "Pause";
+  (function advance() {
+    timer = setTimeout(() => { if (current + 1 < slides.length) { show(current + 1); advance(); } else { play(); } }, slides[current].seconds * 1000);
+  })();
+}
+document.getElementById("prev").onclick = () => show(current - 1);
+document.getElementById("next").onclick = () => show(current + 1);
+document.getElementById("play").onclick = play;
+document.querySelectorAll("nav a").forEach(a => a.onclick = e => { e.preventDefault(); show(Number(a.dataset.index)); });
+document.addEventListener("keydown", e => {
+  if (e.key === "ArrowRight" || e.key === "PageDown" || e.key === " ") show(current + 1);
+  if (e.key === "ArrowLeft" || e.key === "PageUp") show(current - 1);
+  if (e.key === "Home") show(0);
+  if (e.key === "End") show(slides.length - 1);
+});
+show(Number(location.hash.slice(1)) || 0);
+</script>
+{{- end}}
+{{- if .ReloadURL}}
+<script>
+(function poll(version) {
+  fetch({{.ReloadURL}}).then(r => r.text()).then(v => {
+    if (version !== null && v !== version) { location.reload(); return; }
+    setTimeout(() => poll(v), 1000);
+  }).catch(() => setTimeout(() => poll(version), 2000));
+})(null);
+</script>
+{{- end}}
+</body>
+</html>
+`))
+
+// Build the preview of the slides. Images are referenced relative to the
+// page's directory, or embedded into the page itself as data URLs.
+func newHTMLPreview(title string, slides []*Slide, dir string, embed bool) (*htmlPreview, error) {
+	preview := &htmlPreview{Title: title}
+	for _, slide := range slides {
+		var src string
+		if embed {
+			data, err := os.ReadFile(slide.PngFile)
+			if err != nil {
+				return nil, err
+			}
+			src = "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+		} else if rel, err := filepath.Rel(dir, slide.PngFile); err == nil {
+			src = filepath.ToSlash(rel)
+		} else {
+			src = filepath.ToSlash(slide.PngFile)
+		}
+		label := slide.Layer
+		if slide.Title != "" {
+			label = slide.Title
+		} else if slide.Image == "" {
+			label = filepath.Base(slide.PngFile)
+		}
+		preview.Slides = append(preview.Slides, &htmlSlide{Src: template.URL(src), Image: slide.Image, Label: label, Seconds: slide.seconds()})
+	}
+	return preview, nil
+}
+
+// Render the preview page.
+func (preview *htmlPreview) render() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := previewTemplate.Execute(&buf, preview); err != nil {
+		return nil, fmt.Errorf("rendering preview page: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Write the preview page for the slides to a file.
+func writeHTMLPreview(filename string, title string, slides []*Slide, embed bool, reveal bool) error {
+	preview, err := newHTMLPreview(title, slides, filepath.Dir(filename), embed)
+	if err != nil {
+		return err
+	}
+	preview.Reveal = reveal
+	page, err := preview.render()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, page, 0644)
+}
@@ -0,0 +1,189 @@
+// Assign human-readable, stable IDs to the elements of a freshly exported SVG
+// which only have editor-generated IDs (or none at all), so that they can be
+// referenced from the YAML without first hand-editing the artwork.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+var slugUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+var autoIDSuffix = regexp.MustCompile(`^[0-9]+(-[0-9]+)?$`)
+
+// The maximum length of a generated ID, before any de-duplication suffix.
+const maxSlugLength = 40
+
+// Report whether an ID is missing or looks like one that Inkscape made up on
+// its own, which is the element's tag name followed by a number (path1234,
+// g56, text12) or "layer" followed by a number for Inkscape layers.
+func hasGeneratedID(element *etree.Element) bool {
+	id := element.SelectAttrValue("id", "")
+	if id == "" {
+		return true
+	}
+	for _, prefix := range []string{element.Tag, "layer"} {
+		if strings.HasPrefix(id, prefix) && autoIDSuffix.MatchString(id[len(prefix):]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Collect all of the character data inside an element, including nested
+// tspan elements, separated by single spaces.
+func elementText(element *etree.Element) string {
+	var parts []string
+	for _, token := range element.Child {
+		switch child := token.(type) {
+		case *etree.CharData:
+			parts = append(parts, child.Data)
+		case *etree.Element:
+			parts = append(parts, elementText(child))
+		}
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+// Turn a label or text content into something usable as an XML ID. Returns
+// an empty string if nothing useful is left.
+func slugify(text string, tag string) string {
+	slug := strings.Trim(slugUnsafe.ReplaceAllString(strings.ToLower(text), "_"), "_")
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[0:maxSlugLength], "_")
+	}
+	if slug != "" && slug[0] >= '0' && slug[0] <= '9' {
+		slug = tag + "_" + slug
+	}
+	return slug
+}
+
+// Derive the readable name for an element from its Inkscape label or, for
+// text elements, from the text that it contains.
+func readableName(element *etree.Element) string {
+	if label := element.SelectAttrValue("inkscape:label", ""); label != "" {
+		return slugify(label, element.Tag)
+	}
+	if element.Tag == "text" {
+		return slugify(elementText(element), element.Tag)
+	}
+	return ""
+}
+
+// Walk the whole document in order and give a readable ID to every element
+// that only has a generated one. Existing references to the old IDs are
+// rewritten to match. Returns the renames as old → new (old may be empty).
+func assignIDs(doc *etree.Document) [][2]string {
+	used := make(map[string]bool)
+	var elements []*etree.Element
+	var walk func(element *etree.Element)
+	walk = func(element *etree.Element) {
+		elements = append(elements, element)
+		if id := element.SelectAttrValue("id", ""); id != "" {
+			used[id] = true
+		}
+		for _, child := range element.ChildElements() {
+			walk(child)
+		}
+	}
+	if doc.Root() != nil {
+		walk(doc.Root())
+	}
+
+	var renames [][2]string
+	for _, element := range elements {
+		// The text of a tspan already names its parent text element.
+		if element.Tag == "tspan" && element.SelectAttr("inkscape:label") == nil {
+			continue
+		}
+		if !hasGeneratedID(element) {
+			continue
+		}
+		name := readableName(element)
+		if name == "" {
+			continue
+		}
+
+		newID := name
+		for n := 2; used[newID]; n++ {
+			newID = fmt.Sprintf("%s_%d", name, n)
+		}
+		used[newID] = true
+
+		oldID := element.SelectAttrValue("id", "")
+		element.CreateAttr("id", newID)
+		renames = append(renames, [2]string{oldID, newID})
+	}
+
+	rewriteReferences(elements, renames)
+	return renames
+}
+
+// Update href="#old" and url(#old) references throughout the document so
+// that renamed elements are still found by whatever pointed at them.
+func rewriteReferences(elements []*etree.Element, renames [][2]string) {
+	replacements := make(map[string]string)
+	for _, rename := range renames {
+		if rename[0] != "" {
+			replacements[rename[0]] = rename[1]
+		}
+	}
+	if len(replacements) == 0 {
+		return
+	}
+
+	urlRef := regexp.MustCompile(`url\(\s*#([^)\s]+)\s*\)`)
+	for _, element := range elements {
+		for i := range element.Attr {
+			attr := &element.Attr[i]
+			if strings.HasPrefix(attr.Value, "#") {
+				if newID, ok := replacements[attr.Value[1:]]; ok {
+					attr.Value = "#" + newID
+				}
+			}
+			attr.Value = urlRef.ReplaceAllStringFunc(attr.Value, func(ref string) string {
+				oldID := urlRef.FindStringSubmatch(ref)[1]
+				if newID, ok := replacements[oldID]; ok {
+					return "url(#" + newID + ")"
+				}
+				return ref
+			})
+		}
+	}
+}
+
+// Entry point for "bulletpointer assign-ids in.svg [out.svg]". Without an
+// output file, the input file is updated in place.
+func assignIDsCommand(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		log.Fatalln("Usage: bulletpointer assign-ids /path/to/in.svg [/path/to/out.svg]")
+	}
+	inFile := args[0]
+	outFile := inFile
+	if len(args) == 2 {
+		outFile = args[1]
+	}
+
+	doc := etree.NewDocument()
+	if err := readSVG(doc, inFile); err != nil {
+		log.Fatalf("Error reading SVG XML file: %s\n", err.Error())
+	}
+
+	for _, rename := range assignIDs(doc) {
+		oldID := rename[0]
+		if oldID == "" {
+			oldID = "(none)"
+		}
+		fmt.Fprintf(os.Stdout, "%s -> %s\n", oldID, rename[1])
+	}
+
+	if err := writeSVG(doc, outFile); err != nil {
+		log.Fatalf("Problem writing to %s: %s\n", outFile, err.Error())
+	}
+}
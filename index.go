@@ -0,0 +1,163 @@
+// Look elements up by ID, Inkscape label or class through an index of the
+// document, rather than searching the whole tree for every reference.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// The namespace of Inkscape's own attributes, whatever prefix a document
+// happens to bind it to.
+const inkscapeNamespace = "http://www.inkscape.org/namespaces/inkscape"
+
+// Represent the lookups for a document. The index has to be refreshed after
+// anything which adds or removes elements, or changes their IDs. Lines holds
+// where each ID appears in the original file, for pointing at duplicates;
+// it is only worked out (from linesFile) once a message needs it, since that
+// means reading the whole file again.
+type elementIndex struct {
+	doc *etree.Document
+	linesFile string
+	lines map[string][]int
+	ids map[string][]*etree.Element
+	labels map[string][]*etree.Element
+	classes map[string][]*etree.Element
+}
+
+// Index a document, with the line numbers of its IDs to be found in the
+// file it was read from, if there is one.
+func newElementIndex(doc *etree.Document, linesFile string) *elementIndex {
+	index := &elementIndex{doc: doc, linesFile: linesFile}
+	index.refresh()
+	return index
+}
+
+// Rebuild the index from the document as it is now.
+func (index *elementIndex) refresh() {
+	index.ids = make(map[string][]*etree.Element)
+	index.labels = make(map[string][]*etree.Element)
+	index.classes = make(map[string][]*etree.Element)
+	var walk func(element *etree.Element)
+	walk = func(element *etree.Element) {
+		for _, attr := range element.Attr {
+			switch {
+			case attr.Key == "id" && (attr.Space == "" || attr.Space == "xml"):
+				index.ids[attr.Value] = append(index.ids[attr.Value], element)
+			case attr.Key == "label" && attr.NamespaceURI() == inkscapeNamespace:
+				index.labels[attr.Value] = append(index.labels[attr.Value], element)
+			case attr.Key == "class" && attr.Space == "":
+				for _, class := range strings.Fields(attr.Value) {
+					index.classes[class] = append(index.classes[class], element)
+				}
+			}
+		}
+		for _, child := range element.ChildElements() {
+			walk(child)
+		}
+	}
+	if root := index.doc.Root(); root != nil {
+		walk(root)
+	}
+}
+
+// Find the elements a selector refers to, which is an element ID ("title"
+// or "#title"), an Inkscape label ("label:Title") or a class
+// ("class:bullet"). An ID has to match exactly one element; a label or a
+// class has to match at least one.
+func (index *elementIndex) resolve(selector string) ([]*etree.Element, error) {
+	if label, ok := strings.CutPrefix(selector, "label:"); ok {
+		if len(index.labels[label]) == 0 {
+			return nil, fmt.Errorf("no element is labelled %q", label)
+		}
+		return index.labels[label], nil
+	}
+	if class, ok := strings.CutPrefix(selector, "class:"); ok {
+		if len(index.classes[class]) == 0 {
+			return nil, fmt.Errorf("no element has class %q", class)
+		}
+		return index.classes[class], nil
+	}
+
+	id := strings.TrimPrefix(selector, "#")
+	elements := index.ids[id]
+	if len(elements) != 1 {
+		return nil, fmt.Errorf("expected one #%s element; found %d%s", id, len(elements), index.where(id))
+	}
+	return elements, nil
+}
+
+// Find the single element a selector refers to, as for resolve, where a label
+// or class also has to match exactly one element.
+func (index *elementIndex) findOne(selector string) (*etree.Element, error) {
+	elements, err := index.resolve(selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) != 1 {
+		return nil, fmt.Errorf("expected %s to match one element; found %d", selector, len(elements))
+	}
+	return elements[0], nil
+}
+
+// Describe where an ID appears in the original file, if it is more than once.
+func (index *elementIndex) where(id string) string {
+	if index.lines == nil && index.linesFile != "" {
+		index.lines = idLines(index.linesFile)
+		index.linesFile = ""
+	}
+	lines := index.lines[id]
+	if len(lines) < 2 {
+		return ""
+	}
+	var numbers []string
+	for _, line := range lines {
+		numbers = append(numbers, fmt.Sprint(line))
+	}
+	return fmt.Sprintf(" (lines %s)", strings.Join(numbers, ", "))
+}
+
+// Describe each ID which is used by more than one element, in order.
+func (index *elementIndex) duplicates() []string {
+	var problems []string
+	for id, elements := range index.ids {
+		if len(elements) > 1 {
+			problems = append(problems, fmt.Sprintf("#%s is used by %d elements%s", id, len(elements), index.where(id)))
+		}
+	}
+	slices.Sort(problems)
+	return problems
+}
+
+// Find the line of each element ID in an XML file. Problems (which the full
+// parse will report anyway) just mean that there are no line numbers.
+func idLines(filename string) map[string][]int {
+	reader, err := openSVG(filename)
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+	lines := make(map[string][]int)
+	decoder := xml.NewDecoder(reader)
+	decoder.Strict = false
+	for {
+		token, err := decoder.RawToken()
+		if err != nil {
+			break
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "id" && (attr.Name.Space == "" || attr.Name.Space == "xml") {
+					line, _ := decoder.InputPos()
+					lines[attr.Value] = append(lines[attr.Value], line)
+				}
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+const indexTestSVG = `<svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape">
+  <g id="layer1" inkscape:label="Intro">
+    <text id="title" class="heading big">Title</text>
+    <text id="twice">One</text>
+    <text id="twice" class="bullet">Two</text>
+  </g>
+  <g id="layer2" inkscape:label="Bullets">
+    <text id="b1" class="bullet">First</text>
+  </g>
+  <g id="layer3" inkscape:label="Bullets"/>
+</svg>
+`
+
+// Index the test document, read from a file so that duplicates can be
+// pointed at by line.
+func indexTestDocument(t *testing.T) *elementIndex {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "deck.svg")
+	if err := os.WriteFile(file, []byte(indexTestSVG), 0644); err != nil {
+		t.Fatal(err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(file); err != nil {
+		t.Fatal(err)
+	}
+	return newElementIndex(doc, file)
+}
+
+func TestElementIndexFindOne(t *testing.T) {
+	index := indexTestDocument(t)
+	tests := []struct {
+		selector string
+		id string
+		err string
+	}{
+		{selector: "title", id: "title"},
+		{selector: "#title", id: "title"},
+		{selector: "label:Intro", id: "layer1"},
+		{selector: "class:heading", id: "title"},
+		{selector: "class:big", id: "title"},
+		{selector: "missing", err: "expected one #missing element; found 0"},
+		{selector: "twice", err: "expected one #twice element; found 2 (lines 4, 5)"},
+		{selector: "label:Bullets", err: "expected label:Bullets to match one element; found 2"},
+		{selector: "class:bullet", err: "expected class:bullet to match one element; found 2"},
+		{selector: "label:Outro", err: `no element is labelled "Outro"`},
+		{selector: "class:small", err: `no element has class "small"`},
+	}
+	for _, test := range tests {
+		element, err := index.findOne(test.selector)
+		switch {
+		case test.err != "":
+			if err == nil || err.Error() != test.err {
+				t.Errorf("findOne(%q) error = %v, want %q", test.selector, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("findOne(%q) error = %v", test.selector, err)
+		case element.SelectAttrValue("id", "") != test.id:
+			t.Errorf("findOne(%q) = #%s, want #%s", test.selector, element.SelectAttrValue("id", ""), test.id)
+		}
+	}
+}
+
+func TestElementIndexResolve(t *testing.T) {
+	index := indexTestDocument(t)
+	tests := []struct {
+		selector string
+		ids []string
+	}{
+		{selector: "label:Bullets", ids: []string{"layer2", "layer3"}},
+		{selector: "class:bullet", ids: []string{"twice", "b1"}},
+		{selector: "b1", ids: []string{"b1"}},
+	}
+	for _, test := range tests {
+		elements, err := index.resolve(test.selector)
+		if err != nil {
+			t.Errorf("resolve(%q) error = %v", test.selector, err)
+			continue
+		}
+		var ids []string
+		for _, element := range elements {
+			ids = append(ids, element.SelectAttrValue("id", ""))
+		}
+		if strings.Join(ids, " ") != strings.Join(test.ids, " ") {
+			t.Errorf("resolve(%q) = %v, want %v", test.selector, ids, test.ids)
+		}
+	}
+}
+
+func TestElementIndexWhere(t *testing.T) {
+	tests := []struct {
+		id string
+		linesFile bool
+		want string
+	}{
+		{id: "twice", linesFile: true, want: " (lines 4, 5)"},
+		{id: "title", linesFile: true, want: ""},
+		{id: "missing", linesFile: true, want: ""},
+		{id: "twice", linesFile: false, want: ""},
+	}
+	for _, test := range tests {
+		index := indexTestDocument(t)
+		if !test.linesFile {
+			index.linesFile = ""
+		}
+		if got := index.where(test.id); got != test.want {
+			t.Errorf("where(%q) with linesFile %v = %q, want %q", test.id, test.linesFile, got, test.want)
+		}
+	}
+}
+
+func TestElementIndexDuplicates(t *testing.T) {
+	index := indexTestDocument(t)
+	want := []string{"#twice is used by 2 elements (lines 4, 5)"}
+	if got := index.duplicates(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("duplicates() = %q, want %q", got, want)
+	}
+}
+
+func TestElementIndexOverlays(t *testing.T) {
+	index := indexTestDocument(t)
+	dir := t.TempDir()
+	overlaySVG := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape" width="100" height="50">
+  <text id="logo" class="brand" inkscape:label="Logo">Logo</text>
+</svg>
+`
+	if err := os.WriteFile(filepath.Join(dir, "logo.svg"), []byte(overlaySVG), 0644); err != nil {
+		t.Fatal(err)
+	}
+	selectors := []string{"logo", "class:brand", "label:Logo"}
+
+	overlays, err := insertOverlays([]*Overlay{{File: "logo.svg"}}, index, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, selector := range selectors {
+		if _, err := index.findOne(selector); err != nil {
+			t.Errorf("after inserting the overlay, findOne(%q) error = %v", selector, err)
+		}
+	}
+	if _, err := index.findOne("title"); err != nil {
+		t.Errorf("after inserting the overlay, findOne(%q) error = %v", "title", err)
+	}
+
+	removeOverlays(overlays, index)
+	for _, selector := range selectors {
+		if _, err := index.findOne(selector); err == nil {
+			t.Errorf("after removing the overlay, findOne(%q) still finds it", selector)
+		}
+	}
+	if _, err := index.findOne("title"); err != nil {
+		t.Errorf("after removing the overlay, findOne(%q) error = %v", "title", err)
+	}
+
+	if _, err := insertOverlays([]*Overlay{{File: "logo.svg"}, {File: "logo.svg"}}, index, dir); err == nil {
+		t.Errorf("inserting the same overlay twice did not fail on its duplicate ID")
+	}
+	if _, err := index.findOne("logo"); err == nil {
+		t.Errorf("after a failed insert, findOne(%q) still finds the first overlay", "logo")
+	}
+}
+
+// Index the large SVG, which is done once for each image and again after any
+// layer with transforms. Reading the line numbers of every ID along with it
+// is what was done before they were only read for a message.
+func BenchmarkElementIndex(b *testing.B) {
+	file, _ := writeLargeTestSVG(b)
+	doc := readLargeTestSVG(b, file)
+	b.Run("with the line numbers", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			index := newElementIndex(doc, "")
+			index.lines = idLines(file)
+		}
+	})
+	b.Run("without the line numbers", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			newElementIndex(doc, file)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+// Print the structure of an SVG, to help with writing the hide/show lists
+// for its layers without reading through the raw XML.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Report whether an element itself is set not to display, either through its
+// style attribute or the display presentation attribute.
+func displayNone(element *etree.Element) bool {
+	return styleValue(element, "display") == "none"
+}
+
+// Select which elements are listed by inspect. An empty filter matches
+// everything.
+type inspectFilter struct {
+	tag string
+	class string
+}
+
+// Report whether an element passes the filter.
+func (filter *inspectFilter) matches(element *etree.Element) bool {
+	if filter.tag != "" && element.Tag != filter.tag {
+		return false
+	}
+	if filter.class != "" && !slices.Contains(strings.Fields(element.SelectAttrValue("class", "")), filter.class) {
+		return false
+	}
+	return true
+}
+
+// Describe a single element on one line: its tag, ID, Inkscape label, the
+// start of its text and whether it is currently displayed.
+func describeElement(element *etree.Element, parentHidden bool) string {
+	var parts []string
+	tag := element.Tag
+	if isInkscapeLayer(element) {
+		tag = "layer"
+	}
+	parts = append(parts, tag)
+	if id := element.SelectAttrValue("id", ""); id != "" {
+		parts = append(parts, "#"+id)
+	}
+	if label := element.SelectAttrValue("inkscape:label", ""); label != "" {
+		parts = append(parts, fmt.Sprintf("%q", label))
+	}
+	if element.Tag == "text" {
+		text := elementText(element)
+		if runes := []rune(text); len(runes) > 40 {
+			text = string(runes[:40]) + "..."
+		}
+		parts = append(parts, fmt.Sprintf("text=%q", text))
+	}
+	if displayNone(element) {
+		parts = append(parts, "[hidden]")
+	} else if parentHidden {
+		parts = append(parts, "[hidden by parent]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Write the element tree, indenting children under their parents. Only
+// elements which match the filter are written, along with their ancestors
+// so that it is still clear where they are. Returns whether anything under
+// the element matched.
+func writeElementTree(w io.Writer, element *etree.Element, depth int, parentHidden bool, filter *inspectFilter) bool {
+	hidden := parentHidden || displayNone(element)
+	var below strings.Builder
+	matched := false
+	for _, child := range element.ChildElements() {
+		if writeElementTree(&below, child, depth+1, hidden, filter) {
+			matched = true
+		}
+	}
+	if !matched && !filter.matches(element) {
+		return false
+	}
+	fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", depth), describeElement(element, parentHidden))
+	io.WriteString(w, below.String())
+	return true
+}
+
+// Entry point for "bulletpointer inspect file.svg".
+func inspectCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] file.svg")
+	filter := &inspectFilter{}
+	flags.StringVar(&filter.tag, "tag", "", "only list elements with this tag name (and their ancestors)")
+	flags.StringVar(&filter.class, "class", "", "only list elements with this class (and their ancestors)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	doc := etree.NewDocument()
+	if err := readSVG(doc, flags.Arg(0)); err != nil {
+		log.Fatalf("Error reading SVG XML file: %s\n", err.Error())
+	}
+	if doc.Root() != nil {
+		writeElementTree(os.Stdout, doc.Root(), 0, false, filter)
+	}
+}
@@ -0,0 +1,39 @@
+// Treat one group of a large SVG as if it were the whole drawing, so that a
+// master file can hold many slides side by side instead of one per file.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// The elements kept alongside the isolated one, since they describe the
+// document (or hold things it may refer to) rather than being drawn.
+var documentElements = []string{"defs", "style", "metadata", "namedview", "title", "desc", "script"}
+
+// Strip the document down to the element with the given ID: every element
+// outside it is removed, apart from its ancestors and the definitions and
+// other non-drawing elements along the way.
+func isolateElement(index *elementIndex, id string) error {
+	if id == "" {
+		return nil
+	}
+	element, err := index.findOne(id)
+	if err != nil {
+		return fmt.Errorf("root_id: %w", err)
+	}
+	for current := element; current != index.doc.Root(); current = current.Parent() {
+		parent := current.Parent()
+		if parent == nil {
+			break
+		}
+		for _, sibling := range parent.ChildElements() {
+			if sibling != current && !slices.Contains(documentElements, sibling.Tag) {
+				parent.RemoveChild(sibling)
+			}
+		}
+	}
+	index.refresh()
+	return nil
+}
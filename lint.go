@@ -0,0 +1,262 @@
+// Point out configs which are valid but probably not what was meant: layers
+// which contradict themselves or change nothing, artwork which no layer ever
+// shows, and IDs in the SVG which nothing refers to.
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// The most unreferenced IDs listed for an image before the rest are counted.
+const maxLintIDs = 10
+
+// Find the IDs which attribute values refer to: href="#id" and url(#id).
+var idReference = regexp.MustCompile(`^#(.+)$|url\(\s*#([^)\s]+)\s*\)`)
+
+// Collect an image's lint warnings, where each is prefixed with the config
+// file (and line) and the image or layer it is about.
+type linter struct {
+	image *Image
+	warnings []string
+}
+
+// Add a warning about a layer, or about the image when there is no layer.
+func (lint *linter) warn(layer *ImageLayer, format string, args ...any) {
+	where := lint.image.configFile + ": " + lint.image.Filename
+	if layer != nil {
+		where = fmt.Sprintf("%s:%d: %s layer %s", lint.image.configFile, layer.line, lint.image.Filename, layer.Suffix)
+	}
+	lint.warnings = append(lint.warnings, where+": "+fmt.Sprintf(format, args...))
+}
+
+// Check the layers against each other, without looking at the SVG: those
+// which show something they also hide, show it twice, or show it again when
+// an earlier layer already did (and nothing has hidden it since).
+func (lint *linter) checkLayers() {
+	if err := lint.image.validateSuffixes(false); err != nil {
+		lint.warn(nil, "%s", strings.TrimPrefix(err.Error(), lint.image.Filename+": "))
+	}
+	shownBy := make(map[string]string)
+	for _, layer := range lint.image.Layers {
+		for _, selector := range layer.ShowIDs {
+			if slices.Contains(layer.HideIDs, selector) {
+				lint.warn(layer, "%s is in both hide_ids and show_ids (so it is shown)", selector)
+			}
+		}
+		for _, ids := range [][]string{layer.HideIDs, layer.ShowIDs} {
+			seen := make(map[string]bool)
+			for _, selector := range ids {
+				if seen[selector] {
+					lint.warn(layer, "%s is listed twice", selector)
+				}
+				seen[selector] = true
+			}
+		}
+		for _, selector := range layer.HideIDs {
+			delete(shownBy, selector)
+		}
+		for _, selector := range layer.ShowIDs {
+			if other, ok := shownBy[selector]; ok && !slices.Contains(layer.HideIDs, selector) {
+				lint.warn(layer, "shows %s, which layer %s already showed", selector, other)
+			}
+			shownBy[selector] = layer.Suffix
+		}
+	}
+}
+
+// List every selector the image's config refers to elements by.
+func (image *Image) selectors() []string {
+	selectors := slices.Concat([]string{image.RootID}, image.backdropIDs())
+	if image.Numbering != nil {
+		selectors = append(selectors, image.Numbering.ID, image.Numbering.ProgressID)
+	}
+	for _, ids := range image.Locales {
+		selectors = append(selectors, slices.Collect(maps.Keys(ids))...)
+	}
+	transforms := slices.Clone(image.Transforms)
+	for _, layer := range image.Layers {
+		selectors = slices.Concat(selectors, layer.HideIDs, layer.ShowIDs, layer.RemoveIDs)
+		for _, variant := range layer.Variants {
+			selectors = slices.Concat(selectors, variant.HideIDs, variant.ShowIDs)
+		}
+		for _, spec := range layer.CloneIDs {
+			selectors = append(selectors, spec.ID)
+		}
+		selectors = append(selectors, slices.Collect(maps.Keys(layer.SetAttrs))...)
+		selectors = append(selectors, slices.Collect(maps.Keys(layer.RemoveAttrs))...)
+		if layer.Expect != nil {
+			selectors = slices.Concat(selectors, layer.Expect.Visible, layer.Expect.Hidden)
+		}
+		transforms = append(transforms, layer.Transforms...)
+	}
+	for _, spec := range transforms {
+		selectors = append(selectors, spec.Options["id"])
+	}
+	return slices.DeleteFunc(selectors, func(selector string) bool { return selector == "" })
+}
+
+// Find the named elements of the SVG which neither the config nor the SVG
+// itself refers to. Anything inside a referenced element is taken to be
+// referenced through it, as is anything inside one that is reported.
+func (lint *linter) checkReferences(index *elementIndex) {
+	referenced := make(map[*etree.Element]bool)
+	for _, selector := range lint.image.selectors() {
+		elements, _ := index.resolve(selector)
+		for _, element := range elements {
+			referenced[element] = true
+		}
+	}
+	for id := range referencedIDs(index.doc) {
+		for _, target := range index.ids[id] {
+			referenced[target] = true
+		}
+	}
+
+	var unreferenced []string
+	var walk func(element *etree.Element)
+	walk = func(element *etree.Element) {
+		for _, child := range element.ChildElements() {
+			switch {
+			case referenced[child] || slices.Contains(documentElements, child.Tag):
+			case !hasGeneratedID(child):
+				unreferenced = append(unreferenced, "#"+child.SelectAttrValue("id", ""))
+			default:
+				walk(child)
+			}
+		}
+	}
+	if root := index.doc.Root(); root != nil {
+		walk(root)
+	}
+	if len(unreferenced) > maxLintIDs {
+		unreferenced = append(unreferenced[:maxLintIDs], fmt.Sprintf("and %d more", len(unreferenced)-maxLintIDs))
+	}
+	if len(unreferenced) > 0 {
+		lint.warn(nil, "the config never refers to %s", strings.Join(unreferenced, ", "))
+	}
+}
+
+// Apply the layers to the SVG in turn, as a render would, to find those
+// which leave the document just as the layer before did, and the groups
+// which are hidden in every layer.
+func (lint *linter) checkDocument(fetcher *remoteFetcher) error {
+	image := lint.image
+	inFile, err := image.sourceFile(fetcher)
+	if err != nil {
+		return err
+	}
+	doc := etree.NewDocument()
+	if err := readSVG(doc, inFile); err != nil {
+		return fmt.Errorf("%s: error reading SVG XML file: %w", image.Filename, err)
+	}
+	index := newElementIndex(doc, inFile)
+	if err := isolateElement(index, image.RootID); err != nil {
+		return fmt.Errorf("%s: %w", image.Filename, err)
+	}
+	lint.checkReferences(index)
+	if _, err := insertOverlays(image.Overlays, index, image.baseDir); err != nil {
+		return fmt.Errorf("%s: %w", image.Filename, err)
+	}
+	if err := substituteText(doc, image.textVariables(nil)); err != nil {
+		return fmt.Errorf("%s: %w", image.Filename, err)
+	}
+
+	groups := doc.FindElements("//g")
+	shown := make(map[*etree.Element]bool)
+	run := &Run{}
+	var previous [sha256.Size]byte
+	var previousOptions ExportOptions
+	for i, layer := range image.Layers {
+		slide := &Slide{Image: image.Filename, Layer: layer.Suffix}
+		if err := layer.processImageLayer(run, image, index, slide, false); err != nil {
+			return fmt.Errorf("%s layer %s: %w", image.Filename, layer.Suffix, err)
+		}
+		data, err := doc.WriteToBytes()
+		if err != nil {
+			return err
+		}
+		state, options := sha256.Sum256(data), layer.exportOptions(image)
+		if i > 0 && state == previous && reflect.DeepEqual(options, previousOptions) && len(layer.Overlays) == 0 && layer.Camera == nil {
+			lint.warn(layer, "looks just the same as layer %s before it", image.Layers[i-1].Suffix)
+		}
+		previous, previousOptions = state, options
+		for _, group := range groups {
+			if !shown[group] && isVisible(group) {
+				shown[group] = true
+			}
+		}
+	}
+
+	// Only the outermost of the hidden groups is worth naming.
+	var hidden []string
+	for _, group := range groups {
+		if shown[group] || group.Parent() == nil || group.Parent().Tag == "defs" {
+			continue
+		}
+		if parent := group.Parent(); parent.Tag == "g" && !shown[parent] {
+			continue
+		}
+		if len(group.ChildElements()) > 0 {
+			hidden = append(hidden, elementName(group))
+		}
+	}
+	if len(hidden) > 0 && len(image.Layers) > 0 {
+		lint.warn(nil, "no layer shows %s", strings.Join(hidden, ", "))
+	}
+	return nil
+}
+
+// Entry point for "bulletpointer lint [options] in.yaml...", which exits
+// with 1 if there is anything to warn about.
+func lintCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] in.yaml...")
+	options := &RenderOptions{}
+	options.registerFlags(flags)
+	flags.Parse(args)
+	if err := options.takePositional(flags.Args(), false); err != nil {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	images, configs, err := options.loadImages()
+	if err != nil {
+		fatal("", &ConfigError{err})
+	}
+	fetcher, err := newRemoteFetcher(options.CacheDir)
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	// Images which share an SVG would otherwise repeat its warnings.
+	printed := make(map[string]bool)
+	warnings := 0
+	for _, image := range images {
+		lint := &linter{image: image}
+		lint.checkLayers()
+		if err := lint.checkDocument(fetcher); err != nil {
+			log.Printf("%s (run validate for the details)\n", err.Error())
+			warnings++
+		}
+		for _, warning := range lint.warnings {
+			if !printed[warning] {
+				printed[warning] = true
+				fmt.Println(warning)
+				warnings++
+			}
+		}
+	}
+	if warnings > 0 {
+		os.Exit(1)
+	}
+	infof("Nothing to warn about in %s\n", strings.Join(configs, ", "))
+}
@@ -0,0 +1,49 @@
+// Render the same deck in several languages, by swapping the text of its
+// elements for translations instead of keeping a copy of the SVG per
+// language.
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// List every locale which any of the images has translations for, in order.
+func localeNames(images []*Image) []string {
+	var names []string
+	for _, image := range images {
+		for name := range image.Locales {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Check that the image's locale names can be used as directory names.
+func (image *Image) validateLocales() error {
+	for name := range image.Locales {
+		if name == "" || !safeSuffix.MatchString(name) || name == "." || name == ".." {
+			return fmt.Errorf("%s: locale %q should only contain [A-Za-z0-9._-]", image.Filename, name)
+		}
+	}
+	return nil
+}
+
+// Replace the text of the elements that the locale translates. An image with
+// no translations for the locale is left as it is.
+func (image *Image) applyLocale(index *elementIndex, locale string) error {
+	translations := image.Locales[locale]
+	for _, id := range slices.Sorted(maps.Keys(translations)) {
+		element, err := index.findOne(id)
+		if err != nil {
+			return fmt.Errorf("locale %s: %w", locale, err)
+		}
+		setElementText(element, translations[id])
+	}
+	return nil
+}
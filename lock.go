@@ -0,0 +1,145 @@
+// Keep two runs from writing to the same output directory at once, which
+// otherwise interleave their outputs without either of them noticing. The
+// lock is advisory: a file in the output directory naming the run which
+// holds it.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The name of the lock file, which is left out of listings of the outputs.
+const lockFileName = ".bulletpointer.lock"
+
+// The locks this run holds, by lock file, for releasing on the way out of a
+// fatal error (which doesn't run the deferred unlocks).
+var heldLocks sync.Map
+
+// Represent the run which holds an output directory's lock.
+type lockHolder struct {
+	Pid int `json:"pid"`
+	Host string `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+// Report whether a process on this machine is still running.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// Finding it at all means that it is there.
+		return true
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Read the holder of a lock. A run which died without removing its lock
+// (when killed outright, say) leaves a stale one behind, which is recognised
+// by its process being gone; one held from another machine can't be checked.
+func readLock(filename string) (holder *lockHolder, stale bool, err error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, false, err
+	}
+	holder = &lockHolder{}
+	if err := json.Unmarshal(data, holder); err != nil {
+		// Either another run is halfway through writing it, or it is
+		// garbage; only the second lasts.
+		stat, statErr := os.Stat(filename)
+		return nil, statErr == nil && time.Since(stat.ModTime()) > 10*time.Second, nil
+	}
+	host, _ := os.Hostname()
+	return holder, holder.Host == host && !processAlive(holder.Pid), nil
+}
+
+// Lock an output directory for this run, returning the function which
+// unlocks it again. With force, a lock which some other run holds is taken
+// over rather than given up on.
+func lockOutDir(dir string, force bool) (func(), error) {
+	filename := filepath.Join(dir, lockFileName)
+	host, _ := os.Hostname()
+	holder := &lockHolder{Pid: os.Getpid(), Host: host, Started: time.Now().UTC().Truncate(time.Second)}
+	data, err := json.Marshal(holder)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = file.Write(data)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(filename)
+				return nil, fmt.Errorf("could not write %s: %w", filename, err)
+			}
+			heldLocks.Store(filename, holder)
+			return func() { unlockOutDir(filename, holder) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("could not lock %s: %w", dir, err)
+		}
+
+		other, stale, err := readLock(filename)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Unlocked in the meantime.
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", filename, err)
+		}
+		switch {
+		case stale && other != nil:
+			log.Printf("WARNING taking over the lock on %s left by process %d, which is gone\n", dir, other.Pid)
+		case stale:
+			log.Printf("WARNING replacing the unreadable lock file %s\n", filename)
+		case force && other != nil:
+			log.Printf("WARNING taking over the lock on %s from process %d on %s (--force)\n", dir, other.Pid, other.Host)
+		case force:
+			log.Printf("WARNING replacing the lock file %s (--force)\n", filename)
+		case other != nil:
+			return nil, fmt.Errorf("%s is being rendered into by process %d on %s (since %s); use --force if that run is gone",
+				dir, other.Pid, other.Host, other.Started.Local().Format(time.DateTime))
+		default:
+			return nil, fmt.Errorf("%s is being rendered into by another run; use --force if that run is gone", dir)
+		}
+		if err := os.Remove(filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("could not remove %s: %w", filename, err)
+		}
+	}
+	return nil, fmt.Errorf("could not lock %s: other runs keep taking the lock", dir)
+}
+
+// Remove a lock, unless some other run has taken it over with --force in the
+// meantime.
+func unlockOutDir(filename string, holder *lockHolder) {
+	heldLocks.Delete(filename)
+	current, _, err := readLock(filename)
+	if err != nil || current == nil || current.Pid != holder.Pid || current.Host != holder.Host || !current.Started.Equal(holder.Started) {
+		return
+	}
+	os.Remove(filename)
+}
+
+// Remove every lock this run holds, before exiting without unwinding.
+func releaseLocks() {
+	heldLocks.Range(func(filename, holder any) bool {
+		unlockOutDir(filename.(string), holder.(*lockHolder))
+		return true
+	})
+}
@@ -0,0 +1,163 @@
+// Write an index of everything a run produced, so that downstream tools can
+// find the outputs without globbing the output directory.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Represent the whole manifest. Images are keyed by their filename and then
+// by layer suffix; the sequence lists the PNGs in the order they are shown.
+// Interrupted marks the manifest of a run which was stopped partway, which
+// lists only the slides it finished.
+type Manifest struct {
+	Images map[string]map[string]*ManifestEntry `json:"images" yaml:"images"`
+	Generated map[string]*ManifestEntry `json:"generated,omitempty" yaml:"generated,omitempty"`
+	Sequence []string `json:"sequence" yaml:"sequence"`
+	Interrupted bool `json:"interrupted,omitempty" yaml:"interrupted,omitempty"`
+}
+
+// Represent a single output in the manifest. Paths are relative to the
+// directory containing the manifest.
+type ManifestEntry struct {
+	Index int `json:"index" yaml:"index"`
+	Svg string `json:"svg,omitempty" yaml:"svg,omitempty"`
+	Png string `json:"png" yaml:"png"`
+	Sha256 string `json:"sha256" yaml:"sha256"`
+	Width int `json:"width" yaml:"width"`
+	Height int `json:"height" yaml:"height"`
+	Duration float64 `json:"duration,omitempty" yaml:"duration,omitempty"`
+	Title string `json:"title,omitempty" yaml:"title,omitempty"`
+	Notes string `json:"notes,omitempty" yaml:"notes,omitempty"`
+	RenderSeconds float64 `json:"render_seconds,omitempty" yaml:"render_seconds,omitempty"`
+	Frames []string `json:"frames,omitempty" yaml:"frames,omitempty"`
+	Variants map[string]string `json:"variants,omitempty" yaml:"variants,omitempty"`
+	Bounds *ManifestBounds `json:"bounds,omitempty" yaml:"bounds,omitempty"`
+}
+
+// Represent where a slide draws, in pixels of its PNG.
+type ManifestBounds struct {
+	X int `json:"x" yaml:"x"`
+	Y int `json:"y" yaml:"y"`
+	Width int `json:"width" yaml:"width"`
+	Height int `json:"height" yaml:"height"`
+}
+
+// Describe one slide's outputs, with paths relative to the given directory.
+// The SVG is left out when it was only written to a scratch directory.
+func manifestEntry(slide *Slide, index int, dir string, keptSvg bool) (*ManifestEntry, error) {
+	relative := func(file string) string {
+		if rel, err := filepath.Rel(dir, file); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return filepath.ToSlash(file)
+	}
+
+	data, err := os.ReadFile(slide.PngFile)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", slide.PngFile, err)
+	}
+	entry := &ManifestEntry{
+		Index: index,
+		Png: relative(slide.PngFile),
+		Sha256: fmt.Sprintf("%x", sha256.Sum256(data)),
+		Width: config.Width,
+		Height: config.Height,
+		Duration: slide.Duration,
+		Title: slide.Title,
+		Notes: slide.Notes,
+		RenderSeconds: slide.RenderSeconds,
+	}
+	for _, frame := range slide.Frames {
+		entry.Frames = append(entry.Frames, relative(frame))
+	}
+	if bounds := slide.Bounds; bounds != nil {
+		left, top := math.Floor(bounds[0]*float64(config.Width)), math.Floor(bounds[1]*float64(config.Height))
+		right, bottom := math.Ceil((bounds[0]+bounds[2])*float64(config.Width)), math.Ceil((bounds[1]+bounds[3])*float64(config.Height))
+		entry.Bounds = &ManifestBounds{X: int(left), Y: int(top), Width: int(right - left), Height: int(bottom - top)}
+	}
+	for name, variant := range slide.Variants {
+		if entry.Variants == nil {
+			entry.Variants = make(map[string]string)
+		}
+		entry.Variants[name] = relative(variant)
+	}
+	if keptSvg && slide.SvgFile != "" {
+		entry.Svg = relative(slide.SvgFile)
+	}
+	return entry, nil
+}
+
+// Write the manifest for the slides, as YAML if the filename ends in .yaml or
+// .yml and as JSON otherwise.
+func writeManifest(filename string, slides []*Slide, keptSvg bool, interrupted bool) error {
+	manifest := &Manifest{Images: make(map[string]map[string]*ManifestEntry), Sequence: []string{}, Interrupted: interrupted}
+	dir := filepath.Dir(filename)
+	for i, slide := range slides {
+		entry, err := manifestEntry(slide, i, dir, keptSvg)
+		if err != nil {
+			return err
+		}
+		manifest.Sequence = append(manifest.Sequence, entry.Png)
+		if slide.Image == "" {
+			if manifest.Generated == nil {
+				manifest.Generated = make(map[string]*ManifestEntry)
+			}
+			manifest.Generated[entry.Png] = entry
+			continue
+		}
+		if manifest.Images[slide.Image] == nil {
+			manifest.Images[slide.Image] = make(map[string]*ManifestEntry)
+		}
+		manifest.Images[slide.Image][slide.Layer] = entry
+	}
+
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(manifest)
+	default:
+		data, err = json.MarshalIndent(manifest, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// Read a manifest written by an earlier run, as YAML or JSON by its name.
+func readManifest(filename string) (*Manifest, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, manifest)
+	default:
+		err = json.Unmarshal(data, manifest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filename, err)
+	}
+	return manifest, nil
+}
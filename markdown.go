@@ -0,0 +1,238 @@
+// Turn a Markdown outline into a config for a template SVG, so that a plain
+// bullet deck can be written without touching the YAML at all: each heading
+// becomes a slide, its bullets are revealed one at a time, and anything else
+// under it becomes the speaker notes.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	"gopkg.in/yaml.v3"
+)
+
+// Represent one slide of the outline: its heading, its bullets in order and
+// the rest of its text.
+type outlineSlide struct {
+	Title string
+	Bullets []string
+	Notes []string
+}
+
+var (
+	markdownHeading = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*$`)
+	markdownBullet = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+(.*)$`)
+	markdownLink = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	markdownEmphasis = regexp.MustCompile("[*`]+|__")
+	bulletPlaceholder = regexp.MustCompile(`^bullet(\d+)$`)
+)
+
+// Reduce inline Markdown to the plain text it shows: links to their text and
+// emphasis and code marks removed.
+func plainMarkdown(text string) string {
+	text = markdownLink.ReplaceAllString(text, "$1")
+	return strings.TrimSpace(markdownEmphasis.ReplaceAllString(text, ""))
+}
+
+// Split Markdown into slides at its headings. Text before the first heading
+// and fenced code blocks are left out.
+func parseOutline(filename string) ([]*outlineSlide, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var slides []*outlineSlide
+	var current *outlineSlide
+	fenced := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+			continue
+		}
+		if fenced {
+			continue
+		}
+		if match := markdownHeading.FindStringSubmatch(line); match != nil {
+			current = &outlineSlide{Title: plainMarkdown(match[1])}
+			slides = append(slides, current)
+		} else if current == nil || strings.TrimSpace(line) == "" {
+			continue
+		} else if match := markdownBullet.FindStringSubmatch(line); match != nil {
+			current.Bullets = append(current.Bullets, plainMarkdown(match[1]))
+		} else {
+			current.Notes = append(current.Notes, plainMarkdown(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(slides) == 0 {
+		return nil, fmt.Errorf("no headings found in %s to make slides from", filename)
+	}
+	return slides, nil
+}
+
+// Find the bullet slots of a template: the elements holding {{bullet1}},
+// {{bullet2}} and so on, by the ID of the element (or its nearest ancestor
+// with one) to show and hide, in order. The template must also have a
+// {{title}} placeholder.
+func templateSlots(doc *etree.Document) ([]string, error) {
+	slots := make(map[int]string)
+	hasTitle := false
+	for _, element := range doc.FindElements("//*") {
+		for _, token := range element.Child {
+			text, ok := token.(*etree.CharData)
+			if !ok {
+				continue
+			}
+			for _, match := range textPlaceholder.FindAllStringSubmatch(text.Data, -1) {
+				if match[1] == "title" {
+					hasTitle = true
+				}
+				number := bulletPlaceholder.FindStringSubmatch(match[1])
+				if number == nil {
+					continue
+				}
+				slot := element
+				for slot != nil && slot.SelectAttrValue("id", "") == "" {
+					slot = slot.Parent()
+				}
+				if slot == nil {
+					return nil, fmt.Errorf("{{%s}} is not inside an element with an ID (try assign-ids first)", match[1])
+				}
+				n, _ := strconv.Atoi(number[1])
+				slots[n] = slot.SelectAttrValue("id", "")
+			}
+		}
+	}
+	if !hasTitle {
+		return nil, fmt.Errorf("the template has no {{title}} placeholder")
+	}
+	var ids []string
+	for n := 1; n <= len(slots); n++ {
+		id, ok := slots[n]
+		if !ok {
+			return nil, fmt.Errorf("the template has no {{bullet%d}} placeholder, though it has %d bullets", n, len(slots))
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Build a config with one image per slide, all drawn from the template. Each
+// starts with just the title showing and reveals a bullet per layer; the
+// suffixes are numbered by slide, so that the outputs of the slides don't
+// collide.
+func outlineConfig(filename string, slots []string, slides []*outlineSlide) (*yaml.Node, error) {
+	images := &yaml.Node{Kind: yaml.SequenceNode}
+	for i, slide := range slides {
+		if len(slide.Bullets) > len(slots) {
+			return nil, fmt.Errorf("slide %q has %d bullets, but the template only has room for %d", slide.Title, len(slide.Bullets), len(slots))
+		}
+		number := fmt.Sprintf("_%02d", i+1)
+		variables := &yaml.Node{Kind: yaml.MappingNode}
+		variables.Content = append(variables.Content, stringNode("title"), stringNode(slide.Title))
+		for n := range slots {
+			text := ""
+			if n < len(slide.Bullets) {
+				text = slide.Bullets[n]
+			}
+			variables.Content = append(variables.Content, stringNode(fmt.Sprintf("bullet%d", n+1)), stringNode(text))
+		}
+
+		layers := &yaml.Node{Kind: yaml.SequenceNode}
+		first := &yaml.Node{Kind: yaml.MappingNode}
+		first.Content = append(first.Content, stringNode("suffix"), stringNode(number+"_title"), stringNode("title"), stringNode(slide.Title))
+		if len(slide.Notes) > 0 {
+			first.Content = append(first.Content, stringNode("notes"), stringNode(strings.Join(slide.Notes, "\n")))
+		}
+		first.Content = append(first.Content, stringNode("hide_ids"), idListNode(slots))
+		layers.Content = append(layers.Content, first)
+		for n, bullet := range slide.Bullets {
+			layer := &yaml.Node{Kind: yaml.MappingNode, HeadComment: bullet}
+			layer.Content = append(layer.Content,
+				stringNode("suffix"), stringNode(fmt.Sprintf("%s_b%d", number, n+1)),
+				stringNode("show_ids"), idListNode(slots[n:n+1]))
+			layers.Content = append(layers.Content, layer)
+		}
+
+		image := &yaml.Node{Kind: yaml.MappingNode, HeadComment: slide.Title}
+		image.Content = append(image.Content,
+			stringNode("filename"), stringNode(filepath.ToSlash(filename)),
+			stringNode("variables"), variables,
+			stringNode("layers"), layers)
+		images.Content = append(images.Content, image)
+	}
+	return images, nil
+}
+
+// Entry point for "bulletpointer md2config --template deck.svg talk.md
+// [in.yaml]". The config is written to stdout unless a config file is named.
+func md2configCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] talk.md [in.yaml]")
+	templateFile := flags.String("template", "", "the SVG with {{title}} and {{bullet1}}, {{bullet2}}... placeholders to fill in")
+	force := flags.Bool("force", false, "overwrite the config file if it already exists")
+	flags.Parse(args)
+	args = flags.Args()
+	if *templateFile == "" || len(args) < 1 || len(args) > 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	outFile := ""
+	if len(args) == 2 {
+		outFile = args[1]
+	}
+
+	slides, err := parseOutline(args[0])
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	doc := etree.NewDocument()
+	if err := readSVG(doc, *templateFile); err != nil {
+		log.Fatalf("%s: error reading SVG XML file: %s\n", *templateFile, err.Error())
+	}
+	slots, err := templateSlots(doc)
+	if err != nil {
+		log.Fatalf("%s: %s\n", *templateFile, err.Error())
+	}
+	configDir := "."
+	if outFile != "" {
+		configDir = filepath.Dir(outFile)
+	}
+	config, err := outlineConfig(relativeTo(configDir, *templateFile), slots, slides)
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+
+	if outFile == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if _, err := os.Stat(outFile); err == nil && !*force {
+		log.Fatalf("%s already exists (use --force to overwrite it)\n", outFile)
+	}
+	if err := os.WriteFile(outFile, data, 0644); err != nil {
+		log.Fatalf("Problem writing %s: %s\n", outFile, err.Error())
+	}
+	layers := 0
+	for _, slide := range slides {
+		layers += 1 + len(slide.Bullets)
+	}
+	infof("Wrote %s (%d slides, %d layers)\n", outFile, len(slides), layers)
+}
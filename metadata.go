@@ -0,0 +1,71 @@
+// Stamp each exported PNG with where it came from, so that a stray slide can
+// be traced back to the config and layer which produced it.
+
+package main
+
+import (
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// Report the version of the tool, from the module version it was built as,
+// or else the revision of the source tree it was built from.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return "devel-" + setting.Value
+		}
+	}
+	return "devel"
+}
+
+// Build an iTXt chunk (uncompressed UTF-8 text) for a keyword and value.
+func textChunk(keyword string, value string) *pngChunk {
+	data := keyword + "\x00\x00\x00\x00\x00" + value
+	return &pngChunk{Type: "iTXt", Data: []byte(data)}
+}
+
+// Add text chunks to a PNG file recording the source SVG, the layer, the
+// config file (and its hash) and the tool version, plus the layer's title and
+// notes under the standard Title and Description keywords, and the
+// fingerprint of the export's input (if any) for --resume. Any stamp left by
+// an earlier run (or title from the renderer) is replaced.
+func (image *Image) stampPNG(pngFile string, layer string, title string, notes string, fingerprint string) error {
+	stamps := []*pngChunk{
+		textChunk("bulletpointer:source", image.Filename),
+		textChunk("bulletpointer:layer", layer),
+		textChunk("bulletpointer:config", image.configFile),
+		textChunk("bulletpointer:config-sha256", image.configHash),
+		textChunk("bulletpointer:version", toolVersion()),
+	}
+	if fingerprint != "" {
+		stamps = append(stamps, textChunk(fingerprintKeyword, fingerprint))
+	}
+	if title != "" {
+		stamps = append(stamps, textChunk("Title", title))
+	}
+	if notes != "" {
+		stamps = append(stamps, textChunk("Description", notes))
+	}
+	return rewritePNGChunks(pngFile, func(chunks []*pngChunk) []*pngChunk {
+		chunks = slices.DeleteFunc(chunks, func(chunk *pngChunk) bool {
+			if chunk.Type != "iTXt" && chunk.Type != "tEXt" {
+				return false
+			}
+			keyword, _, _ := strings.Cut(string(chunk.Data), "\x00")
+			return strings.HasPrefix(keyword, "bulletpointer:") ||
+				(keyword == "Title" && title != "") || (keyword == "Description" && notes != "")
+		})
+		// Text chunks may go anywhere after the header; straight after it
+		// is where tools look first.
+		return slices.Insert(chunks, 1, stamps...)
+	})
+}
@@ -0,0 +1,62 @@
+// Work out where each output file goes, using a Go template so that the
+// naming scheme can suit whatever sorts the files afterwards.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// The naming used when no template is configured: the SVG's base name with
+// the layer suffix appended.
+const defaultNameTemplate = "{{.ImageBase}}{{.Suffix}}.png"
+
+// Represent the values that are available to an output filename template,
+// for example {{.ImageBase}}/{{printf "%02d" .LayerIndex}}-{{.Suffix}}.png
+type NameFields struct {
+	// The source SVG filename without its directory or extension.
+	ImageBase string
+	// The 1-based position of the layer within the image. Composites are
+	// numbered after the last layer.
+	LayerIndex int
+	Suffix string
+}
+
+// Choose and parse the template for an image, where the image's own template
+// takes precedence over the one given for the whole run.
+func (image *Image) nameTemplate(runTemplate string) (*template.Template, error) {
+	text := defaultNameTemplate
+	if image.NameTemplate != "" {
+		text = image.NameTemplate
+	} else if runTemplate != "" {
+		text = runTemplate
+	}
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name template %q: %w", text, err)
+	}
+	return tmpl, nil
+}
+
+// Expand a name template into the path of the output PNG, relative to the
+// output directory (always with forward slashes). Names that would escape the
+// output directory are rejected, and .png is added when it was left off.
+func outputName(tmpl *template.Template, fields NameFields) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, fields); err != nil {
+		return "", fmt.Errorf("expanding name template: %w", err)
+	}
+
+	name := path.Clean(strings.ReplaceAll(buf.String(), "\\", "/"))
+	if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("name template produced %q, which is outside the output directory", buf.String())
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".png") {
+		name += ".png"
+	}
+	return name, nil
+}
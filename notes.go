@@ -0,0 +1,44 @@
+// Write a companion document with each slide's title and speaker notes, to
+// narrate from while recording.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format a number of seconds as M:SS for the notes.
+func notesTime(seconds float64) string {
+	whole := int(seconds + 0.5)
+	return fmt.Sprintf("%d:%02d", whole/60, whole%60)
+}
+
+// Write the notes for the slides as Markdown: a heading per slide with its
+// title (or layer) and when it comes up, then its notes. The slides without a
+// title or notes still get a heading, so that the numbering matches.
+func writeNotes(filename string, slides []*Slide) error {
+	var buf bytes.Buffer
+	start := 0.0
+	for i, slide := range slides {
+		title := slide.Title
+		if title == "" {
+			title = strings.TrimSpace(slide.Image + " " + slide.Layer)
+		}
+		if title == "" {
+			title = filepath.Base(slide.PngFile)
+		}
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "## %d. %s (%s)\n", i+1, title, notesTime(start))
+		if notes := strings.TrimSpace(slide.Notes); notes != "" {
+			fmt.Fprintf(&buf, "\n%s\n", notes)
+		}
+		start += slide.seconds()
+	}
+	return os.WriteFile(filename, buf.Bytes(), 0644)
+}
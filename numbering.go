@@ -0,0 +1,57 @@
+// Number the slides across the whole deck, as text or as a progress bar, so
+// that the numbers stay right however the deck is edited.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Represent where the slide's position in the deck is shown: a text element
+// which gets "current/total" (or the format, with the two numbers given to it
+// in that order), and a rect whose width grows from nothing to its full
+// width as drawn over the course of the deck.
+type SlideNumbering struct {
+	ID string `yaml:"id,omitempty"`
+	Format string `yaml:"format,omitempty"`
+	ProgressID string `yaml:"progress_id,omitempty"`
+}
+
+// The attribute which remembers a progress bar's full width, since the
+// document is shared between the layers and each changes it.
+const fullWidthAttr = "data-bulletpointer-full-width"
+
+// Show the slide's number (from 1) and the total in the document. Nothing
+// happens without numbering.
+func (numbering *SlideNumbering) apply(index *elementIndex, number int, total int) error {
+	if numbering == nil || total == 0 {
+		return nil
+	}
+	if numbering.ID != "" {
+		element, err := index.findOne(numbering.ID)
+		if err != nil {
+			return fmt.Errorf("slide number: %w", err)
+		}
+		format := numbering.Format
+		if format == "" {
+			format = "%d/%d"
+		}
+		setElementText(element, fmt.Sprintf(format, number, total))
+	}
+	if numbering.ProgressID != "" {
+		element, err := index.findOne(numbering.ProgressID)
+		if err != nil {
+			return fmt.Errorf("progress bar: %w", err)
+		}
+		full := element.SelectAttrValue(fullWidthAttr, element.SelectAttrValue("width", ""))
+		width, err := strconv.ParseFloat(strings.TrimSuffix(full, "px"), 64)
+		if err != nil {
+			return fmt.Errorf("progress bar #%s needs a numeric width, not %q", numbering.ProgressID, full)
+		}
+		element.CreateAttr(fullWidthAttr, full)
+		element.CreateAttr("width", strconv.FormatFloat(width*float64(number)/float64(total), 'f', -1, 64))
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+// Slim a document down to what the renderer draws before it is exported: the
+// editor's own markup (Inkscape's and Sodipodi's namespaces and the RDF
+// metadata), definitions which nothing uses, and elements which the layer
+// hides. None of it makes a difference to the PNG, but all of it has to be
+// written out and then parsed again by the renderer.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// The namespaces of editor markup, which renderers ignore, by their usual
+// prefixes.
+var editorNamespaces = map[string]string{
+	"inkscape": "http://www.inkscape.org/namespaces/inkscape",
+	"sodipodi": "http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd",
+}
+
+// Report whether a name is in one of the editor's namespaces, going by its
+// namespace or, where that isn't declared, its prefix.
+func isEditorMarkup(prefix string, uri string) bool {
+	if uri != "" {
+		return slices.Contains(slices.Collect(maps.Values(editorNamespaces)), uri)
+	}
+	return editorNamespaces[prefix] != ""
+}
+
+// The definitions which are used by name rather than by ID, which stay
+// whatever refers to them.
+var keptDefinitions = []string{"style", "script", "font", "font-face"}
+
+// The elements whose contents are only drawn where something refers to them,
+// so that being hidden doesn't mean that they are unused.
+var referencedElements = []string{"defs", "symbol", "clipPath", "mask", "pattern", "marker"}
+
+// Add the IDs which an element refers to, by its attributes (href="#id" and
+// url(#id)) or, for a style sheet, its text.
+func addReferences(element *etree.Element, ids map[string]bool) {
+	values := make([]string, 0, len(element.Attr)+1)
+	if element.Tag == "style" {
+		values = append(values, element.Text())
+	}
+	for _, attr := range element.Attr {
+		values = append(values, attr.Value)
+	}
+	for _, value := range values {
+		if !strings.Contains(value, "#") {
+			continue
+		}
+		for _, match := range idReference.FindAllStringSubmatch(value, -1) {
+			ids[match[1]+match[2]] = true
+		}
+	}
+}
+
+// Collect the IDs which anything in the document refers to.
+func referencedIDs(doc *etree.Document) map[string]bool {
+	ids := make(map[string]bool)
+	for _, element := range doc.FindElements("//*") {
+		addReferences(element, ids)
+	}
+	return ids
+}
+
+// Report whether an element, or anything inside it, has one of the IDs.
+func containsID(element *etree.Element, ids map[string]bool) bool {
+	if ids[element.SelectAttrValue("id", "")] {
+		return true
+	}
+	for _, child := range element.ChildElements() {
+		if containsID(child, ids) {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy a document without what the renderer wouldn't draw. Copying only
+// what is kept, rather than copying everything and removing the rest, saves
+// a lot on a large document whose layers hide most of it.
+type optimizer struct {
+	keepHidden bool
+	// The IDs which the elements that are kept refer to, or nil while
+	// these are still being collected.
+	referenced map[string]bool
+	removed int
+}
+
+// Report whether an element is left out of the copy: editor markup, and
+// unless hidden elements are kept, those hidden with display:none which
+// nothing refers to. Inside definitions (where drawn is false), hidden
+// elements are still drawn where they are used.
+func (opt *optimizer) leavesOut(element *etree.Element, drawn bool) bool {
+	if element.Tag == "metadata" || isEditorMarkup(element.Space, element.NamespaceURI()) {
+		return true
+	}
+	if !drawn || opt.keepHidden || !displayNone(element) {
+		return false
+	}
+	return opt.referenced == nil || !containsID(element, opt.referenced)
+}
+
+// Collect the IDs which an element and everything inside it that is kept
+// refer to.
+func (opt *optimizer) collectReferences(element *etree.Element, drawn bool, ids map[string]bool) {
+	addReferences(element, ids)
+	for _, child := range element.ChildElements() {
+		childDrawn := drawn && !slices.Contains(referencedElements, child.Tag)
+		if !opt.leavesOut(child, childDrawn) {
+			opt.collectReferences(child, childDrawn, ids)
+		}
+	}
+}
+
+// Copy the children of an element which are kept, with the editor's
+// attributes left out. The indentation before an element which is left out
+// goes too, so as not to leave a blank line in its place; so do comments.
+func (opt *optimizer) copyChildren(from *etree.Element, to *etree.Element, drawn bool) {
+	var indent *etree.CharData
+	flush := func() {
+		if indent != nil {
+			to.CreateText(indent.Data)
+			indent = nil
+		}
+	}
+	for _, token := range from.Child {
+		switch token := token.(type) {
+		case *etree.Element:
+			childDrawn := drawn && !slices.Contains(referencedElements, token.Tag)
+			if opt.leavesOut(token, childDrawn) {
+				opt.removed++
+				indent = nil
+				continue
+			}
+			flush()
+			child := to.CreateElement(token.FullTag())
+			for _, attr := range token.Attr {
+				// The namespace declarations stay, being next to
+				// nothing and still needed by sodipodi:role, which
+				// Inkscape lays multi-line text out by.
+				if attr.Space == "xmlns" || attr.FullKey() == "sodipodi:role" || !isEditorMarkup(attr.Space, attr.NamespaceURI()) {
+					child.CreateAttr(attr.FullKey(), attr.Value)
+				}
+			}
+			opt.copyChildren(token, child, childDrawn)
+		case *etree.CharData:
+			flush()
+			if token.IsCData() {
+				to.CreateCData(token.Data)
+			} else if token.IsWhitespace() {
+				indent = token
+			} else {
+				to.CreateText(token.Data)
+			}
+		case *etree.ProcInst:
+			flush()
+			to.CreateProcInst(token.Target, token.Inst)
+		case *etree.Directive:
+			flush()
+			to.CreateDirective(token.Data)
+		case *etree.Comment:
+			indent = nil
+		}
+	}
+	flush()
+}
+
+// Remove the definitions which nothing refers to, over and over, since a
+// definition may have been the only one to refer to another. Returns how
+// many elements went.
+func removeUnusedDefs(doc *etree.Document) int {
+	removed := 0
+	for {
+		ids := referencedIDs(doc)
+		before := removed
+		for _, defs := range doc.FindElements("//defs") {
+			for _, child := range defs.ChildElements() {
+				if child.SelectAttrValue("id", "") != "" && !slices.Contains(keptDefinitions, child.Tag) && !containsID(child, ids) {
+					removeElement(defs, child)
+					removed++
+				}
+			}
+		}
+		if removed == before {
+			return removed
+		}
+	}
+}
+
+// Remove an element along with the indentation before it.
+func removeElement(parent *etree.Element, child *etree.Element) {
+	index := child.Index()
+	parent.RemoveChildAt(index)
+	if index > 0 {
+		if space, ok := parent.Child[index-1].(*etree.CharData); ok && strings.TrimSpace(space.Data) == "" {
+			parent.RemoveChildAt(index - 1)
+		}
+	}
+}
+
+// Make an optimized copy of a document for exporting, returning it with how
+// many elements were left out. With keepHidden, elements hidden with
+// display:none are kept, for an SVG which layers will still show them in.
+func optimizedCopy(doc *etree.Document, keepHidden bool) (*etree.Document, int) {
+	opt := &optimizer{keepHidden: keepHidden}
+	referenced := make(map[string]bool)
+	opt.collectReferences(&doc.Element, true, referenced)
+	opt.referenced = referenced
+
+	optimized := etree.NewDocument()
+	optimized.ReadSettings = doc.ReadSettings
+	optimized.WriteSettings = doc.WriteSettings
+	opt.copyChildren(&doc.Element, &optimized.Element, true)
+	return optimized, opt.removed + removeUnusedDefs(optimized)
+}
+
+// Entry point for "bulletpointer optimize [options] in.svg [out.svg]", which
+// writes to stdout without an output file.
+func optimizeCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] in.svg [out.svg]")
+	keepHidden := flags.Bool("keep-hidden", false, "keep the elements hidden with display:none, for an SVG whose layers will still show them")
+	flags.Parse(args)
+	args = flags.Args()
+	if len(args) < 1 || len(args) > 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	doc := etree.NewDocument()
+	if err := readSVG(doc, args[0]); err != nil {
+		log.Fatalf("%s: error reading SVG XML file: %s\n", args[0], err.Error())
+	}
+	before, err := os.Stat(args[0])
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	optimized, removed := optimizedCopy(doc, *keepHidden)
+	data, err := optimized.WriteToBytes()
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+
+	if len(args) == 1 {
+		os.Stdout.Write(data)
+	} else if err := os.WriteFile(args[1], data, 0644); err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	infof("Removed %d elements from %s, %s\n", removed, args[0], sizeChange(before.Size(), int64(len(data))))
+}
+
+// Describe how much smaller (or bigger) a file got.
+func sizeChange(before int64, after int64) string {
+	if before == 0 {
+		return fmt.Sprintf("now %d bytes", after)
+	}
+	return fmt.Sprintf("%d bytes to %d (%.1f%% smaller)", before, after, 100*float64(before-after)/float64(before))
+}
@@ -0,0 +1,700 @@
+// Gather up the options that control a render, whether they came from the
+// command line of "render", "watch" or one of the other commands.
+
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Represent every option that affects how a render is done.
+type RenderOptions struct {
+	Configs []string
+	OutDir string
+	ProfileOut string
+	Timeline string
+	Chapters []string
+	FPS int
+	NormalizeSuffixes bool
+	Formats string
+	Slate bool
+	SlateProject string
+	SlateVersion string
+	SlateDate string
+	SlateDuration float64
+	NameTemplate string
+	KeepSvg bool
+	NoKeepSvg bool
+	Auto bool
+	AutoLayers bool
+	CompressSVG bool
+	Optimize bool
+	SafeArea string
+	Bounds bool
+	SvgDir string
+	Mkdir bool
+	KeepGoing bool
+	Trace bool
+	Resume bool
+	Prune bool
+	Checksums string
+	MaxExports int
+	Report string
+	Manifest string
+	CompareAgainst string
+	Notes string
+	AltText string
+	PPTX string
+	RequireAlt bool
+	Variables map[string]string
+	Palette string
+	ImagePatterns []string
+	LayerPatterns []string
+	OnlyTags string
+	SkipTags string
+	HTML bool
+	HTMLEmbed bool
+	Reveal bool
+	ContactSheet bool
+	ContactColumns int
+	ContactThumbWidth int
+	ContactPerSheet int
+	DiffDir string
+	Progress bool
+	ParallelImages int
+	StreamFormat string
+	CacheDir string
+	Upload string
+	Archive string
+	Inkscape string
+	DockerImage string
+	RenderTimeout time.Duration
+	RenderRetries int
+	RetryBackoff time.Duration
+	Force bool
+
+	// Whether the outputs are being streamed to stdout as an archive, in
+	// which case nothing else may be written there.
+	streaming bool
+
+	// For bench: the renderer every image is exported with, whatever its
+	// config says, and the profile to time the run with.
+	renderer string
+	profile *Profile
+
+	// For daemon jobs: what the submitted config is allowed to do.
+	limits *jobLimits
+}
+
+// Register the render options as flags on a flag set.
+func (options *RenderOptions) registerFlags(flags *flag.FlagSet) {
+	flags.Func("config", "a YAML config file (or glob) to render; may be repeated", func(value string) error {
+		options.Configs = append(options.Configs, value)
+		return nil
+	})
+	flags.Func("var", "set a {{name}} placeholder in the SVG text, as name=value; may be repeated", func(value string) error {
+		name, value, found := strings.Cut(value, "=")
+		if !found || name == "" {
+			return fmt.Errorf("expected name=value")
+		}
+		if options.Variables == nil {
+			options.Variables = make(map[string]string)
+		}
+		options.Variables[name] = value
+		return nil
+	})
+	flags.StringVar(&options.Palette, "palette", "", "a YAML mapping of colors to replace in every SVG, over the config's colors:")
+	flags.StringVar(&options.OutDir, "out", "", "the directory to write outputs into")
+	flags.StringVar(&options.ProfileOut, "profile-out", "", "write a timing profile (folded stacks, or pprof if named *.pb.gz)")
+	flags.StringVar(&options.Timeline, "timeline", "", "write a timeline of the slides (.edl, .otio or .fcpxml)")
+	flags.IntVar(&options.FPS, "fps", 30, "frame rate of the video, for the ffmpeg command in slides.txt and timeline files")
+	flags.Func("chapters", "write chapter markers from the layers' titles (.txt for a YouTube description, .ffmeta for ffmpeg); may be repeated", func(value string) error {
+		options.Chapters = append(options.Chapters, value)
+		return nil
+	})
+	flags.BoolVar(&options.NormalizeSuffixes, "normalize-suffixes", false, "replace unsafe characters in suffixes with _ instead of failing")
+	flags.StringVar(&options.Formats, "format", "png", "comma-separated output formats for every image (png, pdf, jpeg, webp, tiff); pdf is a deck of the PNGs")
+	flags.BoolVar(&options.Slate, "slate", false, "prepend a slate frame identifying the project, date and version")
+	flags.StringVar(&options.SlateProject, "slate-project", "", "project name on the slate (default: the YAML file name)")
+	flags.StringVar(&options.SlateVersion, "slate-version", "", "version shown on the slate")
+	flags.StringVar(&options.SlateDate, "slate-date", time.Now().Format("2006-01-02"), "date shown on the slate")
+	flags.Float64Var(&options.SlateDuration, "slate-duration", 3, "seconds to show the slate for")
+	flags.StringVar(&options.NameTemplate, "name-template", defaultNameTemplate, "Go template for output PNG paths, relative to the output dir")
+	flags.BoolVar(&options.KeepSvg, "keep-svg", true, "keep the intermediate SVG files next to the PNGs")
+	flags.BoolVar(&options.NoKeepSvg, "no-keep-svg", false, "write intermediate SVG files to a scratch dir and delete them afterwards")
+	flags.BoolVar(&options.Auto, "auto", false, "render every SVG found in the dirs given instead of configs, with a single layer each (implies --mkdir)")
+	flags.BoolVar(&options.AutoLayers, "auto-layers", false, "with --auto, reveal each SVG's Inkscape layers one at a time from the bottom up")
+	flags.StringVar(&options.SafeArea, "safe-area", "", "warn about anything drawn within these margins of the page, as percentages (such as 5% or \"10% 5%\"), for images without a safe_area")
+	flags.BoolVar(&options.Bounds, "bounds", false, "record in the manifest the box around what each slide draws on top of its background (asks the renderer once more per layer)")
+	flags.BoolVar(&options.Optimize, "optimize", false, "strip editor markup, unused definitions and hidden elements from the SVGs that are exported (as optimize does)")
+	flags.BoolVar(&options.CompressSVG, "svgz", false, "write the intermediate SVG files gzip-compressed, as .svgz")
+	flags.StringVar(&options.SvgDir, "svg-dir", "", "write intermediate SVG files to this dir (and keep them) instead of next to the PNGs")
+	flags.BoolVar(&options.Mkdir, "mkdir", false, "create the output dir, and any subdirs from the name template, if missing")
+	flags.BoolVar(&options.KeepGoing, "keep-going", false, "record failed layers and carry on, then report them all at the end")
+	flags.BoolVar(&options.Trace, "trace", false, "log every element each layer's directives change, with its attributes before and after")
+	flags.BoolVar(&options.Resume, "resume", false, "keep PNGs which an earlier (perhaps interrupted) run exported from the same input")
+	flags.BoolVar(&options.Prune, "prune", false, "after rendering, delete outputs which the config no longer produces (as clean does)")
+	flags.StringVar(&options.Checksums, "checksums", "", "write SHA-256 checksums of the outputs: sidecar (a .sha256 per file) or sums (one SHA256SUMS)")
+	flags.StringVar(&options.Manifest, "manifest", "manifest.json", "write an index of the outputs to this file in the output dir (.json or .yaml; empty to skip)")
+	flags.BoolVar(&options.ContactSheet, "contact-sheet", false, "write contact_sheet.png with a labelled thumbnail of every slide")
+	flags.IntVar(&options.ContactColumns, "contact-columns", 4, "thumbnails per row on the contact sheet")
+	flags.IntVar(&options.ContactThumbWidth, "contact-thumb-width", 320, "width of each thumbnail on the contact sheet, in pixels")
+	flags.IntVar(&options.ContactPerSheet, "contact-per-sheet", 0, "split the contact sheet into several of this many slides each (0 = one sheet)")
+	flags.Func("image", "only render images whose filename matches this glob; may be repeated", func(value string) error {
+		options.ImagePatterns = append(options.ImagePatterns, value)
+		return nil
+	})
+	flags.Func("layer", "only export layers and composites whose suffix matches this glob; may be repeated", func(value string) error {
+		options.LayerPatterns = append(options.LayerPatterns, value)
+		return nil
+	})
+	flags.StringVar(&options.OnlyTags, "only-tags", "", "comma-separated tags; leave out tagged layers which have none of them")
+	flags.StringVar(&options.SkipTags, "skip-tags", "", "comma-separated tags; leave out layers which have any of them")
+	flags.StringVar(&options.Notes, "notes", "", "write the layers' titles and speaker notes to this Markdown file")
+	flags.StringVar(&options.AltText, "alt-text", "", "write each slide's <title>, <desc> and notes to this file, for alt text (.json or .csv)")
+	flags.BoolVar(&options.RequireAlt, "require-alt", false, "fail any slide (or, for validate, any SVG) with no <desc> to describe it")
+	flags.StringVar(&options.PPTX, "pptx", "", "write the slides to this PowerPoint file, with the layers' notes as speaker notes")
+	flags.BoolVar(&options.HTML, "html", false, "write index.html to step through the slides in a browser")
+	flags.BoolVar(&options.HTMLEmbed, "html-embed", false, "embed the slides into index.html so it is a single self-contained file")
+	flags.BoolVar(&options.Reveal, "reveal", false, "make index.html a reveal.js deck (loaded from a CDN)")
+	flags.StringVar(&options.CompareAgainst, "compare-against", "", "after rendering, compare the slides pixel by pixel with those in this dir")
+	flags.StringVar(&options.DiffDir, "diff-dir", "", "with --compare-against, write images highlighting the changed pixels into this dir")
+	flags.StringVar(&options.Report, "report", "", "write a JSON report of the run to this file (- for stdout)")
+	flags.BoolVar(&options.Progress, "progress", true, "show a progress bar (only when stderr is a terminal and logs are text)")
+	flags.StringVar(&options.CacheDir, "cache-dir", "", "where SVGs fetched from URLs are cached (default: the user cache dir)")
+	flags.StringVar(&options.Upload, "upload", "", "upload the outputs to this s3://bucket/prefix after rendering")
+	flags.StringVar(&options.Inkscape, "inkscape", "", "the Inkscape executable to render with, instead of searching for one")
+	flags.StringVar(&options.DockerImage, "docker-image", defaultDockerImage, "the container image used for renderer: docker")
+	flags.DurationVar(&options.RenderTimeout, "render-timeout", 2*time.Minute, "kill an export which takes longer than this (0 = no limit)")
+	flags.IntVar(&options.RenderRetries, "render-retries", 2, "retry a failed or timed-out export this many times")
+	flags.DurationVar(&options.RetryBackoff, "retry-backoff", time.Second, "wait this long before the first retry, doubling each time")
+	flags.StringVar(&options.Archive, "archive", "", "package the outputs (without intermediate SVGs) into this .zip, .tar or .tar.gz file")
+	flags.StringVar(&options.StreamFormat, "stream-format", "tar", "archive format used when the output dir is - (tar, tar.gz or zip)")
+	flags.BoolVar(&options.Force, "force", false, "render even though another run seems to be using the output dir")
+	flags.IntVar(&options.MaxExports, "max-exports", 0, "refuse to start a run which would make more than this many exports (0 = no limit)")
+	flags.IntVar(&options.ParallelImages, "parallel-images", 1, "process this many images at once, each with a renderer of its own")
+}
+
+// Fill in the config files and output directory from positional arguments,
+// for whichever of them weren't given as flags. Without --out, the last of
+// several arguments is the output directory.
+func (options *RenderOptions) takePositional(args []string, needOutDir bool) error {
+	if needOutDir && options.OutDir == "" && len(args) > 0 && (len(args) > 1 || len(options.Configs) > 0) {
+		options.OutDir, args = args[len(args)-1], args[:len(args)-1]
+	}
+	options.Configs = append(options.Configs, args...)
+	if len(options.Configs) == 0 {
+		return fmt.Errorf("no config file given")
+	}
+	if needOutDir && options.OutDir == "" {
+		return fmt.Errorf("no output directory given")
+	}
+	return nil
+}
+
+// Return where tables and the like should be written: stdout, unless the
+// outputs themselves are being streamed there.
+func (options *RenderOptions) stdout() io.Writer {
+	if options.streaming {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// Render into a temporary directory and stream it to stdout as an archive,
+// for when the output directory is given as "-". The archive is still written
+// if some layers failed, so that the rest aren't lost.
+func (options *RenderOptions) renderToStdout() error {
+	if options.Report == "-" {
+		return fmt.Errorf("--report - can't be used when streaming the outputs to stdout")
+	}
+	outDir, err := os.MkdirTemp("", "bulletpointer-stream-")
+	if err != nil {
+		return fmt.Errorf("could not create output dir: %w", err)
+	}
+	defer os.RemoveAll(outDir)
+	options.OutDir = outDir
+	options.streaming = true
+
+	renderErr := options.render()
+	if files, _ := listFiles(outDir); len(files) == 0 && renderErr != nil {
+		return renderErr
+	}
+	if err := writeArchive(os.Stdout, outDir, options.StreamFormat, "", nil); err != nil {
+		return fmt.Errorf("problem streaming the outputs: %w", err)
+	}
+	return renderErr
+}
+
+// Split the --format flag into the formats requested for the whole run.
+func (options *RenderOptions) runFormats() ([]string, error) {
+	formats := strings.Split(options.Formats, ",")
+	if err := validateFormats(formats); err != nil {
+		return nil, fmt.Errorf("invalid --format: %w", err)
+	}
+	return formats, nil
+}
+
+// Check the images for configuration mistakes before rendering any of them.
+// This also fills in automatic suffixes, so it must happen before rendering.
+func (options *RenderOptions) validateImages(images []*Image) error {
+	for _, image := range images {
+		image.assignSuffixes()
+		if err := image.validateSuffixes(options.NormalizeSuffixes); err != nil {
+			return fmt.Errorf("invalid suffixes: %w", err)
+		}
+		if err := validateFormats(image.Formats); err != nil {
+			return fmt.Errorf("invalid formats for %s: %w", image.Filename, err)
+		}
+		if err := image.validateLocales(); err != nil {
+			return fmt.Errorf("invalid locales: %w", err)
+		}
+		if _, err := image.nameTemplate(options.NameTemplate); err != nil {
+			return fmt.Errorf("invalid name template for %s: %w", image.Filename, err)
+		}
+		if image.Renderer != "" && !knownRenderers[image.Renderer] {
+			return fmt.Errorf("unknown renderer %q for %s", image.Renderer, image.Filename)
+		}
+		for _, overlay := range image.Overlays {
+			if err := overlay.validate(); err != nil {
+				return fmt.Errorf("invalid overlays for %s: %w", image.Filename, err)
+			}
+		}
+		for _, spec := range image.Transforms {
+			if err := spec.validate(); err != nil {
+				return fmt.Errorf("invalid transforms for %s: %w", image.Filename, err)
+			}
+		}
+		if safeArea := image.safeArea(options.SafeArea); safeArea != "" {
+			if _, err := parseSafeArea(safeArea); err != nil {
+				return fmt.Errorf("invalid safe area for %s: %w", image.Filename, err)
+			}
+		}
+		if err := image.BurnCaptions.validate(image); err != nil {
+			return fmt.Errorf("invalid burn_captions for %s: %w", image.Filename, err)
+		}
+		for _, layer := range image.Layers {
+			if _, err := areaArgs(layer.exportOptions(image)); err != nil {
+				return fmt.Errorf("invalid export settings for %s layer %s: %w", image.Filename, layer.Suffix, err)
+			}
+			if layer.exportOptions(image).Page < 0 {
+				return fmt.Errorf("invalid export settings for %s layer %s: pages are numbered from 1", image.Filename, layer.Suffix)
+			}
+			for _, overlay := range layer.Overlays {
+				if err := overlay.validate(); err != nil {
+					return fmt.Errorf("invalid overlays for %s layer %s: %w", image.Filename, layer.Suffix, err)
+				}
+			}
+			if err := layer.Camera.validate(); err != nil {
+				return fmt.Errorf("invalid camera for %s layer %s: %w", image.Filename, layer.Suffix, err)
+			}
+			if err := layer.validateVariants(); err != nil {
+				return fmt.Errorf("invalid variants for %s layer %s: %w", image.Filename, layer.Suffix, err)
+			}
+			for _, spec := range layer.Transforms {
+				if err := spec.validate(); err != nil {
+					return fmt.Errorf("invalid transforms for %s layer %s: %w", image.Filename, layer.Suffix, err)
+				}
+			}
+		}
+	}
+	if err := validateOutputs(images, options.NameTemplate); err != nil {
+		return fmt.Errorf("output files collide: %w", err)
+	}
+	return nil
+}
+
+// Render one full set of outputs into the run's output directory: the slate
+// (if any), every image, and the files which index them (slides.txt, the PDF,
+// the manifest, notes, contact sheets and the HTML preview). This happens
+// once for the deck itself and again for each of its locales.
+func (options *RenderOptions) renderSet(run *Run, images []*Image) ([]*Slide, error) {
+	// Only the layers are numbered (for "numbering:"). The title and end
+	// cards are left out of the count, since they show no number of their
+	// own and the layers should read "3 of 10" with or without them.
+	run.SlideOffsets = make(map[*Image]int)
+	run.SlideTotal = 0
+	for _, image := range images {
+		run.SlideOffsets[image] = run.SlideTotal
+		run.SlideTotal += len(image.Layers)
+	}
+
+	var slides []*Slide
+	if options.Slate {
+		info := &SlateInfo{Project: options.SlateProject, Date: options.SlateDate, Version: options.SlateVersion}
+		if info.Project == "" {
+			info.Project = strings.TrimSuffix(filepath.Base(options.Configs[0]), filepath.Ext(options.Configs[0]))
+		}
+		slateSlide, err := info.writeSlate(run, options.SlateDuration)
+		if err != nil {
+			return nil, fmt.Errorf("could not generate slate: %w", err)
+		}
+		slides = append(slides, slateSlide)
+	}
+
+	// The memory a run needs is already bounded by the largest image rather
+	// than the size of the deck: each image's parsed document is dropped
+	// once it has been processed, only its slides are kept, and a renderer
+	// process lasts for one export.
+	var pdfPages []string
+	results := make([][]*Slide, len(images))
+	processImages(run, images, results)
+	if err := run.stopError(); err != nil {
+		run.Progress.finish()
+		return nil, err
+	}
+	for i, image := range images {
+		slides = append(slides, results[i]...)
+		if image.wantsFormat("pdf", run.Formats) {
+			for _, slide := range results[i] {
+				pdfPages = append(pdfPages, slide.PngFile)
+			}
+		}
+	}
+	// Only the manifest is written, to record which slides were finished;
+	// everything else would be made from an incomplete deck.
+	if isInterrupted() {
+		run.Progress.finish()
+		if options.Manifest != "" {
+			manifestFile := resolvePath(run.OutDir, options.Manifest)
+			if err := writeManifest(manifestFile, slides, run.ScratchDir == "", true); err != nil {
+				return nil, fmt.Errorf("problem writing manifest: %w", err)
+			}
+			infof("Stopped after %d slides, which %s lists\n", len(slides), manifestFile)
+		}
+		return nil, errInterrupted
+	}
+
+	if hasTiming(slides) {
+		concatFile := filepath.Join(run.OutDir, "slides.txt")
+		command, err := writeConcatFile(concatFile, slides, options.FPS)
+		if err != nil {
+			return nil, fmt.Errorf("problem writing %s: %w", concatFile, err)
+		}
+		infof("Assemble the video with: %s\n", command)
+	}
+
+	if len(pdfPages) > 0 {
+		pdfFile := filepath.Join(run.OutDir, "deck.pdf")
+		if err := writePDF(pdfFile, pdfPages); err != nil {
+			return nil, fmt.Errorf("problem writing %s: %w", pdfFile, err)
+		}
+	}
+
+	if options.Manifest != "" {
+		manifestFile := resolvePath(run.OutDir, options.Manifest)
+		if err := writeManifest(manifestFile, slides, run.ScratchDir == "", false); err != nil {
+			return nil, fmt.Errorf("problem writing manifest: %w", err)
+		}
+	}
+
+	if options.Notes != "" {
+		notesFile := resolvePath(run.OutDir, options.Notes)
+		if err := writeNotes(notesFile, slides); err != nil {
+			return nil, fmt.Errorf("problem writing notes: %w", err)
+		}
+	}
+
+	if options.AltText != "" {
+		altTextFile := resolvePath(run.OutDir, options.AltText)
+		if err := writeAltText(altTextFile, slides); err != nil {
+			return nil, fmt.Errorf("problem writing alt text: %w", err)
+		}
+	}
+
+	if options.PPTX != "" {
+		pptxFile := resolvePath(run.OutDir, options.PPTX)
+		title := strings.TrimSuffix(filepath.Base(options.Configs[0]), filepath.Ext(options.Configs[0]))
+		if err := writePPTX(pptxFile, title, slides); err != nil {
+			return nil, fmt.Errorf("problem writing %s: %w", pptxFile, err)
+		}
+	}
+
+	if options.ContactSheet {
+		sheets, err := writeContactSheets(run.OutDir, slides, options.ContactColumns, options.ContactThumbWidth, options.ContactPerSheet)
+		if err != nil {
+			return nil, fmt.Errorf("problem writing contact sheet: %w", err)
+		}
+		debugf("Wrote %d contact sheet(s)\n", len(sheets))
+	}
+
+	if options.HTML || options.HTMLEmbed || options.Reveal {
+		htmlFile := filepath.Join(run.OutDir, "index.html")
+		title := strings.TrimSuffix(filepath.Base(options.Configs[0]), filepath.Ext(options.Configs[0]))
+		if err := writeHTMLPreview(htmlFile, title, slides, options.HTMLEmbed, options.Reveal); err != nil {
+			return nil, fmt.Errorf("problem writing %s: %w", htmlFile, err)
+		}
+	}
+
+	return slides, nil
+}
+
+// Render every image in the config files into the output directory, and
+// return the slides which were produced. Layers which fail are recorded in
+// the run rather than stopping it when --keep-going is given; an error is
+// returned if anything failed at all.
+func (options *RenderOptions) renderSlides() ([]*Slide, error) {
+	startedAt := time.Now()
+	if dirStat, err := os.Stat(options.OutDir); err == nil {
+		if !dirStat.IsDir() {
+			return nil, &ConfigError{fmt.Errorf("destination should be a directory: %s", options.OutDir)}
+		}
+	} else if options.Mkdir || options.Auto {
+		if err := os.MkdirAll(options.OutDir, 0755); err != nil {
+			return nil, fmt.Errorf("could not create destination dir: %w", err)
+		}
+	} else {
+		return nil, &ConfigError{fmt.Errorf("destination dir needs to exist (or use --mkdir): %s", options.OutDir)}
+	}
+	unlock, err := lockOutDir(options.OutDir, options.Force)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	images, _, err := options.loadImages()
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	if options.renderer != "" {
+		for _, image := range images {
+			image.Renderer = options.renderer
+		}
+	}
+	runFormats, err := options.runFormats()
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	if err := options.validateImages(images); err != nil {
+		return nil, &ConfigError{err}
+	}
+	if options.Checksums != "" && !knownChecksumModes[options.Checksums] {
+		return nil, &ConfigError{fmt.Errorf("unknown --checksums %q; expected sidecar or sums", options.Checksums)}
+	}
+	// What is stale depends on the whole config, not whatever cut of it
+	// this run renders, so the outputs are planned before selecting.
+	var planned map[string]bool
+	if options.Prune {
+		if planned, err = plannedOutputs(images, options.NameTemplate); err != nil {
+			return nil, &ConfigError{err}
+		}
+	}
+	images = options.selectLayers(images)
+	if images, err = options.selectImages(images); err != nil {
+		return nil, &ConfigError{err}
+	}
+	if err := options.planExports(images); err != nil {
+		return nil, &ConfigError{err}
+	}
+
+	run := &Run{
+		OutDir: options.OutDir,
+		Limits: options.limits,
+		Formats: runFormats,
+		NameTemplate: options.NameTemplate,
+		Mkdir: options.Mkdir || options.Auto,
+		KeepGoing: options.KeepGoing,
+		Resume: options.Resume,
+		Trace: options.Trace,
+		RequireAlt: options.RequireAlt,
+		Optimize: options.Optimize,
+		SafeArea: options.SafeArea,
+		Bounds: options.Bounds,
+		Variables: options.Variables,
+		LayerPatterns: options.LayerPatterns,
+		Renderers: make(map[string]*Renderer),
+	}
+	if options.Palette != "" {
+		if run.Colors, err = readPalette(options.Palette); err != nil {
+			return nil, &ConfigError{err}
+		}
+	}
+	// Only set up the renderers that are actually used, so that a machine
+	// rendering everything in containers doesn't need Inkscape installed.
+	names := []string{"inkscape"}
+	if len(images) > 0 {
+		names = nil
+	}
+	for _, image := range images {
+		if name := cmp.Or(image.Renderer, "inkscape"); !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		renderer := &Renderer{Timeout: options.RenderTimeout, Retries: options.RenderRetries, Backoff: options.RetryBackoff}
+		if name == "docker" {
+			renderer.Docker = options.DockerImage
+			err = renderer.probe()
+		} else {
+			err = renderer.discover(options.Inkscape)
+		}
+		if err != nil {
+			return nil, &RenderError{err}
+		}
+		infof("Using Inkscape %s (%s)\n", renderer.Version, strings.Join(renderer.command(), " "))
+		run.Renderers[name] = renderer
+	}
+	if options.ParallelImages > 1 {
+		profilesDir, err := os.MkdirTemp("", "bulletpointer-profiles-")
+		if err != nil {
+			return nil, fmt.Errorf("could not create renderer profiles dir: %w", err)
+		}
+		defer os.RemoveAll(profilesDir)
+		if err := run.isolateRenderers(options.ParallelImages, profilesDir); err != nil {
+			return nil, err
+		}
+	}
+	run.Profile = options.profile
+	if run.Profile == nil && options.ProfileOut != "" {
+		run.Profile = NewProfile()
+	}
+	if options.Upload != "" || slices.ContainsFunc(images, func(image *Image) bool { return isRemote(image.Filename) }) {
+		if run.Remote, err = newRemoteFetcher(options.CacheDir); err != nil {
+			return nil, err
+		}
+		// What a daemon job fetches is its own business, not the daemon's.
+		run.Remote.anonymous = options.limits != nil
+	}
+
+	run.CompressSVG = options.CompressSVG
+	if options.SvgDir != "" {
+		run.SvgDir = options.SvgDir
+	} else if options.NoKeepSvg || !options.KeepSvg {
+		scratchDir, err := os.MkdirTemp("", "bulletpointer-")
+		if err != nil {
+			return nil, fmt.Errorf("could not create scratch dir: %w", err)
+		}
+		defer os.RemoveAll(scratchDir)
+		run.SvgDir = scratchDir
+		run.ScratchDir = scratchDir
+	}
+
+	if options.Progress && verbosity >= 0 && logFormat == "text" && isTerminal(os.Stderr) {
+		total := 0
+		for _, image := range images {
+			total += len(image.Layers)
+		}
+		total *= 1 + len(localeNames(images))
+		run.Progress = NewProgress(os.Stderr, total)
+		log.SetOutput(run.Progress.wrap(os.Stderr))
+		defer log.SetOutput(os.Stderr)
+	}
+
+	var slides []*Slide
+	var deckSlides []*Slide
+	svgDir := run.SvgDir
+	for _, locale := range slices.Concat([]string{""}, localeNames(images)) {
+		run.Locale = locale
+		if locale != "" {
+			run.OutDir = filepath.Join(options.OutDir, locale)
+			if err := os.MkdirAll(run.OutDir, 0755); err != nil {
+				return nil, fmt.Errorf("could not create locale dir: %w", err)
+			}
+			if svgDir != "" {
+				run.SvgDir = filepath.Join(svgDir, locale)
+			}
+		}
+		setSlides, err := options.renderSet(run, images)
+		if err != nil {
+			return nil, err
+		}
+		if locale == "" {
+			deckSlides = setSlides
+		}
+		slides = append(slides, setSlides...)
+	}
+	run.OutDir = options.OutDir
+	run.SvgDir = svgDir
+
+	if options.Prune {
+		stale, err := pruneOutputs(options.OutDir, planned, false)
+		if err != nil {
+			return nil, fmt.Errorf("problem pruning stale outputs: %w", err)
+		}
+		infof("Removed %d stale outputs\n", len(stale))
+	}
+
+	// The timeline and chapters are single files outside the output
+	// directory, so they only cover the deck in its own language.
+	if options.Timeline != "" {
+		if err := writeTimeline(options.Timeline, deckSlides, options.FPS); err != nil {
+			return nil, fmt.Errorf("problem writing timeline: %w", err)
+		}
+	}
+	for _, chapters := range options.Chapters {
+		if err := writeChapters(chapters, deckSlides); err != nil {
+			return nil, fmt.Errorf("problem writing chapters: %w", err)
+		}
+	}
+
+	if options.ProfileOut != "" {
+		if err := run.Profile.writeFile(options.ProfileOut); err != nil {
+			return nil, fmt.Errorf("problem writing profile: %w", err)
+		}
+	}
+
+	run.Progress.finish()
+	log.SetOutput(os.Stderr)
+	if run.Resume {
+		infof("Resumed: %d of the slides were already up to date\n", run.Resumed.Load())
+	}
+
+	if options.Report != "" {
+		report := run.report(options.Configs, len(images), slides, startedAt)
+		if err := report.writeFile(options.Report); err != nil {
+			return nil, fmt.Errorf("problem writing report: %w", err)
+		}
+	}
+
+	if options.CompareAgainst != "" {
+		diffs, err := diffDirs(options.CompareAgainst, options.OutDir, 0, options.DiffDir)
+		if err != nil {
+			return nil, err
+		}
+		differences := writeDiffTable(options.stdout(), diffs, false)
+		infof("%d of %d slides differ from %s\n", differences, len(diffs), options.CompareAgainst)
+	}
+
+	if options.Checksums != "" {
+		if err := writeChecksums(options.OutDir, options.Checksums); err != nil {
+			return nil, fmt.Errorf("problem writing checksums: %w", err)
+		}
+	}
+
+	if options.Archive != "" {
+		if err := writeArchiveFile(options.Archive, options.OutDir); err != nil {
+			return nil, fmt.Errorf("problem writing archive: %w", err)
+		}
+	}
+
+	if options.Upload != "" {
+		if err := run.Remote.upload(options.OutDir, options.Upload); err != nil {
+			return nil, fmt.Errorf("problem uploading outputs: %w", err)
+		}
+	}
+
+	if err := run.postRunHooks(images, slides); err != nil {
+		return nil, err
+	}
+
+	if len(run.Failures) > 0 {
+		run.writeFailureReport(os.Stderr)
+		return slides, &PartialError{Failures: run.Failures}
+	}
+	return slides, nil
+}
+
+// Render every image in the config files, as for renderSlides.
+func (options *RenderOptions) render() error {
+	_, err := options.renderSlides()
+	return err
+}
@@ -0,0 +1,117 @@
+// Lay a shared SVG (a branding frame, a lower third, ...) over or under the
+// slides, so that it is kept in one file instead of being baked into every
+// source SVG.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Represent an SVG which is merged into the document before it is exported.
+// It is scaled to fill the page, and goes on top unless its position is
+// "under".
+type Overlay struct {
+	File string `yaml:"file"`
+	Position string `yaml:"position,omitempty"`
+}
+
+// Check that the overlay's position is one that is understood.
+func (overlay *Overlay) validate() error {
+	if overlay.File == "" {
+		return fmt.Errorf("overlay needs a file")
+	}
+	if overlay.Position != "" && overlay.Position != "over" && overlay.Position != "under" {
+		return fmt.Errorf("overlay %s position %q should be over or under", overlay.File, overlay.Position)
+	}
+	return nil
+}
+
+// Read the overlay's SVG, with its linked files resolved against its own
+// directory rather than the document's.
+func (overlay *Overlay) load(baseDir string) (*etree.Document, error) {
+	filename := resolvePath(baseDir, overlay.File)
+	doc := etree.NewDocument()
+	if err := readSVG(doc, filename); err != nil {
+		return nil, fmt.Errorf("error reading overlay %s: %w", overlay.File, err)
+	}
+	if doc.Root() == nil {
+		return nil, fmt.Errorf("overlay %s is empty", overlay.File)
+	}
+	if err := resolveAssets(doc, filename, filename); err != nil {
+		return nil, fmt.Errorf("overlay %s: %w", overlay.File, err)
+	}
+	return doc, nil
+}
+
+// Merge the overlay into the document as a nested svg element filling the
+// page, returning the element so that it can be taken out again. Its IDs
+// are kept so that layers can refer to them, which means that they must not
+// clash with the document's own.
+func (overlay *Overlay) insert(index *elementIndex, baseDir string) (*etree.Element, error) {
+	overlayDoc, err := overlay.load(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	nested := overlayDoc.Root().Copy()
+	for _, element := range append(nested.FindElements(".//*[@id]"), nested) {
+		if id := element.SelectAttrValue("id", ""); id != "" && len(index.ids[id]) > 0 {
+			return nil, fmt.Errorf("overlay %s has an element #%s, which the document already has", overlay.File, id)
+		}
+	}
+
+	// A nested svg with a 100% size fills the viewBox of the document, and
+	// its own viewBox scales its content to match.
+	root := index.doc.Root()
+	x, y := "0", "0"
+	if viewBox := strings.Fields(strings.ReplaceAll(root.SelectAttrValue("viewBox", ""), ",", " ")); len(viewBox) == 4 {
+		x, y = viewBox[0], viewBox[1]
+	}
+	if nested.SelectAttr("viewBox") == nil {
+		if width, height := nested.SelectAttrValue("width", ""), nested.SelectAttrValue("height", ""); width != "" && height != "" {
+			nested.CreateAttr("viewBox", fmt.Sprintf("0 0 %s %s", strings.TrimSuffix(width, "px"), strings.TrimSuffix(height, "px")))
+		}
+	}
+	nested.CreateAttr("x", x)
+	nested.CreateAttr("y", y)
+	nested.CreateAttr("width", "100%")
+	nested.CreateAttr("height", "100%")
+
+	if overlay.Position == "under" {
+		root.InsertChildAt(0, nested)
+	} else {
+		root.AddChild(nested)
+	}
+	index.refresh()
+	return nested, nil
+}
+
+// Merge a list of overlays into the document, in order.
+func insertOverlays(overlays []*Overlay, index *elementIndex, baseDir string) ([]*etree.Element, error) {
+	var inserted []*etree.Element
+	for _, overlay := range overlays {
+		element, err := overlay.insert(index, baseDir)
+		if err != nil {
+			removeOverlays(inserted, index)
+			return nil, err
+		}
+		inserted = append(inserted, element)
+	}
+	return inserted, nil
+}
+
+// Take overlays back out of the document once the layer that added them has
+// been written.
+func removeOverlays(elements []*etree.Element, index *elementIndex) {
+	for _, element := range elements {
+		if element.Parent() != nil {
+			element.Parent().RemoveChild(element)
+		}
+	}
+	if len(elements) > 0 {
+		index.refresh()
+	}
+}
@@ -0,0 +1,59 @@
+// Export single pages of Inkscape 1.2's multi-page documents, so that a whole
+// module delivered as one SVG doesn't have to be split up by hand.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Count the pages of a document, which Inkscape lists as inkscape:page
+// elements in its named view. A document without any has the one page.
+func documentPages(doc *etree.Document) int {
+	pages := 0
+	for _, element := range doc.FindElements("//page") {
+		if element.NamespaceURI() == inkscapeNamespace {
+			pages++
+		}
+	}
+	return max(pages, 1)
+}
+
+// Report whether the renderer is at least the given version of Inkscape.
+// A renderer whose version is unknown is given the benefit of the doubt.
+func (renderer *Renderer) atLeast(major int, minor int) bool {
+	parts := strings.SplitN(renderer.Version, ".", 3)
+	if len(parts) < 2 {
+		return true
+	}
+	haveMajor, err1 := strconv.Atoi(parts[0])
+	haveMinor, err2 := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	return haveMajor > major || (haveMajor == major && haveMinor >= minor)
+}
+
+// Translate the page to export into renderer arguments, for Inkscape 1.2 and
+// later (which is when pages were added).
+func (renderer *Renderer) pageArgs(page int) ([]string, error) {
+	if page <= 0 {
+		return nil, nil
+	}
+	if !renderer.atLeast(1, 2) {
+		return nil, fmt.Errorf("page: needs Inkscape 1.2 or later, not %s", renderer.Version)
+	}
+	return []string{fmt.Sprintf("--export-page=%d", page)}, nil
+}
+
+// Check that the page a layer asks for is one the document has.
+func checkPage(doc *etree.Document, page int) error {
+	if pages := documentPages(doc); page > pages {
+		return fmt.Errorf("page %d is out of range; the SVG has %d", page, pages)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Remap the colors of a drawing, so that one set of SVGs can be re-skinned
+// for several brands instead of keeping a copy of every file for each.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+	"gopkg.in/yaml.v3"
+)
+
+// The presentation properties which hold colors, as attributes or in styles.
+var colorProperties = []string{"fill", "stroke", "stop-color", "flood-color", "lighting-color", "color"}
+
+// Match a hex color, or a custom property declaration, in stylesheet text.
+var hexColor = regexp.MustCompile(`#[0-9A-Fa-f]{6}\b|#[0-9A-Fa-f]{3}\b`)
+var customProperty = regexp.MustCompile(`(--[A-Za-z0-9_-]+)\s*:\s*([^;}]+)`)
+
+// Put a color into the form palettes are keyed by: lowercase, with #abc
+// written out in full as #aabbcc.
+func normalizeColor(color string) string {
+	color = strings.ToLower(strings.TrimSpace(color))
+	if len(color) == 4 && color[0] == '#' {
+		color = string([]byte{'#', color[1], color[1], color[2], color[2], color[3], color[3]})
+	}
+	return color
+}
+
+// Work out the palette for an image: its own colors, then those of the
+// --palette file, each taking precedence over the ones before. Colors are
+// keyed by their normalized form, and custom properties (--name) as given.
+func (image *Image) palette(overrides map[string]string) map[string]string {
+	colors := make(map[string]string)
+	for _, source := range []map[string]string{image.Colors, overrides} {
+		for from, to := range source {
+			if !strings.HasPrefix(from, "--") {
+				from = normalizeColor(from)
+			}
+			colors[from] = to
+		}
+	}
+	return colors
+}
+
+// Read a palette file, which is a YAML mapping of colors to replace.
+func readPalette(filename string) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var colors map[string]string
+	if err := yaml.Unmarshal(data, &colors); err != nil {
+		return nil, fmt.Errorf("problem parsing palette %s: %w", filename, err)
+	}
+	return colors, nil
+}
+
+// Replace one color value if the palette has it.
+func remapColor(value string, colors map[string]string) string {
+	if to, ok := colors[normalizeColor(value)]; ok {
+		return to
+	}
+	return value
+}
+
+// Rewrite a style attribute (or the body of a stylesheet rule), remapping the
+// color properties and setting the custom properties the palette names.
+func remapStyle(style string, colors map[string]string) string {
+	components := strings.Split(style, ";")
+	for i, component := range components {
+		name, value, found := strings.Cut(component, ":")
+		if !found {
+			continue
+		}
+		key := strings.TrimSpace(name)
+		if to, ok := colors[key]; ok && strings.HasPrefix(key, "--") {
+			components[i] = name + ":" + to
+		} else if slices.Contains(colorProperties, key) {
+			components[i] = name + ":" + remapColor(value, colors)
+		}
+	}
+	return strings.Join(components, ";")
+}
+
+// Apply a palette to the whole document: color attributes, style attributes
+// and the text of stylesheets, where hex colors are replaced wherever they
+// appear and custom properties wherever they are declared.
+func recolor(doc *etree.Document, colors map[string]string) {
+	if len(colors) == 0 {
+		return
+	}
+	for _, element := range doc.FindElements("//*") {
+		for i := range element.Attr {
+			attr := &element.Attr[i]
+			switch {
+			case attr.Key == "style" && attr.Space == "":
+				attr.Value = remapStyle(attr.Value, colors)
+			case attr.Space == "" && slices.Contains(colorProperties, attr.Key):
+				attr.Value = remapColor(attr.Value, colors)
+			}
+		}
+		if element.Tag != "style" {
+			continue
+		}
+		for _, token := range element.Child {
+			text, ok := token.(*etree.CharData)
+			if !ok {
+				continue
+			}
+			data := hexColor.ReplaceAllStringFunc(text.Data, func(color string) string {
+				return remapColor(color, colors)
+			})
+			text.Data = customProperty.ReplaceAllStringFunc(data, func(declaration string) string {
+				match := customProperty.FindStringSubmatch(declaration)
+				if to, ok := colors[match[1]]; ok {
+					return match[1] + ": " + to
+				}
+				return declaration
+			})
+		}
+	}
+}
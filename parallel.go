@@ -0,0 +1,93 @@
+// Process several images at once with --parallel-images. Each image already
+// parses its own copy of its document, so what the images must not share is
+// the renderer: every worker exports with renderers of its own, each with a
+// separate Inkscape profile directory, so that the Inkscapes running side by
+// side don't fight over the same preferences and caches.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Copy a renderer for one worker, with a profile directory of its own. The
+// copy doesn't list the fonts again; those are checked with the original.
+func (renderer *Renderer) isolate(profileDir string) *Renderer {
+	return &Renderer{
+		Command: renderer.Command,
+		Docker: renderer.Docker,
+		Timeout: renderer.Timeout,
+		Retries: renderer.Retries,
+		Backoff: renderer.Backoff,
+		Version: renderer.Version,
+		legacy: renderer.legacy,
+		ProfileDir: profileDir,
+	}
+}
+
+// Set up the renderers of each worker, with their profile directories
+// inside dir.
+func (run *Run) isolateRenderers(workers int, dir string) error {
+	run.workerRenderers = make([]map[string]*Renderer, workers)
+	for worker := range workers {
+		run.workerRenderers[worker] = make(map[string]*Renderer)
+		for name, renderer := range run.Renderers {
+			profileDir := filepath.Join(dir, fmt.Sprintf("%s-%d", name, worker+1))
+			if err := os.MkdirAll(profileDir, 0755); err != nil {
+				return fmt.Errorf("could not create renderer profile dir: %w", err)
+			}
+			run.workerRenderers[worker][name] = renderer.isolate(profileDir)
+		}
+	}
+	return nil
+}
+
+// Pick the renderer to export an image with: its worker's own one when
+// images are processed in parallel, or the run's otherwise.
+func (run *Run) imageRenderer(image *Image) *Renderer {
+	if renderers, ok := run.imageRenderers.Load(image); ok {
+		return pickRenderer(renderers.(map[string]*Renderer), image.Renderer)
+	}
+	return run.renderer(image.Renderer)
+}
+
+// Process the images, filling in the slides of each at the same index of
+// results so that the deck keeps its order whichever finishes first. With a
+// single worker they are simply processed one after another.
+func processImages(run *Run, images []*Image, results [][]*Slide) {
+	workers := min(len(run.workerRenderers), len(images))
+	if workers <= 1 {
+		for i, image := range images {
+			if run.stopping() {
+				break
+			}
+			results[i] = image.processImage(run)
+		}
+		return
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				run.imageRenderers.Store(images[i], run.workerRenderers[worker])
+				results[i] = images[i].processImage(run)
+				run.imageRenderers.Delete(images[i])
+			}
+		}()
+	}
+	for i := range images {
+		if run.stopping() {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
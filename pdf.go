@@ -0,0 +1,113 @@
+// Assemble the rendered layers into a single multi-page PDF, as a handout or
+// preview version of the deck alongside the video assets. The pages are the
+// rendered PNGs rather than vectors exported by the renderer, so text can't be
+// selected or searched, and zooming in shows the pixels.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"os"
+)
+
+// Rendered pixels are placed on the page at 96 DPI, which is the resolution
+// Inkscape assumes for SVG user units: 1280x720 pixels becomes 960x540 points.
+const pdfPointsPerPixel = 0.75
+
+// Flatten an image onto white and return its raw 8-bit RGB samples, since a
+// handout has no use for transparency.
+func rgbSamples(img image.Image) []byte {
+	bounds := img.Bounds()
+	samples := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			white := 0xffff - a
+			samples = append(samples, byte((r+white)>>8), byte((g+white)>>8), byte((b+white)>>8))
+		}
+	}
+	return samples
+}
+
+// Write a PDF with one page per PNG file, each page sized to fit its image.
+func writePDF(filename string, pngFiles []string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(file)
+
+	// Objects 1 and 2 are the catalog and the page tree; each page then uses
+	// three objects of its own (page, content stream and image).
+	var offsets []int
+	written := 0
+	writeObject := func(body string, stream []byte) {
+		offsets = append(offsets, written)
+		n, _ := fmt.Fprintf(out, "%d 0 obj\n%s\n", len(offsets), body)
+		written += n
+		if stream != nil {
+			n, _ = fmt.Fprintf(out, "stream\n")
+			written += n
+			n, _ = out.Write(stream)
+			written += n
+			n, _ = fmt.Fprintf(out, "\nendstream\n")
+			written += n
+		}
+		n, _ = fmt.Fprintf(out, "endobj\n")
+		written += n
+	}
+
+	n, _ := fmt.Fprintf(out, "%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	written += n
+
+	var kids bytes.Buffer
+	for i := range pngFiles {
+		fmt.Fprintf(&kids, "%d 0 R ", 3+i*3)
+	}
+	writeObject("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	writeObject(fmt.Sprintf("<< /Type /Pages /Kids [ %s] /Count %d >>", kids.String(), len(pngFiles)), nil)
+
+	for i, pngFile := range pngFiles {
+		img, err := readPNG(pngFile)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		width := img.Bounds().Dx()
+		height := img.Bounds().Dy()
+		pageWidth := float64(width) * pdfPointsPerPixel
+		pageHeight := float64(height) * pdfPointsPerPixel
+
+		var compressed bytes.Buffer
+		zipper := zlib.NewWriter(&compressed)
+		zipper.Write(rgbSamples(img))
+		zipper.Close()
+
+		pageObj := 3 + i*3
+		content := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q", pageWidth, pageHeight)
+		writeObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, pageObj+2, pageObj+1), nil)
+		writeObject(fmt.Sprintf("<< /Length %d >>", len(content)), []byte(content))
+		writeObject(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d "+
+			"/ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>",
+			width, height, compressed.Len()), compressed.Bytes())
+	}
+
+	xrefOffset := written
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xrefOffset)
+
+	if err := out.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
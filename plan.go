@@ -0,0 +1,89 @@
+// Count up what a run is about to do before doing any of it, so that a
+// config which fans out into far more exports than intended is caught early.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Count the exports a run will make: each selected layer of each image with
+// its variants, and the images' cards, once for the deck and again for each of
+// its locales, plus any slates.
+func (options *RenderOptions) countExports(images []*Image) (layers int, variants int, cards int, sets int, exports int) {
+	for _, image := range images {
+		for _, layer := range image.Layers {
+			if matchesAny(options.LayerPatterns, layer.Suffix) {
+				layers++
+				variants += len(layer.Variants)
+			}
+		}
+		for _, card := range image.cards() {
+			if matchesAny(options.LayerPatterns, card.Suffix) {
+				cards++
+			}
+		}
+	}
+	sets = 1 + len(localeNames(images))
+	exports = (layers + variants + cards) * sets
+	if options.Slate {
+		exports += sets
+	}
+	return layers, variants, cards, sets, exports
+}
+
+// Estimate how long the exports will take from how long they took in the
+// last run into the same output directory, going by its manifest. Zero means
+// there is nothing to go on.
+func (options *RenderOptions) estimateExports(exports int) time.Duration {
+	if options.Manifest == "" {
+		return 0
+	}
+	manifest, err := readManifest(resolvePath(options.OutDir, options.Manifest))
+	if err != nil {
+		return 0
+	}
+	var total float64
+	var timed int
+	for _, entries := range manifest.Images {
+		for _, entry := range entries {
+			if entry.RenderSeconds > 0 {
+				total += entry.RenderSeconds
+				timed++
+			}
+		}
+	}
+	if timed == 0 {
+		return 0
+	}
+	return time.Duration(total / float64(timed) * float64(exports) * float64(time.Second))
+}
+
+// Log how many exports the run will make, and stop it before it starts if
+// that is more than --max-exports allows.
+func (options *RenderOptions) planExports(images []*Image) error {
+	layers, variants, cards, sets, exports := options.countExports(images)
+	summary := fmt.Sprintf("%d images, %d layers", len(images), layers)
+	if variants > 0 {
+		summary += fmt.Sprintf(" + %d variants", variants)
+	}
+	if cards > 0 {
+		summary += fmt.Sprintf(" + %d cards", cards)
+	}
+	if sets > 1 {
+		summary += fmt.Sprintf(" × %d (the deck and %d locales)", sets, sets-1)
+	}
+	if options.Slate {
+		summary += " + slates"
+	}
+	summary += fmt.Sprintf(" = %d exports", exports)
+	if estimate := options.estimateExports(exports); estimate > 0 {
+		summary += fmt.Sprintf(", est. %s", max(estimate.Round(time.Second), time.Second))
+	}
+	infof("Planned: %s\n", summary)
+	if options.MaxExports > 0 && exports > options.MaxExports {
+		return fmt.Errorf("this run would make %d exports, more than --max-exports %d allows", exports, options.MaxExports)
+	}
+	return nil
+}
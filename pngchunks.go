@@ -0,0 +1,128 @@
+// Work with the chunks of a PNG file directly, for the changes that don't
+// need the image to be decoded (and re-encoded) at all.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Represent a single chunk of a PNG file.
+type pngChunk struct {
+	Type string
+	Data []byte
+}
+
+// Split a PNG file into its chunks.
+func parsePNGChunks(data []byte) ([]*pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("not a PNG file")
+	}
+	var chunks []*pngChunk
+	for rest := data[len(pngSignature):]; len(rest) > 0; {
+		if len(rest) < 12 {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		length := binary.BigEndian.Uint32(rest[0:4])
+		if uint64(len(rest)) < 12+uint64(length) {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		chunks = append(chunks, &pngChunk{Type: string(rest[4:8]), Data: rest[8 : 8+length]})
+		rest = rest[12+length:]
+	}
+	return chunks, nil
+}
+
+// Write a single chunk of a PNG file, calculating its checksum.
+func writePNGChunk(w io.Writer, chunk *pngChunk) error {
+	binary.Write(w, binary.BigEndian, uint32(len(chunk.Data)))
+	typeAndData := append([]byte(chunk.Type), chunk.Data...)
+	w.Write(typeAndData)
+	return binary.Write(w, binary.BigEndian, crc32.ChecksumIEEE(typeAndData))
+}
+
+// Join chunks back up into a PNG file, recalculating their checksums.
+func encodePNGChunks(chunks []*pngChunk) []byte {
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	for _, chunk := range chunks {
+		writePNGChunk(&out, chunk)
+	}
+	return out.Bytes()
+}
+
+// Rewrite a PNG file's chunks in place with the given function. The file is
+// left alone if nothing is changed.
+func rewritePNGChunks(filename string, rewrite func([]*pngChunk) []*pngChunk) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	chunks, err := parsePNGChunks(data)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", filename, err)
+	}
+	rewritten := encodePNGChunks(rewrite(chunks))
+	if bytes.Equal(rewritten, data) {
+		return nil
+	}
+	return os.WriteFile(filename, rewritten, 0644)
+}
+
+// The keywords of text chunks which record when a file was made, rather than
+// anything about what is in it.
+var pngTimestampKeywords = []string{"Creation Time", "date:create", "date:modify", "date:timestamp"}
+
+// Report whether a chunk only records when the file was written.
+func isTimestampChunk(chunk *pngChunk) bool {
+	switch chunk.Type {
+	case "tIME":
+		return true
+	case "tEXt", "zTXt", "iTXt":
+		keyword, _, _ := bytes.Cut(chunk.Data, []byte{0})
+		return slices.Contains(pngTimestampKeywords, string(keyword))
+	}
+	return false
+}
+
+// Remove timestamps from a PNG file, so that rendering the same SVG twice
+// produces byte-identical files.
+func stripPNGTimestamps(filename string) error {
+	return rewritePNGChunks(filename, func(chunks []*pngChunk) []*pngChunk {
+		return slices.DeleteFunc(chunks, isTimestampChunk)
+	})
+}
+
+// Read the value of a PNG's iTXt chunk with the given keyword, as written by
+// textChunk, or an empty string if the file is unreadable or has no such
+// chunk.
+func pngText(filename string, keyword string) string {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	chunks, err := parsePNGChunks(data)
+	if err != nil {
+		return ""
+	}
+	for _, chunk := range chunks {
+		if chunk.Type != "iTXt" {
+			continue
+		}
+		name, rest, _ := bytes.Cut(chunk.Data, []byte{0})
+		if string(name) == keyword && len(rest) >= 4 {
+			// Skip the compression flag and method, language and
+			// translated keyword, which textChunk leaves empty.
+			return string(rest[4:])
+		}
+	}
+	return ""
+}
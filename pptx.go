@@ -0,0 +1,190 @@
+// Package the rendered slides into a PowerPoint file, one picture-filled
+// slide per layer with its notes as the speaker notes, for people who want
+// "the PowerPoint" of a deck without anyone rebuilding it by hand.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sizes in a PPTX file are in EMUs, of which there are 914400 to the inch;
+// the PNGs are placed at 96 DPI, like the PDF.
+const (
+	emusPerPixel = 9525
+	pptxNotesWidth = 6858000
+	pptxNotesHeight = 9144000
+)
+
+// The namespaces and relationship types of the parts of a presentation.
+const (
+	pptxNamespaces = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"`
+	pptxRelationships = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/"
+	pptxContentTypes = "application/vnd.openxmlformats-officedocument.presentationml."
+)
+
+// An empty shape tree, which every slide, layout and master starts with.
+const pptxTreeStart = `<p:spTree><p:nvGrpSpPr><p:cNvPr id="1" name=""/><p:cNvGrpSpPr/><p:nvPr/></p:nvGrpSpPr><p:grpSpPr/>`
+
+// The color map every slide follows from the master.
+const pptxColorMap = `<p:clrMap bg1="lt1" tx1="dk1" bg2="lt2" tx2="dk2" accent1="accent1" accent2="accent2" accent3="accent3" accent4="accent4" accent5="accent5" accent6="accent6" hlink="hlink" folHlink="folHlink"/>`
+
+// A plain theme, which PowerPoint insists on even though every slide is just
+// a picture.
+const pptxTheme = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<a:theme xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" name="bulletpointer"><a:themeElements>
+<a:clrScheme name="bulletpointer"><a:dk1><a:srgbClr val="000000"/></a:dk1><a:lt1><a:srgbClr val="FFFFFF"/></a:lt1><a:dk2><a:srgbClr val="44546A"/></a:dk2><a:lt2><a:srgbClr val="E7E6E6"/></a:lt2><a:accent1><a:srgbClr val="4472C4"/></a:accent1><a:accent2><a:srgbClr val="ED7D31"/></a:accent2><a:accent3><a:srgbClr val="A5A5A5"/></a:accent3><a:accent4><a:srgbClr val="FFC000"/></a:accent4><a:accent5><a:srgbClr val="5B9BD5"/></a:accent5><a:accent6><a:srgbClr val="70AD47"/></a:accent6><a:hlink><a:srgbClr val="0563C1"/></a:hlink><a:folHlink><a:srgbClr val="954F72"/></a:folHlink></a:clrScheme>
+<a:fontScheme name="bulletpointer"><a:majorFont><a:latin typeface="Calibri"/><a:ea typeface=""/><a:cs typeface=""/></a:majorFont><a:minorFont><a:latin typeface="Calibri"/><a:ea typeface=""/><a:cs typeface=""/></a:minorFont></a:fontScheme>
+<a:fmtScheme name="bulletpointer"><a:fillStyleLst><a:solidFill><a:schemeClr val="phClr"/></a:solidFill><a:solidFill><a:schemeClr val="phClr"/></a:solidFill><a:solidFill><a:schemeClr val="phClr"/></a:solidFill></a:fillStyleLst><a:lnStyleLst><a:ln w="6350"><a:solidFill><a:schemeClr val="phClr"/></a:solidFill></a:ln><a:ln w="12700"><a:solidFill><a:schemeClr val="phClr"/></a:solidFill></a:ln><a:ln w="19050"><a:solidFill><a:schemeClr val="phClr"/></a:solidFill></a:ln></a:lnStyleLst><a:effectStyleLst><a:effectStyle><a:effectLst/></a:effectStyle><a:effectStyle><a:effectLst/></a:effectStyle><a:effectStyle><a:effectLst/></a:effectStyle></a:effectStyleLst><a:bgFillStyleLst><a:solidFill><a:schemeClr val="phClr"/></a:solidFill><a:solidFill><a:schemeClr val="phClr"/></a:solidFill><a:solidFill><a:schemeClr val="phClr"/></a:solidFill></a:bgFillStyleLst></a:fmtScheme>
+</a:themeElements></a:theme>`
+
+// Build a relationships part from pairs of type (under the officeDocument
+// namespace) and target, numbered rId1 onwards.
+func pptxRels(pairs ...string) string {
+	var buf strings.Builder
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	buf.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fmt.Fprintf(&buf, `<Relationship Id="rId%d" Type="%s%s" Target="%s"/>`, i/2+1, pptxRelationships, pairs[i], pairs[i+1])
+	}
+	buf.WriteString(`</Relationships>`)
+	return buf.String()
+}
+
+// Build the text paragraphs of the speaker notes, one per line.
+func pptxParagraphs(text string) string {
+	var buf strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		fmt.Fprintf(&buf, `<a:p><a:r><a:rPr lang="en-US" dirty="0"/><a:t>%s</a:t></a:r></a:p>`, xmlEscape(line))
+	}
+	return buf.String()
+}
+
+// Describe a slide for its picture's alt text: the SVG's description, or else
+// its title.
+func pptxAltText(slide *Slide) string {
+	if slide.AltText != "" {
+		return slide.AltText
+	}
+	if slide.Title != "" {
+		return slide.Title
+	}
+	return slide.AltTitle
+}
+
+// Write a PPTX file with one slide per PNG, sized to the first of them. A
+// PNG of another shape is fitted into the slide, centred.
+func writePPTX(filename string, title string, slides []*Slide) error {
+	if len(slides) == 0 {
+		return fmt.Errorf("there are no slides to put in %s", filename)
+	}
+	pngs := make([][]byte, len(slides))
+	sizes := make([]image.Point, len(slides))
+	for i, slide := range slides {
+		data, err := os.ReadFile(slide.PngFile)
+		if err != nil {
+			return err
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("decoding %s: %w", slide.PngFile, err)
+		}
+		pngs[i], sizes[i] = data, image.Pt(config.Width, config.Height)
+	}
+	width, height := sizes[0].X*emusPerPixel, sizes[0].Y*emusPerPixel
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	var failed error
+	addBytes := func(name string, content []byte) {
+		if failed != nil {
+			return
+		}
+		var w io.Writer
+		if w, failed = archive.Create(name); failed == nil {
+			_, failed = w.Write(content)
+		}
+	}
+	add := func(name string, content string) {
+		addBytes(name, []byte(content))
+	}
+
+	types := []string{
+		`<Override PartName="/ppt/presentation.xml" ContentType="` + pptxContentTypes + `presentation.main+xml"/>`,
+		`<Override PartName="/ppt/slideMasters/slideMaster1.xml" ContentType="` + pptxContentTypes + `slideMaster+xml"/>`,
+		`<Override PartName="/ppt/slideLayouts/slideLayout1.xml" ContentType="` + pptxContentTypes + `slideLayout+xml"/>`,
+		`<Override PartName="/ppt/notesMasters/notesMaster1.xml" ContentType="` + pptxContentTypes + `notesMaster+xml"/>`,
+		`<Override PartName="/ppt/theme/theme1.xml" ContentType="application/vnd.openxmlformats-officedocument.theme+xml"/>`,
+		`<Override PartName="/ppt/theme/theme2.xml" ContentType="application/vnd.openxmlformats-officedocument.theme+xml"/>`,
+		`<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>`,
+	}
+	presentationRels := []string{"slideMaster", "slideMasters/slideMaster1.xml", "notesMaster", "notesMasters/notesMaster1.xml"}
+	var slideIDs strings.Builder
+	for i, slide := range slides {
+		n := i + 1
+		types = append(types, fmt.Sprintf(`<Override PartName="/ppt/slides/slide%d.xml" ContentType="%sslide+xml"/>`, n, pptxContentTypes))
+		presentationRels = append(presentationRels, "slide", fmt.Sprintf("slides/slide%d.xml", n))
+		fmt.Fprintf(&slideIDs, `<p:sldId id="%d" r:id="rId%d"/>`, 255+n, len(presentationRels)/2)
+
+		// Fit the picture into the slide, keeping its shape.
+		cx, cy := width, sizes[i].Y*width/sizes[i].X
+		if cy > height {
+			cx, cy = sizes[i].X*height/sizes[i].Y, height
+		}
+		add(fmt.Sprintf("ppt/slides/slide%d.xml", n), fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<p:sld %s><p:cSld>%s<p:pic><p:nvPicPr><p:cNvPr id="2" name="Slide %d" descr="%s"/><p:cNvPicPr><a:picLocks noChangeAspect="1"/></p:cNvPicPr><p:nvPr/></p:nvPicPr><p:blipFill><a:blip r:embed="rId2"/><a:stretch><a:fillRect/></a:stretch></p:blipFill><p:spPr><a:xfrm><a:off x="%d" y="%d"/><a:ext cx="%d" cy="%d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></p:spPr></p:pic></p:spTree></p:cSld><p:clrMapOvr><a:masterClrMapping/></p:clrMapOvr></p:sld>`,
+			pptxNamespaces, pptxTreeStart, n, xmlEscape(pptxAltText(slide)), (width-cx)/2, (height-cy)/2, cx, cy))
+		slideRels := []string{"slideLayout", "../slideLayouts/slideLayout1.xml", "image", fmt.Sprintf("../media/image%d.png", n)}
+		if notes := strings.TrimSpace(slide.Notes); notes != "" {
+			types = append(types, fmt.Sprintf(`<Override PartName="/ppt/notesSlides/notesSlide%d.xml" ContentType="%snotesSlide+xml"/>`, n, pptxContentTypes))
+			slideRels = append(slideRels, "notesSlide", fmt.Sprintf("../notesSlides/notesSlide%d.xml", n))
+			add(fmt.Sprintf("ppt/notesSlides/notesSlide%d.xml", n), fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<p:notes %s><p:cSld>%s<p:sp><p:nvSpPr><p:cNvPr id="2" name="Notes Placeholder 1"/><p:cNvSpPr><a:spLocks noGrp="1"/></p:cNvSpPr><p:nvPr><p:ph type="body" idx="1"/></p:nvPr></p:nvSpPr><p:spPr/><p:txBody><a:bodyPr/><a:lstStyle/>%s</p:txBody></p:sp></p:spTree></p:cSld><p:clrMapOvr><a:masterClrMapping/></p:clrMapOvr></p:notes>`,
+				pptxNamespaces, pptxTreeStart, pptxParagraphs(notes)))
+			add(fmt.Sprintf("ppt/notesSlides/_rels/notesSlide%d.xml.rels", n), pptxRels("notesMaster", "../notesMasters/notesMaster1.xml", "slide", fmt.Sprintf("../slides/slide%d.xml", n)))
+		}
+		add(fmt.Sprintf("ppt/slides/_rels/slide%d.xml.rels", n), pptxRels(slideRels...))
+		addBytes(fmt.Sprintf("ppt/media/image%d.png", n), pngs[i])
+	}
+	presentationRels = append(presentationRels, "theme", "theme/theme1.xml")
+
+	add("[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Default Extension="png" ContentType="image/png"/>`+strings.Join(types, "")+`</Types>`)
+	add("_rels/.rels", strings.Replace(pptxRels("officeDocument", "ppt/presentation.xml", "metadata/core-properties", "docProps/core.xml"),
+		pptxRelationships+"metadata/core-properties", "http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties", 1))
+	add("docProps/core.xml", fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><dc:title>%s</dc:title><dc:creator>bulletpointer %s</dc:creator><dcterms:created xsi:type="dcterms:W3CDTF">%s</dcterms:created></cp:coreProperties>`,
+		xmlEscape(title), xmlEscape(toolVersion()), time.Now().UTC().Format(time.RFC3339)))
+	add("ppt/presentation.xml", fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<p:presentation %s><p:sldMasterIdLst><p:sldMasterId id="2147483648" r:id="rId1"/></p:sldMasterIdLst><p:notesMasterIdLst><p:notesMasterId r:id="rId2"/></p:notesMasterIdLst><p:sldIdLst>%s</p:sldIdLst><p:sldSz cx="%d" cy="%d"/><p:notesSz cx="%d" cy="%d"/></p:presentation>`,
+		pptxNamespaces, slideIDs.String(), width, height, pptxNotesWidth, pptxNotesHeight))
+	add("ppt/_rels/presentation.xml.rels", pptxRels(presentationRels...))
+	add("ppt/slideMasters/slideMaster1.xml", fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<p:sldMaster %s><p:cSld><p:bg><p:bgRef idx="1001"><a:schemeClr val="bg1"/></p:bgRef></p:bg>%s</p:spTree></p:cSld>%s<p:sldLayoutIdLst><p:sldLayoutId id="2147483649" r:id="rId1"/></p:sldLayoutIdLst></p:sldMaster>`,
+		pptxNamespaces, pptxTreeStart, pptxColorMap))
+	add("ppt/slideMasters/_rels/slideMaster1.xml.rels", pptxRels("slideLayout", "../slideLayouts/slideLayout1.xml", "theme", "../theme/theme1.xml"))
+	add("ppt/slideLayouts/slideLayout1.xml", fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<p:sldLayout %s type="blank" preserve="1"><p:cSld name="Blank">%s</p:spTree></p:cSld><p:clrMapOvr><a:masterClrMapping/></p:clrMapOvr></p:sldLayout>`,
+		pptxNamespaces, pptxTreeStart))
+	add("ppt/slideLayouts/_rels/slideLayout1.xml.rels", pptxRels("slideMaster", "../slideMasters/slideMaster1.xml"))
+	add("ppt/notesMasters/notesMaster1.xml", fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<p:notesMaster %s><p:cSld>%s<p:sp><p:nvSpPr><p:cNvPr id="2" name="Notes Placeholder 1"/><p:cNvSpPr><a:spLocks noGrp="1"/></p:cNvSpPr><p:nvPr><p:ph type="body" idx="1"/></p:nvPr></p:nvSpPr><p:spPr><a:xfrm><a:off x="685800" y="4400550"/><a:ext cx="5486400" cy="3600450"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></p:spPr><p:txBody><a:bodyPr/><a:lstStyle/><a:p><a:endParaRPr lang="en-US"/></a:p></p:txBody></p:sp></p:spTree></p:cSld>%s</p:notesMaster>`,
+		pptxNamespaces, pptxTreeStart, pptxColorMap))
+	add("ppt/notesMasters/_rels/notesMaster1.xml.rels", pptxRels("theme", "../theme/theme2.xml"))
+	add("ppt/theme/theme1.xml", pptxTheme)
+	add("ppt/theme/theme2.xml", pptxTheme)
+	if failed != nil {
+		return failed
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf.Bytes(), 0644)
+}
@@ -0,0 +1,178 @@
+// Record where the time goes during a run (XML parsing, DOM mutation,
+// serialization, rendering, PNG encoding) and write it out as a profile that
+// flame graph tools understand.
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Accumulate wall-clock time against call-stack-like paths such as
+// [deck.svg, _b, render]. A nil *Profile records nothing, so callers don't
+// need to check whether profiling was requested.
+type Profile struct {
+	mutex sync.Mutex
+	samples map[string]time.Duration
+	start time.Time
+}
+
+// Separate the frames of a stack in the sample map and in folded output.
+const profileSeparator = ";"
+
+// Start an empty profile, timed from now.
+func NewProfile() *Profile {
+	return &Profile{samples: make(map[string]time.Duration), start: time.Now()}
+}
+
+// Start timing the given stack; the returned function stops the timer and
+// records the elapsed time. Intended for use as defer profile.measure(...)().
+func (profile *Profile) measure(stack ...string) func() {
+	if profile == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		profile.mutex.Lock()
+		defer profile.mutex.Unlock()
+		profile.samples[strings.Join(stack, profileSeparator)] += elapsed
+	}
+}
+
+// Return the recorded stacks in a stable order.
+func (profile *Profile) stacks() []string {
+	stacks := make([]string, 0, len(profile.samples))
+	for stack := range profile.samples {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	return stacks
+}
+
+// Write the profile to a file. Files ending in .pb.gz or .pprof get the
+// gzipped protobuf format read by "go tool pprof"; anything else gets the
+// folded-stack text format read by flamegraph.pl, inferno and speedscope,
+// with values in microseconds.
+func (profile *Profile) writeFile(filename string) error {
+	profile.mutex.Lock()
+	defer profile.mutex.Unlock()
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(filename, ".pb.gz") || strings.HasSuffix(filename, ".pprof") {
+		zipper := gzip.NewWriter(file)
+		if _, err := zipper.Write(profile.encodePprof()); err != nil {
+			file.Close()
+			return err
+		}
+		if err := zipper.Close(); err != nil {
+			file.Close()
+			return err
+		}
+	} else {
+		for _, stack := range profile.stacks() {
+			micros := profile.samples[stack].Microseconds()
+			if _, err := fmt.Fprintf(file, "%s %d\n", stack, micros); err != nil {
+				file.Close()
+				return err
+			}
+		}
+	}
+	return file.Close()
+}
+
+// Append a protobuf varint.
+func appendVarint(buf []byte, value uint64) []byte {
+	for value >= 0x80 {
+		buf = append(buf, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(buf, byte(value))
+}
+
+// Append a varint field with the given field number.
+func appendVarintField(buf []byte, field int, value uint64) []byte {
+	buf = appendVarint(buf, uint64(field<<3))
+	return appendVarint(buf, value)
+}
+
+// Append a length-delimited field (bytes, string or embedded message).
+func appendBytesField(buf []byte, field int, value []byte) []byte {
+	buf = appendVarint(buf, uint64(field<<3|2))
+	buf = appendVarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// Encode the samples as an (uncompressed) pprof Profile message, as
+// described by github.com/google/pprof/proto/profile.proto. Each distinct
+// frame name becomes one function with one location.
+func (profile *Profile) encodePprof() []byte {
+	strs := []string{""}
+	strIndex := map[string]uint64{"": 0}
+	intern := func(s string) uint64 {
+		if index, ok := strIndex[s]; ok {
+			return index
+		}
+		strIndex[s] = uint64(len(strs))
+		strs = append(strs, s)
+		return strIndex[s]
+	}
+
+	var out []byte
+	valueType := appendVarintField(nil, 1, intern("wall"))
+	valueType = appendVarintField(valueType, 2, intern("nanoseconds"))
+	out = appendBytesField(out, 1, valueType)
+
+	frameIDs := make(map[string]uint64)
+	var frameNames []string
+	for _, stack := range profile.stacks() {
+		frames := strings.Split(stack, profileSeparator)
+		var locations []byte
+		// pprof lists the leaf frame first.
+		for i := len(frames) - 1; i >= 0; i-- {
+			id, ok := frameIDs[frames[i]]
+			if !ok {
+				frameNames = append(frameNames, frames[i])
+				id = uint64(len(frameNames))
+				frameIDs[frames[i]] = id
+			}
+			locations = appendVarint(locations, id)
+		}
+		sample := appendBytesField(nil, 1, locations)
+		sample = appendBytesField(sample, 2, appendVarint(nil, uint64(profile.samples[stack].Nanoseconds())))
+		out = appendBytesField(out, 2, sample)
+	}
+
+	for i, name := range frameNames {
+		id := uint64(i + 1)
+		line := appendVarintField(nil, 1, id)
+		location := appendVarintField(nil, 1, id)
+		location = appendBytesField(location, 4, line)
+		out = appendBytesField(out, 4, location)
+
+		function := appendVarintField(nil, 1, id)
+		function = appendVarintField(function, 2, intern(name))
+		function = appendVarintField(function, 3, intern(name))
+		out = appendBytesField(out, 5, function)
+	}
+
+	// Intern everything above before the string table is written.
+	timeNanos := uint64(profile.start.UnixNano())
+	durationNanos := uint64(time.Since(profile.start).Nanoseconds())
+	for _, s := range strs {
+		out = appendBytesField(out, 6, []byte(s))
+	}
+	out = appendVarintField(out, 9, timeNanos)
+	out = appendVarintField(out, 10, durationNanos)
+	return out
+}
@@ -0,0 +1,127 @@
+// Show a progress bar with an ETA while layers render, so that a long run
+// doesn't look like it has hung.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The width of the bar itself, in characters.
+const progressBarWidth = 30
+
+// Track how many layers have been rendered out of the total. A nil *Progress
+// does nothing, which is how the bar is disabled.
+type Progress struct {
+	mutex sync.Mutex
+	out io.Writer
+	total int
+	done int
+	current string
+	start time.Time
+}
+
+// Report whether a file is attached to a terminal rather than a pipe or file.
+func isTerminal(file *os.File) bool {
+	fileStat, err := file.Stat()
+	return err == nil && fileStat.Mode()&os.ModeCharDevice != 0
+}
+
+// Start a progress bar for the given number of layers, drawn on the writer.
+func NewProgress(out io.Writer, total int) *Progress {
+	return &Progress{out: out, total: total, start: time.Now()}
+}
+
+// Note which layer is being worked on now.
+func (progress *Progress) begin(image string, layer string) {
+	if progress == nil {
+		return
+	}
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	progress.current = image + " " + layer
+	progress.draw()
+}
+
+// Count one more layer as finished, whether or not it succeeded.
+func (progress *Progress) step() {
+	if progress == nil {
+		return
+	}
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	progress.done++
+	progress.draw()
+}
+
+// Count several layers as finished without working on them.
+func (progress *Progress) skip(layers int) {
+	if progress == nil {
+		return
+	}
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	progress.done += layers
+	progress.draw()
+}
+
+// Remove the bar from the terminal once the run is over.
+func (progress *Progress) finish() {
+	if progress == nil {
+		return
+	}
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	fmt.Fprint(progress.out, "\r\033[K")
+}
+
+// Format a duration as mm:ss (or hh:mm:ss when it's long enough).
+func clock(d time.Duration) string {
+	seconds := int(d.Round(time.Second).Seconds())
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, (seconds/60)%60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+// Redraw the bar in place. The caller must hold the mutex.
+func (progress *Progress) draw() {
+	filled := 0
+	if progress.total > 0 {
+		filled = progressBarWidth * progress.done / progress.total
+	}
+	elapsed := time.Since(progress.start)
+	eta := "--:--"
+	if progress.done > 0 {
+		remaining := elapsed / time.Duration(progress.done) * time.Duration(progress.total-progress.done)
+		eta = clock(remaining)
+	}
+	fmt.Fprintf(progress.out, "\r\033[K[%s%s] %d/%d %s %s ETA %s",
+		strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled),
+		progress.done, progress.total, progress.current, clock(elapsed), eta)
+}
+
+// Wrap a writer (the log output) so that anything written to it clears the
+// bar first and redraws it afterwards, instead of the two getting mixed up.
+func (progress *Progress) wrap(out io.Writer) io.Writer {
+	return &progressWriter{progress: progress, out: out}
+}
+
+type progressWriter struct {
+	progress *Progress
+	out io.Writer
+}
+
+func (writer *progressWriter) Write(data []byte) (int, error) {
+	writer.progress.mutex.Lock()
+	defer writer.progress.mutex.Unlock()
+	fmt.Fprint(writer.progress.out, "\r\033[K")
+	n, err := writer.out.Write(data)
+	writer.progress.draw()
+	return n, err
+}
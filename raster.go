@@ -0,0 +1,54 @@
+// Helpers for working with the rendered PNG files directly in Go, for the
+// features which post-process the renderer's output.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+)
+
+// Decode a PNG file from disk.
+func readPNG(filename string) (image.Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", filename, err)
+	}
+	return img, nil
+}
+
+// Read the size of a PNG file without decoding the whole of it.
+func pngSize(filename string) (image.Point, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return image.Point{}, err
+	}
+	defer file.Close()
+
+	config, err := png.DecodeConfig(file)
+	if err != nil {
+		return image.Point{}, fmt.Errorf("decoding %s: %w", filename, err)
+	}
+	return image.Pt(config.Width, config.Height), nil
+}
+
+// Encode an image to a PNG file on disk, replacing any existing file.
+func writePNG(filename string, img image.Image) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return fmt.Errorf("encoding %s: %w", filename, err)
+	}
+	return file.Close()
+}
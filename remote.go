@@ -0,0 +1,282 @@
+// Fetch source SVGs from HTTP(S) and S3 URLs, caching them locally and
+// revalidating with the server's ETag, and upload outputs back to S3.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report whether a filename from the config is a URL rather than a path.
+func isRemote(name string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://"} {
+		if strings.HasPrefix(strings.ToLower(name), scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the last element of a path or URL, without any query string.
+func remoteBase(name string) string {
+	if u, err := url.Parse(name); err == nil && isRemote(name) {
+		return path.Base(u.Path)
+	}
+	return filepath.Base(name)
+}
+
+// Download remote files into a cache directory, which is keyed by URL. An
+// anonymous fetcher doesn't sign its downloads from S3 with the credentials
+// from the environment, for URLs which come from someone else.
+type remoteFetcher struct {
+	cacheDir string
+	client *http.Client
+	anonymous bool
+}
+
+// Make a fetcher which caches into the given directory, or the user's cache
+// directory if it is empty.
+func newRemoteFetcher(cacheDir string) (*remoteFetcher, error) {
+	if cacheDir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("no cache dir (use --cache-dir): %w", err)
+		}
+		cacheDir = filepath.Join(userCache, "bulletpointer")
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, err
+	}
+	return &remoteFetcher{cacheDir: cacheDir, client: &http.Client{Timeout: 5 * time.Minute}}, nil
+}
+
+// Return the local copy of a remote file, downloading it if it isn't cached
+// or the server says it has changed. If the server can't be reached, a
+// cached copy is used anyway with a warning.
+func (fetcher *remoteFetcher) fetch(remote string) (string, error) {
+	// Anonymous downloads are cached apart, so that they never get a copy
+	// which was downloaded with the credentials.
+	key := sha256.Sum256([]byte(remote))
+	if fetcher.anonymous {
+		key = sha256.Sum256([]byte("anonymous " + remote))
+	}
+	cached := filepath.Join(fetcher.cacheDir, hex.EncodeToString(key[:16])+path.Ext(remoteBase(remote)))
+	etagFile := cached + ".etag"
+
+	request, err := newRemoteRequest(http.MethodGet, remote, nil)
+	if err != nil {
+		return "", err
+	}
+	if etag, err := os.ReadFile(etagFile); err == nil {
+		if _, err := os.Stat(cached); err == nil {
+			request.Header.Set("If-None-Match", string(etag))
+		}
+	}
+	if strings.HasPrefix(remote, "s3://") && !fetcher.anonymous {
+		signRequest(request, emptyPayloadHash)
+	}
+
+	response, err := fetcher.client.Do(request)
+	if err != nil {
+		if _, statErr := os.Stat(cached); statErr == nil {
+			log.Printf("WARNING could not revalidate %s, using the cached copy: %s\n", remote, err.Error())
+			return cached, nil
+		}
+		return "", fmt.Errorf("could not fetch %s: %w", remote, err)
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusNotModified:
+		debugf("Using cached %s\n", remote)
+		return cached, nil
+	case http.StatusOK:
+	default:
+		return "", fmt.Errorf("could not fetch %s: %s", remote, response.Status)
+	}
+
+	// Written to a temporary file first so that an interrupted download
+	// never leaves a truncated file in the cache.
+	temp, err := os.CreateTemp(fetcher.cacheDir, "download-")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(temp, response.Body)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), cached)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return "", fmt.Errorf("could not fetch %s: %w", remote, err)
+	}
+	if etag := response.Header.Get("ETag"); etag != "" {
+		os.WriteFile(etagFile, []byte(etag), 0644)
+	} else {
+		os.Remove(etagFile)
+	}
+	infof("Fetched %s\n", remote)
+	return cached, nil
+}
+
+// Upload every file under a directory to an S3 prefix, keeping their paths.
+func (fetcher *remoteFetcher) upload(dir string, prefix string) error {
+	if !strings.HasPrefix(prefix, "s3://") {
+		return fmt.Errorf("can only upload to s3:// URLs, not %q", prefix)
+	}
+	files, err := listFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		target := strings.TrimSuffix(prefix, "/") + "/" + name
+		request, err := newRemoteRequest(http.MethodPut, target, data)
+		if err != nil {
+			return err
+		}
+		payloadHash := sha256.Sum256(data)
+		signRequest(request, hex.EncodeToString(payloadHash[:]))
+		response, err := fetcher.client.Do(request)
+		if err != nil {
+			return fmt.Errorf("could not upload %s: %w", target, err)
+		}
+		response.Body.Close()
+		if response.StatusCode/100 != 2 {
+			return fmt.Errorf("could not upload %s: %s", target, response.Status)
+		}
+		debugf("Uploaded %s\n", target)
+	}
+	infof("Uploaded %d files to %s\n", len(files), prefix)
+	return nil
+}
+
+// Build the HTTP request for a remote file. S3 URLs go to AWS, or to
+// AWS_ENDPOINT_URL (with path-style addressing) for compatible services.
+func newRemoteRequest(method string, remote string, body []byte) (*http.Request, error) {
+	target := remote
+	if strings.HasPrefix(remote, "s3://") {
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(remote, "s3://"), "/")
+		if bucket == "" || key == "" {
+			return nil, fmt.Errorf("S3 URL %q should be s3://bucket/key", remote)
+		}
+		escapedKey := (&url.URL{Path: "/" + key}).EscapedPath()
+		if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+			target = strings.TrimSuffix(endpoint, "/") + "/" + bucket + escapedKey
+		} else {
+			target = fmt.Sprintf("https://%s.s3.%s.amazonaws.com%s", bucket, awsRegion(), escapedKey)
+		}
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	return http.NewRequest(method, target, reader)
+}
+
+// The SHA-256 of an empty request body, as S3 wants it.
+var emptyPayloadHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+// Return the AWS region from the environment, us-east-1 if it isn't set.
+func awsRegion() string {
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(name); region != "" {
+			return region
+		}
+	}
+	return "us-east-1"
+}
+
+// Compute an HMAC-SHA256.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Sign a request to S3 with AWS Signature Version 4, using the credentials
+// from the environment. Without credentials the request is left unsigned,
+// which works for public buckets.
+func signRequest(request *http.Request, payloadHash string) {
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	region := awsRegion()
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		request.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, region)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// Return the local path of the image's SVG, fetching it first if it is
+// remote.
+func (image *Image) sourceFile(fetcher *remoteFetcher) (string, error) {
+	if !isRemote(image.Filename) {
+		return resolvePath(image.baseDir, image.Filename), nil
+	}
+	if fetcher == nil {
+		return "", fmt.Errorf("remote file %s can't be fetched here", image.Filename)
+	}
+	return fetcher.fetch(image.Filename)
+}
@@ -0,0 +1,325 @@
+// Run the external renderer (Inkscape) which turns each intermediate SVG
+// into the PNG that actually gets used.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Represent the settings which change how an individual export is done.
+type ExportOptions struct {
+	// Either "transparent" or a color for the area behind the drawing.
+	// Empty means that the document's own page color is used.
+	Background string
+
+	// Which part of the document to export: "page" (the default),
+	// "drawing", "id:<elementID>" or "x0:y0:x1:y1" in user units.
+	Area string
+
+	// The size in pixels that the page is scaled to, as WIDTHxHEIGHT.
+	// Empty means the default video resolution.
+	Resolution string
+
+	// Whether text is converted to paths in the exported file.
+	TextToPath bool
+
+	// Which page of a multi-page document to export, counting from 1, or 0
+	// for the document's first (or only) page.
+	Page int
+
+	// Extra arguments passed to the renderer ahead of the SVG file.
+	RendererArgs []string
+}
+
+// The resolution pages are exported at unless one is configured.
+const defaultResolution = "1280x720"
+
+// The renderers which can be named in "renderer:".
+var knownRenderers = map[string]bool{"inkscape": true, "docker": true}
+
+// Split a WIDTHxHEIGHT resolution into its two parts.
+func parseResolution(resolution string) (int, int, error) {
+	if resolution == "" {
+		resolution = defaultResolution
+	}
+	width, height, found := strings.Cut(strings.ToLower(resolution), "x")
+	w, wErr := strconv.Atoi(width)
+	h, hErr := strconv.Atoi(height)
+	if !found || wErr != nil || hErr != nil || w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("resolution %q should be WIDTHxHEIGHT, such as 1920x1080", resolution)
+	}
+	return w, h, nil
+}
+
+// Translate an export area into renderer arguments. Only the full page is
+// scaled to the video resolution; anything else is exported at its natural
+// size (96 DPI), since forcing a crop into the resolution would distort it.
+func areaArgs(options ExportOptions) ([]string, error) {
+	area := options.Area
+	switch {
+	case area == "" || area == "page":
+		width, height, err := parseResolution(options.Resolution)
+		if err != nil {
+			return nil, err
+		}
+		return []string{"--export-area-page", fmt.Sprintf("--export-width=%d", width), fmt.Sprintf("--export-height=%d", height)}, nil
+	case area == "drawing":
+		return []string{"--export-area-drawing", "--export-dpi=96"}, nil
+	case strings.HasPrefix(area, "id:"):
+		id := strings.TrimPrefix(area, "id:")
+		if id == "" {
+			return nil, fmt.Errorf("area %q is missing an element ID", area)
+		}
+		return []string{fmt.Sprintf("--export-id=%s", id), "--export-id-only", "--export-dpi=96"}, nil
+	}
+
+	coords := strings.Split(area, ":")
+	if len(coords) != 4 {
+		return nil, fmt.Errorf("area %q should be page, drawing, id:<elementID> or x0:y0:x1:y1", area)
+	}
+	for _, coord := range coords {
+		if _, err := strconv.ParseFloat(coord, 64); err != nil {
+			return nil, fmt.Errorf("area %q has a non-numeric coordinate %q", area, coord)
+		}
+	}
+	return []string{fmt.Sprintf("--export-area=%s", area), "--export-dpi=96"}, nil
+}
+
+// The command which runs Inkscape when nothing else has been configured.
+var flatpakInkscape = []string{"/usr/bin/flatpak", "run", "org.inkscape.Inkscape"}
+
+// Pick the version number out of "inkscape --version".
+var inkscapeVersion = regexp.MustCompile(`Inkscape ((\d+)\.\d+[^\s]*)`)
+
+// Represent how the renderer is run: the command which starts it, how long
+// a single export may take before it is killed, and how many times a failed
+// export is retried.
+type Renderer struct {
+	Command []string
+
+	// The container image to run Inkscape in, for "renderer: docker".
+	Docker string
+
+	Timeout time.Duration
+	Retries int
+	Backoff time.Duration
+
+	// The Inkscape version found by probe, and whether it is old enough
+	// (0.92 or earlier) to need the pre-1.0 export flags.
+	Version string
+	legacy bool
+
+	// The Inkscape profile directory (preferences and caches) the renderer
+	// uses instead of the user's own, when it is one of several running at
+	// once.
+	ProfileDir string
+
+	// The fonts the renderer can see, for checking documents against.
+	fonts fontList
+}
+
+// Report the command which starts the renderer, ahead of its arguments. The
+// files are the ones the export reads and writes, which a container needs to
+// be able to see.
+func (renderer *Renderer) command(files ...string) []string {
+	if renderer.Docker != "" {
+		return renderer.dockerCommand(files)
+	}
+	if len(renderer.Command) == 0 {
+		return flatpakInkscape
+	}
+	return renderer.Command
+}
+
+// Check that the renderer can actually be started and find out which version
+// of Inkscape it is, so that a missing installation shows up before any work
+// is done rather than on the first export.
+func (renderer *Renderer) probe() error {
+	output, err := renderer.run([]string{"--version"})
+	if err != nil {
+		return fmt.Errorf("renderer %s is not working: %w", strings.Join(renderer.command(), " "), err)
+	}
+	match := inkscapeVersion.FindStringSubmatch(string(output))
+	if match == nil {
+		return fmt.Errorf("could not find an Inkscape version in %q", trimOutput(string(output), maxRendererOutput))
+	}
+	renderer.Version = match[1]
+	major, _ := strconv.Atoi(match[2])
+	renderer.legacy = major < 1
+	return nil
+}
+
+// Report whether the renderer can read an SVG from stdin (with --pipe, from
+// Inkscape 1.0 on) rather than from a file. A container still gets files,
+// since those are what tell it which directories to mount.
+func (renderer *Renderer) canPipe() bool {
+	return renderer != nil && !renderer.legacy && renderer.Docker == ""
+}
+
+// Export an SVG file to a PNG file, without the timestamps that would make
+// otherwise identical exports differ. A failed (or hung) export is retried
+// with an increasing delay before giving up on it.
+func (renderer *Renderer) exportPNG(svgFile string, pngFile string, options ExportOptions) error {
+	return renderer.export(svgFile, nil, pngFile, options)
+}
+
+// Export an SVG document to a PNG file as exportPNG does, but streaming the
+// document to the renderer instead of writing it out first.
+func (renderer *Renderer) exportPNGData(svgData []byte, pngFile string, options ExportOptions) error {
+	return renderer.export("", svgData, pngFile, options)
+}
+
+// Export either an SVG file or, with no file, the SVG data over a pipe.
+func (renderer *Renderer) export(svgFile string, svgData []byte, pngFile string, options ExportOptions) error {
+	if renderer == nil {
+		renderer = &Renderer{}
+	}
+	var args []string
+	if renderer.legacy {
+		args = append(args, "--without-gui", fmt.Sprintf("--export-png=%s", pngFile))
+	} else {
+		args = append(args, fmt.Sprintf("--export-filename=%s", pngFile))
+	}
+	area, err := areaArgs(options)
+	if err != nil {
+		return err
+	}
+	args = append(args, area...)
+	page, err := renderer.pageArgs(options.Page)
+	if err != nil {
+		return err
+	}
+	args = append(args, page...)
+
+	if options.Background == "transparent" {
+		args = append(args, "--export-background=#ffffff", "--export-background-opacity=0")
+	} else if options.Background != "" {
+		args = append(args, fmt.Sprintf("--export-background=%s", options.Background),
+			"--export-background-opacity=1")
+	}
+
+	if options.TextToPath {
+		args = append(args, "--export-text-to-path")
+	}
+
+	args = append(args, options.RendererArgs...)
+	source, files := svgFile, []string{svgFile, pngFile}
+	if svgFile == "" {
+		args = append(args, "--pipe")
+		source, files = pngFile, []string{pngFile}
+	} else {
+		args = append(args, svgFile)
+	}
+
+	backoff := renderer.Backoff
+	for attempt := 0; ; attempt++ {
+		var input io.Reader
+		if svgFile == "" {
+			input = bytes.NewReader(svgData)
+		}
+		_, err = renderer.runInput(args, input, files...)
+		if err == nil || attempt >= renderer.Retries || errors.Is(err, errInterrupted) {
+			break
+		}
+		log.Printf("Retrying %s in %s: %s\n", source, backoff, err.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	if errors.Is(err, errInterrupted) {
+		// Whatever the renderer got as far as writing is no use to anyone.
+		os.Remove(pngFile)
+		return err
+	}
+	if err != nil {
+		if renderer.Retries > 0 {
+			return fmt.Errorf("failed after %d attempts: %w", renderer.Retries+1, err)
+		}
+		return err
+	}
+	return stripPNGTimestamps(pngFile)
+}
+
+// The most of the renderer's output which is included in an error, since a
+// misbehaving renderer can print a great deal.
+const maxRendererOutput = 2000
+
+// Run the renderer once with the given arguments, killing it if it takes
+// longer than the timeout. Whatever it prints is returned, and included in
+// the error if it fails; with --verbose it is also shown as it happens.
+func (renderer *Renderer) run(args []string, files ...string) ([]byte, error) {
+	return renderer.runInput(args, nil, files...)
+}
+
+// Run the renderer as run does, with input (if not nil) as its stdin. A
+// signal stops it as the timeout does, though politely at first so that
+// Inkscape (or the container) can shut down rather than being left behind.
+func (renderer *Renderer) runInput(args []string, input io.Reader, files ...string) ([]byte, error) {
+	ctx := interrupted
+	if renderer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, renderer.Timeout)
+		defer cancel()
+	}
+	command := slices.Concat(renderer.command(files...), args)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	// Don't wait forever on output pipes held open by an orphaned child.
+	cmd.WaitDelay = 5 * time.Second
+	cmd.Cancel = func() error {
+		if runtime.GOOS == "windows" {
+			return cmd.Process.Kill()
+		}
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.Stdin = input
+	if renderer.ProfileDir != "" && renderer.Docker == "" {
+		cmd.Env = append(os.Environ(), "INKSCAPE_PROFILE_DIR="+renderer.ProfileDir)
+	}
+
+	var output bytes.Buffer
+	var writer io.Writer = &output
+	if verbosity > 0 {
+		writer = io.MultiWriter(&output, log.Writer())
+	}
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	err := cmd.Run()
+	if isInterrupted() {
+		return output.Bytes(), errInterrupted
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("renderer timed out after %s", renderer.Timeout)
+	}
+	if err != nil {
+		if text := trimOutput(output.String(), maxRendererOutput); text != "" {
+			err = fmt.Errorf("%w: %s", err, text)
+		}
+	}
+	return output.Bytes(), err
+}
+
+// Tidy up a program's output for inclusion in a one-line error, keeping the
+// end of it (where the actual complaint usually is) if it is too long.
+func trimOutput(text string, limit int) string {
+	text = strings.Join(strings.Fields(strings.ReplaceAll(text, "\n", " | ")), " ")
+	text = strings.Trim(text, " |")
+	if runes := []rune(text); len(runes) > limit {
+		text = "..." + string(runes[len(runes)-limit:])
+	}
+	return text
+}
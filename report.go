@@ -0,0 +1,101 @@
+// Produce a machine-readable report of what a run did, so that build
+// pipelines can parse the results instead of scraping the log.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Represent the outcome of a whole run.
+type RunReport struct {
+	Configs []string `json:"configs"`
+	OutDir string `json:"out_dir"`
+	StartedAt time.Time `json:"started_at"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	Images int `json:"images"`
+	Layers int `json:"layers"`
+	Failed int `json:"failed"`
+	Outputs []*LayerReport `json:"outputs"`
+}
+
+// Represent the outcome of a single layer (or generated slide). The exit code
+// is that of the renderer, or -1 when the layer failed for some other reason.
+type LayerReport struct {
+	Image string `json:"image,omitempty"`
+	Layer string `json:"layer,omitempty"`
+	Svg string `json:"svg,omitempty"`
+	Png string `json:"png,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	RenderSeconds float64 `json:"render_seconds,omitempty"`
+	RendererExitCode int `json:"renderer_exit_code"`
+	Error string `json:"error,omitempty"`
+}
+
+// Pull the renderer's exit code out of an error, if that's what it was.
+func rendererExitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// Summarize the run from the slides it produced and the failures it saw.
+func (run *Run) report(configs []string, images int, slides []*Slide, startedAt time.Time) *RunReport {
+	report := &RunReport{
+		Configs: configs,
+		OutDir: run.OutDir,
+		StartedAt: startedAt,
+		ElapsedSeconds: time.Since(startedAt).Seconds(),
+		Images: images,
+		Failed: len(run.Failures),
+		Outputs: []*LayerReport{},
+	}
+
+	for _, slide := range slides {
+		layerReport := &LayerReport{
+			Image: slide.Image,
+			Layer: slide.Layer,
+			Svg: slide.SvgFile,
+			Png: slide.PngFile,
+			DurationSeconds: slide.seconds(),
+			RenderSeconds: slide.RenderSeconds,
+		}
+		if run.ScratchDir != "" {
+			layerReport.Svg = ""
+		}
+		report.Outputs = append(report.Outputs, layerReport)
+		if slide.Image != "" {
+			report.Layers++
+		}
+	}
+
+	for _, failure := range run.Failures {
+		report.Outputs = append(report.Outputs, &LayerReport{
+			Image: failure.Image,
+			Layer: failure.Layer,
+			RendererExitCode: rendererExitCode(failure.Err),
+			Error: failure.Err.Error(),
+		})
+	}
+	return report
+}
+
+// Write the report as JSON to a file, or to stdout for "-".
+func (report *RunReport) writeFile(filename string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if filename == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
@@ -0,0 +1,42 @@
+// Pick up an interrupted run where it stopped, by recognising the PNGs which
+// an earlier run already exported from exactly the same input.
+
+package main
+
+import (
+	"fmt"
+	"hash"
+
+	"github.com/beevik/etree"
+)
+
+// The keyword of the text chunk holding a PNG's input fingerprint.
+const fingerprintKeyword = "bulletpointer:input-sha256"
+
+// Fingerprint everything that goes into exporting a layer: the intermediate
+// SVG, the export settings and the renderer which does it, plus any captions
+// burned in afterwards. The SVG has already been written through the
+// SHA-256 hash, which the rest is added to.
+func exportFingerprint(hash hash.Hash, options ExportOptions, renderer *Renderer, burnIn *BurnIn, captions []*Cue) string {
+	fmt.Fprintf(hash, "\x00%+v\x00%s\x00%s", options, renderer.Version, renderer.Docker)
+	if burnIn != nil {
+		fmt.Fprintf(hash, "\x00%+v", *burnIn)
+		for _, cue := range captions {
+			fmt.Fprintf(hash, "\x00%+v", *cue)
+		}
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// Write a document to a file and through a hash at the same time, so that a
+// large document isn't held in memory as well just to be fingerprinted.
+func writeFingerprinted(doc *etree.Document, filename string, hash hash.Hash) error {
+	return writeSVG(doc, filename, hash)
+}
+
+// Read the input fingerprint which an export stamped into a PNG, or an empty
+// string if the file is missing, unreadable or was never stamped (as happens
+// when a run is killed partway through an export).
+func pngFingerprint(pngFile string) string {
+	return pngText(pngFile, fingerprintKeyword)
+}
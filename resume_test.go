@@ -0,0 +1,38 @@
+package main
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Write out the large SVG for a layer and fingerprint it. Serializing it to
+// memory first and then writing and hashing that is what was done before
+// both were done in one pass.
+func BenchmarkWriteFingerprinted(b *testing.B) {
+	file, _ := writeLargeTestSVG(b)
+	doc := readLargeTestSVG(b, file)
+	out := filepath.Join(b.TempDir(), "layer.svg")
+	b.Run("through memory", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			data, err := doc.WriteToBytes()
+			if err == nil {
+				err = os.WriteFile(out, data, 0644)
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+			sha256.Sum256(data)
+		}
+	})
+	b.Run("in one pass", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if err := writeFingerprinted(doc, out, sha256.New()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,226 @@
+// Track the state that is shared by everything that happens during a single
+// invocation of the tool.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+)
+
+// Represent one run of the tool: where the outputs are written to, plus
+// anything collected along the way.
+type Run struct {
+	OutDir string
+	Limits *jobLimits
+	Profile *Profile
+	Progress *Progress
+	Remote *remoteFetcher
+	Renderers map[string]*Renderer
+
+	// With --parallel-images, the renderers of each worker, and which of
+	// those each image being processed is using.
+	workerRenderers []map[string]*Renderer
+	imageRenderers sync.Map
+
+	// The values for {{name}} placeholders given on the command line, and
+	// the colors of the --palette file.
+	Variables map[string]string
+	Colors map[string]string
+
+	// Whether PNGs which an earlier run exported from the same input are
+	// kept rather than exported again, and how many of them there were.
+	Resume bool
+	Resumed atomic.Int64
+
+	// Whether to log what each layer's directives change in the document.
+	Trace bool
+
+	// Whether a slide with no visible <desc> to describe it is a failure.
+	RequireAlt bool
+
+	// Whether what each layer exports is optimized first, leaving out what
+	// the renderer wouldn't draw.
+	Optimize bool
+
+	// The margins which nothing on a slide should be drawn within, for
+	// images which don't give their own, and whether to record where each
+	// slide draws.
+	SafeArea string
+	Bounds bool
+
+	// The --layer patterns; layers which match none of them are applied to
+	// the document but not exported.
+	LayerPatterns []string
+
+	// The locale being rendered, which is empty for the deck as written.
+	Locale string
+
+	// Where each image's layers start in the deck (counting from 0), and how
+	// many layers there are altogether, for numbering the slides.
+	SlideOffsets map[*Image]int
+	SlideTotal int
+
+	// Output formats and the filename template requested for every image.
+	Formats []string
+	NameTemplate string
+
+	// Where the intermediate SVG files are written. Empty means next to
+	// their PNG files in the output directory. With CompressSVG they are
+	// written as .svgz.
+	SvgDir string
+	CompressSVG bool
+
+	// A temporary directory owned by the run, which is deleted at the end.
+	ScratchDir string
+
+	// Whether missing output directories should be created rather than
+	// treated as a mistake.
+	Mkdir bool
+
+	// Whether to carry on past a failed layer, and the failures collected
+	// while doing so. Otherwise the first failure stops the run, and is
+	// returned from it once the workers have finished what they were doing.
+	KeepGoing bool
+	Failures []*Failure
+	stopErr error
+	failuresMutex sync.Mutex
+}
+
+// Pick the renderer for an image's "renderer:" setting, where empty means the
+// local Inkscape. When there isn't one (every image runs in a container), the
+// slate and anything else without a preference make do with the other.
+func (run *Run) renderer(name string) *Renderer {
+	return pickRenderer(run.Renderers, name)
+}
+
+// Pick a renderer out of a set of them by name, as for Run.renderer.
+func pickRenderer(renderers map[string]*Renderer, name string) *Renderer {
+	if name == "" {
+		name = "inkscape"
+	}
+	if renderer, ok := renderers[name]; ok {
+		return renderer
+	}
+	for _, renderer := range renderers {
+		return renderer
+	}
+	return nil
+}
+
+// Represent something which went wrong while processing part of an image.
+// Layer is empty when the problem was with the image as a whole.
+type Failure struct {
+	Image string
+	Layer string
+	Err error
+}
+
+// Report a problem with an image or one of its layers. Unless the run is
+// keeping going, this ends the program straight away.
+func (run *Run) fail(image string, layer string, err error) {
+	if run.Locale != "" {
+		image = fmt.Sprintf("%s (%s)", image, run.Locale)
+	}
+	where := image
+	if layer != "" {
+		where = fmt.Sprintf("%s layer %s", image, layer)
+	}
+	// Being stopped isn't a failure of the layer; the run is ending anyway.
+	if errors.Is(err, errInterrupted) {
+		debugf("Stopped %s\n", where)
+		return
+	}
+	if !run.KeepGoing {
+		run.failuresMutex.Lock()
+		defer run.failuresMutex.Unlock()
+		if run.stopErr == nil {
+			run.stopErr = fmt.Errorf("%s: %w", where, err)
+		}
+		return
+	}
+
+	log.Printf("FAILED %s: %s\n", where, err.Error())
+	run.failuresMutex.Lock()
+	defer run.failuresMutex.Unlock()
+	run.Failures = append(run.Failures, &Failure{Image: image, Layer: layer, Err: err})
+}
+
+// Return the failure which stopped the run, if one did.
+func (run *Run) stopError() error {
+	run.failuresMutex.Lock()
+	defer run.failuresMutex.Unlock()
+	return run.stopErr
+}
+
+// Report whether the run should take on no more work, because a signal has
+// asked it to stop or something failed without --keep-going.
+func (run *Run) stopping() bool {
+	return isInterrupted() || run.stopError() != nil
+}
+
+// Print a table of everything which failed during the run.
+func (run *Run) writeFailureReport(w io.Writer) {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "\n%d failure(s):\n", len(run.Failures))
+	fmt.Fprintln(table, "IMAGE\tLAYER\tERROR")
+	for _, failure := range run.Failures {
+		layer := failure.Layer
+		if layer == "" {
+			layer = "-"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", failure.Image, layer, failure.Err.Error())
+	}
+	table.Flush()
+}
+
+// Report whether an image's intermediate SVGs are streamed to the renderer
+// instead of being written out, which is only done when they would be thrown
+// away at the end anyway and no hook might want to look at them.
+func (run *Run) pipesSVG(image *Image, renderer *Renderer) bool {
+	return run.ScratchDir != "" && image.Hooks == nil && renderer.canPipe()
+}
+
+// Make sure the directory which will contain an output file exists, creating
+// it when the run allows. Otherwise a missing directory is reported here, with
+// a clearer message than the renderer would give.
+func (run *Run) prepareDir(file string) error {
+	dir := filepath.Dir(file)
+	if run.Mkdir {
+		return os.MkdirAll(dir, 0755)
+	}
+	if dirStat, err := os.Stat(dir); err != nil || !dirStat.IsDir() {
+		return fmt.Errorf("output dir %s does not exist (use --mkdir to create it)", dir)
+	}
+	return nil
+}
+
+// Work out where the intermediate SVG for the given output PNG is written.
+// Outside of the output directory, the layout of the output directory is
+// mirrored, creating subdirectories as needed.
+func (run *Run) svgPath(pngFile string) (string, error) {
+	base := pngFile[0:(len(pngFile) - len(filepath.Ext(pngFile)))] + ".svg"
+	if run.CompressSVG {
+		base += "z"
+	}
+	if run.SvgDir == "" {
+		return base, nil
+	}
+
+	rel, err := filepath.Rel(run.OutDir, base)
+	if err != nil {
+		return "", err
+	}
+	svgFile := filepath.Join(run.SvgDir, rel)
+	if err := os.MkdirAll(filepath.Dir(svgFile), 0755); err != nil {
+		return "", err
+	}
+	return svgFile, nil
+}
@@ -0,0 +1,91 @@
+// Check that nothing on a slide strays into the margins which a player's
+// controls, a platform's captions or an overscanning TV may cover, as set
+// by "safe_area:" (or --safe-area) as percentages of the page, such as 5%
+// for action-safe or 10% for title-safe.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Parse the margins of a safe area, given like those of CSS: one percentage
+// for every side, two for the top and bottom then the sides, or four for the
+// top, right, bottom and left. They are returned as fractions of the page in
+// that last order.
+func parseSafeArea(value string) ([4]float64, error) {
+	var margins [4]float64
+	fields := strings.Fields(value)
+	var numbers []float64
+	for _, field := range fields {
+		number, err := strconv.ParseFloat(strings.TrimSuffix(field, "%"), 64)
+		if err != nil || !strings.HasSuffix(field, "%") || number < 0 || number >= 50 {
+			return margins, fmt.Errorf("safe area %q should be percentages of the page, from 0%% to under 50%%", value)
+		}
+		numbers = append(numbers, number/100)
+	}
+	switch len(numbers) {
+	case 1:
+		margins = [4]float64{numbers[0], numbers[0], numbers[0], numbers[0]}
+	case 2:
+		margins = [4]float64{numbers[0], numbers[1], numbers[0], numbers[1]}
+	case 4:
+		margins = [4]float64(numbers)
+	default:
+		return margins, fmt.Errorf("safe area %q should have 1, 2 or 4 margins", value)
+	}
+	return margins, nil
+}
+
+// Choose the safe area for an image, where its own takes precedence over the
+// one given for the whole run. Empty means there isn't one to check.
+func (image *Image) safeArea(runSafeArea string) string {
+	if image.SafeArea != "" {
+		return image.SafeArea
+	}
+	return runSafeArea
+}
+
+// Check where the layer draws against the safe area, warning about each
+// element drawn across its margins. Anything which covers the whole of the
+// safe area, such as a background, is meant to bleed off the page and is left
+// alone.
+func (image *Image) checkSafeArea(run *Run, layer *ImageLayer, bounds *layerBounds) error {
+	value := image.safeArea(run.SafeArea)
+	if value == "" {
+		return nil
+	}
+	margins, err := parseSafeArea(value)
+	if err != nil {
+		return err
+	}
+
+	width, height := bounds.width, bounds.height
+	top, right, bottom, left := margins[0]*height, width-margins[1]*width, height-margins[2]*height, margins[3]*width
+	for _, element := range bounds.elements {
+		box, ok := bounds.boxes[element]
+		if !ok || covers(box, [4]float64{left, top, right - left, bottom - top}) {
+			continue
+		}
+		var sides []string
+		if box[1] < top {
+			sides = append(sides, fmt.Sprintf("top by %.0fpx", top-box[1]))
+		}
+		if box[0]+box[2] > right {
+			sides = append(sides, fmt.Sprintf("right by %.0fpx", box[0]+box[2]-right))
+		}
+		if box[1]+box[3] > bottom {
+			sides = append(sides, fmt.Sprintf("bottom by %.0fpx", box[1]+box[3]-bottom))
+		}
+		if box[0] < left {
+			sides = append(sides, fmt.Sprintf("left by %.0fpx", left-box[0]))
+		}
+		if len(sides) > 0 {
+			log.Printf("WARNING %s layer %s: %s crosses the %s safe area, at the %s\n", image.Filename, layer.Suffix, elementName(element), value, strings.Join(sides, ", "))
+		}
+	}
+	return nil
+}
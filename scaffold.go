@@ -0,0 +1,218 @@
+// Write a starter config file, to save looking up the format from scratch.
+// Given an SVG, the config is filled in with a progressive reveal of the
+// elements found in it.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+	"gopkg.in/yaml.v3"
+)
+
+// A commented example showing the most common settings.
+const starterConfig = `# Settings given here apply to every image below, unless it sets them itself.
+defaults:
+  resolution: 1280x720
+  # background: "#ffffff"
+  # name_template: "{{.ImageBase}}{{.Suffix}}.png"
+
+# Each entry is one SVG file; each of its layers becomes one PNG, named
+# after the SVG plus the layer's suffix (or _01, _02, ... if left out).
+images:
+  - filename: deck.svg
+    layers:
+      # Start with just the title showing.
+      - suffix: _title
+        hide_ids: [bullet1, bullet2]
+      # Then reveal each bullet in turn.
+      - suffix: _bullet1
+        show_ids: [bullet1]
+      - suffix: _bullet2
+        show_ids: [bullet2]
+        # Seconds to show this slide for in slides.txt (optional).
+        duration: 5
+`
+
+// Elements directly under the root which are never drawn, so they make no
+// sense to reveal one at a time.
+var undrawnTags = []string{"defs", "metadata", "namedview", "style", "title", "desc", "script"}
+
+// Report whether an element is an Inkscape layer (or sublayer).
+func isInkscapeLayer(element *etree.Element) bool {
+	return element.Tag == "g" && element.SelectAttrValue("inkscape:groupmode", "") == "layer"
+}
+
+// Find the elements of an SVG which are worth revealing one at a time: its
+// Inkscape layers if it has any, otherwise the drawn elements directly under
+// the root which have IDs. Both are returned in document order.
+func revealCandidates(doc *etree.Document) []*etree.Element {
+	root := doc.Root()
+	if root == nil {
+		return nil
+	}
+
+	var layers []*etree.Element
+	var walk func(element *etree.Element)
+	walk = func(element *etree.Element) {
+		for _, child := range element.ChildElements() {
+			if isInkscapeLayer(child) && child.SelectAttrValue("id", "") != "" {
+				layers = append(layers, child)
+			}
+			walk(child)
+		}
+	}
+	walk(root)
+	if len(layers) > 0 {
+		return layers
+	}
+
+	var candidates []*etree.Element
+	for _, child := range root.ChildElements() {
+		if slices.Contains(undrawnTags, child.Tag) || child.SelectAttrValue("id", "") == "" {
+			continue
+		}
+		candidates = append(candidates, child)
+	}
+	return candidates
+}
+
+// Make a YAML scalar node for a string.
+func stringNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+// Make a single-line YAML list of IDs.
+func idListNode(ids []string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+	for _, id := range ids {
+		node.Content = append(node.Content, stringNode(id))
+	}
+	return node
+}
+
+// Build a config for a single SVG which starts with only the first candidate
+// element showing and then reveals the rest one per layer. Each layer is
+// commented with the label or text of the element it reveals, since the IDs
+// alone are often not much to go on.
+func scaffoldConfig(filename string, candidates []*etree.Element) *yaml.Node {
+	var ids []string
+	for _, candidate := range candidates {
+		ids = append(ids, candidate.SelectAttrValue("id", ""))
+	}
+
+	layers := &yaml.Node{Kind: yaml.SequenceNode}
+	for i, candidate := range candidates {
+		layer := &yaml.Node{Kind: yaml.MappingNode}
+		suffix := readableName(candidate)
+		if suffix == "" {
+			suffix = normalizeSuffix(ids[i])
+		}
+		layer.Content = append(layer.Content, stringNode("suffix"), stringNode("_"+suffix))
+		if i == 0 {
+			if len(ids) > 1 {
+				layer.Content = append(layer.Content, stringNode("hide_ids"), idListNode(ids[1:]))
+			}
+			layer.Content = append(layer.Content, stringNode("show_ids"), idListNode(ids[:1]))
+		} else {
+			layer.Content = append(layer.Content, stringNode("show_ids"), idListNode(ids[i:i+1]))
+		}
+
+		description := candidate.SelectAttrValue("inkscape:label", "")
+		if description == "" {
+			description = elementText(candidate)
+		}
+		if runes := []rune(description); len(runes) > 60 {
+			description = strings.TrimSpace(string(runes[:60])) + "..."
+		}
+		if description != "" {
+			layer.HeadComment = description
+		}
+		layers.Content = append(layers.Content, layer)
+	}
+
+	image := &yaml.Node{Kind: yaml.MappingNode}
+	image.Content = append(image.Content, stringNode("filename"), stringNode(filepath.ToSlash(filename)), stringNode("layers"), layers)
+	return &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{image}}
+}
+
+// Generate the starter config for an SVG, with the filename written relative
+// to the directory the config will be saved in.
+func scaffoldSVG(svgFile string, configDir string) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := readSVG(doc, svgFile); err != nil {
+		return nil, fmt.Errorf("error reading SVG XML file: %w", err)
+	}
+	candidates := revealCandidates(doc)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%s has no layers or top-level elements with IDs to reveal (try assign-ids first)", svgFile)
+	}
+
+	return yaml.Marshal(scaffoldConfig(relativeTo(configDir, svgFile), candidates))
+}
+
+// Write a file's path relative to a directory (where a config will be saved),
+// or as it is if it can't be.
+func relativeTo(dir string, file string) string {
+	absDir, dirErr := filepath.Abs(dir)
+	absFile, fileErr := filepath.Abs(file)
+	if dirErr == nil && fileErr == nil {
+		if rel, err := filepath.Rel(absDir, absFile); err == nil {
+			return rel
+		}
+	}
+	return file
+}
+
+// Entry point for "bulletpointer init [deck.svg] [in.yaml]". The config is
+// generated from the SVG if one is given, or is a generic example otherwise,
+// and written to stdout unless a config file is named.
+func initCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] [deck.svg] [in.yaml]")
+	force := flags.Bool("force", false, "overwrite the config file if it already exists")
+	flags.Parse(args)
+	args = flags.Args()
+
+	svgFile := ""
+	if len(args) > 0 && isSVGName(args[0]) {
+		svgFile, args = args[0], args[1:]
+	}
+	if len(args) > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	outFile := ""
+	if len(args) == 1 {
+		outFile = args[0]
+	}
+
+	config := []byte(starterConfig)
+	if svgFile != "" {
+		configDir := "."
+		if outFile != "" {
+			configDir = filepath.Dir(outFile)
+		}
+		var err error
+		if config, err = scaffoldSVG(svgFile, configDir); err != nil {
+			log.Fatalf("%s\n", err.Error())
+		}
+	}
+
+	if outFile == "" {
+		os.Stdout.Write(config)
+		return
+	}
+	if _, err := os.Stat(outFile); err == nil && !*force {
+		log.Fatalf("%s already exists (use --force to overwrite it)\n", outFile)
+	}
+	if err := os.WriteFile(outFile, config, 0644); err != nil {
+		log.Fatalf("Problem writing %s: %s\n", outFile, err.Error())
+	}
+	infof("Wrote %s\n", outFile)
+}
@@ -0,0 +1,247 @@
+// Describe the config file format from the Go types it is decoded into: both
+// to reject keys which would otherwise be silently ignored, and to produce a
+// JSON Schema that editors can use for completion and validation.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Represent one key of a YAML mapping which decodes into a struct.
+type yamlField struct {
+	name string
+	fieldType reflect.Type
+	required bool
+}
+
+// List the YAML keys of a struct type from its yaml tags, skipping
+// unexported fields and those tagged "-".
+func yamlFields(t reflect.Type) []yamlField {
+	var fields []yamlField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("yaml")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields = append(fields, yamlField{name: name, fieldType: field.Type, required: !strings.Contains(options, "omitempty")})
+	}
+	return fields
+}
+
+// Follow pointers down to the type being pointed at.
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// Count the single-character edits needed to turn one string into another.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// Find the known key which an unknown one was most likely meant to be, if
+// any is close enough to be worth suggesting.
+func suggestField(name string, fields []yamlField) string {
+	best, bestDistance := "", 3
+	for _, field := range fields {
+		if distance := editDistance(name, field.name); distance < bestDistance {
+			best, bestDistance = field.name, distance
+		}
+	}
+	return best
+}
+
+// Check a YAML node against the type it will be decoded into, returning an
+// error for every mapping key which doesn't correspond to a field. The YAML
+// package can do this itself, but not through the custom unmarshalers, and
+// this way each problem comes with its line number and a suggestion. Aliases
+// are checked as what they refer to, and the mappings merged in with "<<" as
+// part of the mapping; keys starting with "x-" are left alone, as somewhere to
+// keep anchors for reuse.
+func checkKnownFields(node *yaml.Node, t reflect.Type, what string) error {
+	t = indirectType(t)
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	var problems []error
+	switch {
+	case t.Kind() == reflect.Struct && t != reflect.TypeOf(yaml.Node{}) && node.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if isMergeKey(key) {
+				merged := []*yaml.Node{value}
+				if value.Kind == yaml.SequenceNode {
+					merged = value.Content
+				}
+				for _, mapping := range merged {
+					if err := checkKnownFields(mapping, t, what); err != nil {
+						problems = append(problems, err)
+					}
+				}
+				continue
+			}
+			if strings.HasPrefix(key.Value, "x-") {
+				continue
+			}
+			index := slices.IndexFunc(fields, func(field yamlField) bool { return field.name == key.Value })
+			if index < 0 {
+				problem := fmt.Sprintf("line %d: unknown key %q in %s", key.Line, key.Value, what)
+				if suggestion := suggestField(key.Value, fields); suggestion != "" {
+					problem += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				problems = append(problems, errors.New(problem))
+				continue
+			}
+			if err := checkKnownFields(value, fields[index].fieldType, key.Value); err != nil {
+				problems = append(problems, err)
+			}
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for _, item := range node.Content {
+			if err := checkKnownFields(item, t.Elem(), strings.TrimSuffix(what, "s")); err != nil {
+				problems = append(problems, err)
+			}
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// Allow keys starting with "x-" anywhere, for holding YAML anchors.
+var extensionProperties = map[string]any{"^x-": map[string]any{}}
+
+// Build the JSON Schema for a Go type, describing structs by their yaml tags.
+// A pointer to a plain value may also be null, which is how set_attrs says
+// that an attribute is to be removed.
+func jsonSchema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		schema := jsonSchema(t.Elem())
+		if kind, ok := schema["type"].(string); ok && kind != "object" && kind != "array" {
+			schema["type"] = []string{kind, "null"}
+		}
+		return schema
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64, reflect.Float32:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		var required []string
+		for _, field := range yamlFields(t) {
+			properties[field.name] = jsonSchema(field.fieldType)
+			if field.required {
+				required = append(required, field.name)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": properties, "patternProperties": extensionProperties, "additionalProperties": false}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]any{}
+}
+
+// Build the JSON Schema for a whole config file, in either of its forms.
+func configSchema() map[string]any {
+	include := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"include": map[string]any{"oneOf": []any{
+				map[string]any{"type": "string"},
+				map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			}},
+		},
+		"required": []string{"include"},
+		"additionalProperties": false,
+	}
+	images := map[string]any{
+		"type": "array",
+		"items": map[string]any{"oneOf": []any{map[string]any{"$ref": "#/$defs/image"}, include}},
+	}
+
+	// Layer suffixes may be left out to have them numbered automatically,
+	// and the layers themselves given as "auto" to derive them from the SVG.
+	image := jsonSchema(reflect.TypeOf(Image{}))
+	properties := image["properties"].(map[string]any)
+	layers := properties["layers"].(map[string]any)
+	delete(layers["items"].(map[string]any), "required")
+	properties["layers"] = map[string]any{"oneOf": []any{layers, map[string]any{"const": "auto"}}}
+
+	return map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title": "bulletpointer config",
+		"$defs": map[string]any{"image": image},
+		"oneOf": []any{
+			images,
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"defaults": jsonSchema(reflect.TypeOf(ConfigDefaults{})),
+					"images": images,
+				},
+				"patternProperties": extensionProperties,
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+// Entry point for "bulletpointer schema", which writes the JSON Schema for
+// config files to stdout.
+func schemaCommand(name string, args []string) {
+	flags := newFlagSet(name, "")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(configSchema()); err != nil {
+		log.Fatalf("Problem writing schema: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,143 @@
+// Narrow a run down to part of the deck, so that one config can produce
+// several cuts of it without editing the YAML.
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Split a comma-separated list of tags, ignoring blanks.
+func splitTags(list string) []string {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Report whether a layer belongs in a cut. Untagged layers are in every cut;
+// with "only" a tagged layer must have one of those tags, and with "skip" it
+// must have none of those.
+func (layer *ImageLayer) inCut(only []string, skip []string) bool {
+	hasAny := func(tags []string) bool {
+		return slices.ContainsFunc(layer.Tags, func(tag string) bool { return slices.Contains(tags, tag) })
+	}
+	if len(only) > 0 && len(layer.Tags) > 0 && !hasAny(only) {
+		return false
+	}
+	return !hasAny(skip)
+}
+
+// Drop the layers which --only-tags and --skip-tags leave out, as if they had
+// never been in the config: the ones after them build on the layers before,
+// and composites which stack a dropped layer are dropped as well. Images with
+// no layers left are dropped entirely. This must happen after validateImages,
+// so that automatic suffixes are numbered the same in every cut.
+func (options *RenderOptions) selectLayers(images []*Image) []*Image {
+	only, skip := splitTags(options.OnlyTags), splitTags(options.SkipTags)
+	if len(only) == 0 && len(skip) == 0 {
+		return images
+	}
+	var selected []*Image
+	for _, image := range images {
+		dropped := make(map[string]bool)
+		image.Layers = slices.DeleteFunc(image.Layers, func(layer *ImageLayer) bool {
+			if layer.inCut(only, skip) {
+				return false
+			}
+			debugf("Leaving out %s layer %s\n", image.Filename, layer.Suffix)
+			dropped[layer.Suffix] = true
+			return true
+		})
+		image.Composites = slices.DeleteFunc(image.Composites, func(composite *Composite) bool {
+			for _, source := range composite.Stack {
+				if source.Layer != "" && dropped[source.Layer] {
+					debugf("Leaving out %s composite %s\n", image.Filename, composite.Suffix)
+					return true
+				}
+			}
+			return false
+		})
+		if len(image.Layers) > 0 {
+			selected = append(selected, image)
+		}
+	}
+	return selected
+}
+
+// Check that every pattern is a valid glob, so that a typo fails the run
+// instead of silently matching nothing.
+func checkPatterns(flag string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --%s pattern %q: %w", flag, pattern, err)
+		}
+	}
+	return nil
+}
+
+// Report whether a name matches any of the patterns, where no patterns at all
+// match everything.
+func matchesAny(patterns []string, names ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Report whether an image is one --image asks for, by its filename as given
+// or just the base name of it.
+func (options *RenderOptions) wantsImage(image *Image) bool {
+	return matchesAny(options.ImagePatterns, image.Filename, remoteBase(image.Filename))
+}
+
+// Report whether a layer or composite is one --layer asks for, by its suffix.
+func (run *Run) wantsLayer(suffix string) bool {
+	return matchesAny(run.LayerPatterns, suffix)
+}
+
+// Drop the images which --image leaves out, and those without any layer or
+// composite that --layer asks for, so that they are not even read. The
+// layers of the remaining images are still all applied in turn, since each
+// builds on the ones before, but only the selected ones are exported.
+func (options *RenderOptions) selectImages(images []*Image) ([]*Image, error) {
+	if err := checkPatterns("image", options.ImagePatterns); err != nil {
+		return nil, err
+	}
+	if err := checkPatterns("layer", options.LayerPatterns); err != nil {
+		return nil, err
+	}
+	selected := slices.DeleteFunc(images, func(image *Image) bool {
+		if !options.wantsImage(image) {
+			return true
+		}
+		for _, layer := range image.Layers {
+			if matchesAny(options.LayerPatterns, layer.Suffix) {
+				return false
+			}
+		}
+		for _, composite := range image.Composites {
+			if matchesAny(options.LayerPatterns, composite.Suffix) {
+				return false
+			}
+		}
+		return true
+	})
+	if len(selected) == 0 && (len(options.ImagePatterns) > 0 || len(options.LayerPatterns) > 0) {
+		return nil, fmt.Errorf("nothing matches --image and --layer")
+	}
+	return selected, nil
+}
@@ -0,0 +1,121 @@
+// Serve a live preview of the slides over HTTP, re-rendering whenever an
+// input changes and reloading the page in the browser when it is done.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hold the latest render for the preview server.
+type previewServer struct {
+	mutex sync.Mutex
+	title string
+	outDir string
+	slides []*Slide
+	lastError error
+
+	// Increased after every render, so that pages know to reload.
+	version int
+}
+
+// Record the outcome of a render.
+func (server *previewServer) update(slides []*Slide, err error) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.slides = slides
+	server.lastError = err
+	server.version++
+}
+
+// Serve the preview page, any error from the last render, and the version
+// which the page polls to know when to reload.
+func (server *previewServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	slides, lastError, version := server.slides, server.lastError, server.version
+	server.mutex.Unlock()
+
+	switch r.URL.Path {
+	case "/":
+		preview, err := newHTMLPreview(server.title, slides, server.outDir, false)
+		if err == nil {
+			preview.ReloadURL = "/version"
+			if lastError != nil {
+				preview.Title = fmt.Sprintf("%s (render failed: %s)", server.title, lastError.Error())
+			}
+		}
+		var page []byte
+		if err == nil {
+			page, err = preview.render()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(page)
+	case "/version":
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte(strconv.Itoa(version)))
+	default:
+		w.Header().Set("Cache-Control", "no-store")
+		http.FileServer(http.Dir(server.outDir)).ServeHTTP(w, r)
+	}
+}
+
+// Entry point for "bulletpointer serve in.yaml...". Without --out, the slides
+// are rendered into a temporary directory which is removed afterwards.
+func serveCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] in.yaml...")
+	options := &RenderOptions{}
+	options.registerFlags(flags)
+	listen := flags.String("listen", "localhost:8000", "the address to serve the preview on")
+	interval := flags.Duration("interval", time.Second, "how often to check the inputs for changes")
+	flags.Parse(args)
+	if err := options.takePositional(flags.Args(), false); err != nil {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if options.OutDir == "" {
+		outDir, err := os.MkdirTemp("", "bulletpointer-serve-")
+		if err != nil {
+			log.Fatalf("Could not create output dir: %s\n", err.Error())
+		}
+		defer os.RemoveAll(outDir)
+		options.OutDir = outDir
+	}
+	// The page shows its own progress, and a bar would fight with the log.
+	options.Progress = false
+
+	server := &previewServer{title: strings.Join(options.Configs, ", "), outDir: options.OutDir}
+	trapSignals()
+	// The render under way is waited for, so that it has cleaned up after
+	// itself before the output dir goes.
+	var rendering sync.WaitGroup
+	rendering.Add(1)
+	go func() {
+		defer rendering.Done()
+		watchRenders(options, *interval, func(slides []*Slide, err error) {
+			if err != nil {
+				log.Printf("Render failed: %s\n", err.Error())
+			} else {
+				infof("Rendered %d slides\n", len(slides))
+			}
+			server.update(slides, err)
+		})
+	}()
+
+	infof("Serving the preview on http://%s/\n", *listen)
+	if err := serveUntilInterrupted(&http.Server{Addr: *listen, Handler: server}); err != nil {
+		log.Fatalf("Could not serve the preview: %s\n", err.Error())
+	}
+	rendering.Wait()
+}
@@ -0,0 +1,52 @@
+// Stop cleanly on SIGINT or SIGTERM: no more layers are started, the
+// renderers under way are stopped, and what was finished is kept (with a
+// manifest saying so) while partial PNGs and scratch files are cleaned up. A
+// second signal ends the program at once, as it would have done anyway.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// The error of anything stopped short by a signal.
+var errInterrupted = errors.New("interrupted")
+
+// Done once a signal has asked the program to stop, for everything that
+// runs for a while to check. Without trapSignals it never is.
+var interrupted = context.Background()
+
+// Start watching for the signals which stop the program.
+func trapSignals() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	interrupted = ctx
+	go func() {
+		<-ctx.Done()
+		stop()
+		log.Printf("Interrupted; finishing up (interrupt again to quit at once)\n")
+	}()
+}
+
+// Report whether a signal has asked the program to stop.
+func isInterrupted() bool {
+	return interrupted.Err() != nil
+}
+
+// Serve HTTP until a signal arrives, then stop taking new connections and
+// let the requests under way finish.
+func serveUntilInterrupted(server *http.Server) error {
+	go func() {
+		<-interrupted.Done()
+		server.Shutdown(context.Background())
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Generate a standard slate frame identifying the deliverable (project,
+// date and version), which is placed at the start of the slide sequence.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path/filepath"
+	"text/template"
+)
+
+// Represent the values which are filled into the slate template.
+type SlateInfo struct {
+	Project string
+	Date string
+	Version string
+}
+
+// Escape a value for use as SVG character data.
+func xmlEscape(value string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
+
+var slateTemplate = template.Must(template.New("slate").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(
+	`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="1280" height="720" viewBox="0 0 1280 720">
+  <rect width="1280" height="720" style="fill:#111111"/>
+  <rect x="80" y="80" width="1120" height="560" style="fill:none;stroke:#888888;stroke-width:4"/>
+  <text x="640" y="320" style="font-family:sans-serif;font-size:72px;font-weight:bold;fill:#ffffff;text-anchor:middle">{{xml .Project}}</text>
+  <text x="640" y="430" style="font-family:sans-serif;font-size:40px;fill:#cccccc;text-anchor:middle">{{xml .Date}}</text>
+{{- if .Version}}
+  <text x="640" y="500" style="font-family:sans-serif;font-size:40px;fill:#cccccc;text-anchor:middle">Version {{xml .Version}}</text>
+{{- end}}
+</svg>
+`))
+
+// Write the slate SVG alongside the other intermediates and render it. Returns the
+// slide to prepend to the sequence.
+func (info *SlateInfo) writeSlate(run *Run, duration float64) (*Slide, error) {
+	var buf bytes.Buffer
+	if err := slateTemplate.Execute(&buf, info); err != nil {
+		return nil, err
+	}
+
+	pngFile := filepath.Join(run.OutDir, "slate.png")
+	svgFile, err := run.svgPath(pngFile)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := createSVG(svgFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(buf.Bytes()); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	if err := run.renderer("").exportPNG(svgFile, pngFile, ExportOptions{}); err != nil {
+		return nil, err
+	}
+	return &Slide{PngFile: pngFile, Duration: duration}, nil
+}
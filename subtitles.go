@@ -0,0 +1,142 @@
+// Parse SRT and WebVTT subtitle files, so that layer timings can be derived
+// from the cue timings of a narration track.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Represent a single cue from a subtitle file. Index is the 1-based position
+// of the cue within the file, which is what layers refer to.
+type Cue struct {
+	Index int
+	Start float64
+	End float64
+	Text string
+}
+
+var cueTimestamp = regexp.MustCompile(`^(?:(\d+):)?(\d{1,2}):(\d{2})[.,](\d{1,3})$`)
+
+// Convert an SRT (00:01:02,500) or VTT (01:02.500) timestamp into seconds. A
+// bare number of seconds is accepted too, which is convenient for hand-written
+// "at:" values in the YAML.
+func parseTimestamp(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return seconds, nil
+	}
+
+	match := cueTimestamp.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+	hours, _ := strconv.Atoi("0" + match[1])
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.Atoi(match[3])
+	millis, _ := strconv.Atoi((match[4] + "00")[0:3])
+	return float64(hours*3600+minutes*60+seconds) + float64(millis)/1000, nil
+}
+
+// Read all of the cues out of an SRT or VTT file. Both formats are handled
+// by the same loop: a block of lines separated by blank lines, where the line
+// containing "-->" holds the timing and the lines after it hold the text.
+func parseSubtitles(filename string) ([]*Cue, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var cues []*Cue
+	var current *Cue
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+
+		if line == "" {
+			current = nil
+		} else if strings.Contains(line, "-->") {
+			times := strings.SplitN(line, "-->", 2)
+			// VTT allows cue settings after the end timestamp.
+			endFields := strings.Fields(times[1])
+			if len(endFields) == 0 {
+				return nil, fmt.Errorf("%s:%d: missing end timestamp", filename, lineNumber)
+			}
+			start, err := parseTimestamp(times[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", filename, lineNumber, err)
+			}
+			end, err := parseTimestamp(endFields[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", filename, lineNumber, err)
+			}
+			current = &Cue{Index: len(cues) + 1, Start: start, End: end}
+			cues = append(cues, current)
+		} else if current != nil {
+			if current.Text != "" {
+				current.Text += "\n"
+			}
+			current.Text += line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("no cues found in %s", filename)
+	}
+	return cues, nil
+}
+
+// Work out when each layer starts, based on the caption index or explicit
+// timestamp it was given. Layers without either are left as negative.
+func (image *Image) subtitleStarts(cues []*Cue) ([]float64, error) {
+	starts := make([]float64, len(image.Layers))
+	for i, layer := range image.Layers {
+		starts[i] = -1
+		if layer.Caption > 0 && layer.At != "" {
+			return nil, fmt.Errorf("layer %s: caption and at are mutually exclusive", layer.Suffix)
+		} else if layer.Caption > 0 {
+			if layer.Caption > len(cues) {
+				return nil, fmt.Errorf("layer %s: caption %d is past the last cue (%d)",
+					layer.Suffix, layer.Caption, len(cues))
+			}
+			starts[i] = cues[layer.Caption-1].Start
+		} else if layer.At != "" {
+			start, err := parseTimestamp(layer.At)
+			if err != nil {
+				return nil, fmt.Errorf("layer %s: %w", layer.Suffix, err)
+			}
+			starts[i] = start
+		}
+	}
+	return starts, nil
+}
+
+// Derive the duration of each subtitle-timed layer as the gap until the next
+// timed layer starts. The last timed layer lasts until the final cue ends.
+func subtitleDurations(starts []float64, cues []*Cue) ([]float64, error) {
+	durations := make([]float64, len(starts))
+	next := cues[len(cues)-1].End
+	for i := len(starts) - 1; i >= 0; i-- {
+		if starts[i] < 0 {
+			continue
+		}
+		if starts[i] >= next {
+			return nil, fmt.Errorf("layer %d starts at %gs, which is not before the next layer (%gs)",
+				i+1, starts[i], next)
+		}
+		durations[i] = next - starts[i]
+		next = starts[i]
+	}
+	return durations, nil
+}
@@ -0,0 +1,118 @@
+// Read and write gzip-compressed SVGs (.svgz) as readily as plain ones. A
+// compressed input is recognised by its contents rather than its name, and
+// the intermediate SVGs can be compressed too with --svgz.
+
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// The extensions an SVG can have, plain and compressed.
+var svgExtensions = []string{".svg", ".svgz"}
+
+// Report whether a filename is that of an SVG, plain or compressed.
+func isSVGName(name string) bool {
+	return slices.Contains(svgExtensions, strings.ToLower(filepath.Ext(name)))
+}
+
+// Report whether a filename asks for a compressed SVG.
+func isSVGZName(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".svgz")
+}
+
+// Read an SVG file, as opened by openSVG.
+type svgReader struct {
+	io.Reader
+	file *os.File
+}
+
+// Close the file being read.
+func (reader *svgReader) Close() error {
+	return reader.file.Close()
+}
+
+// Open an SVG file for reading its XML, decompressing it as it is read if it
+// is gzipped (whatever it is called).
+func openSVG(filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReader(file)
+	if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		unzipped, err := gzip.NewReader(buffered)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &svgReader{Reader: unzipped, file: file}, nil
+	}
+	return &svgReader{Reader: buffered, file: file}, nil
+}
+
+// Read an SVG file into a document, plain or compressed.
+func readSVG(doc *etree.Document, filename string) error {
+	reader, err := openSVG(filename)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = doc.ReadFrom(reader)
+	return err
+}
+
+// Write an SVG file, as created by createSVG.
+type svgWriter struct {
+	io.Writer
+	zipped *gzip.Writer
+	file *os.File
+}
+
+// Finish writing the file, flushing what is left to compress first.
+func (writer *svgWriter) Close() error {
+	if writer.zipped != nil {
+		if err := writer.zipped.Close(); err != nil {
+			writer.file.Close()
+			return err
+		}
+	}
+	return writer.file.Close()
+}
+
+// Create an SVG file for writing its XML, which is compressed as it is
+// written if the file is named .svgz.
+func createSVG(filename string) (io.WriteCloser, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	if isSVGZName(filename) {
+		zipped := gzip.NewWriter(file)
+		return &svgWriter{Writer: zipped, zipped: zipped, file: file}, nil
+	}
+	return &svgWriter{Writer: file, file: file}, nil
+}
+
+// Write a document to an SVG file, also writing it to the extra writers
+// (such as a hash) as it goes. What the extra writers get is never
+// compressed.
+func writeSVG(doc *etree.Document, filename string, extra ...io.Writer) error {
+	writer, err := createSVG(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := doc.WriteTo(io.MultiWriter(append([]io.Writer{writer}, extra...)...)); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
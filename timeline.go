@@ -0,0 +1,212 @@
+// Export the slide sequence as a timeline which video editors can import
+// directly, placing each still at its configured time and duration.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Represent a slide's position on the timeline, counted in whole frames so
+// that rounding never accumulates into drift along a long deck.
+type timelineClip struct {
+	Name string
+	URL string
+	Start int
+	Frames int
+}
+
+// Lay the slides out end to end at the given frame rate.
+func layoutTimeline(slides []*Slide, fps int) ([]*timelineClip, error) {
+	var clips []*timelineClip
+	elapsed := 0.0
+	for _, slide := range slides {
+		absPath, err := filepath.Abs(slide.PngFile)
+		if err != nil {
+			return nil, err
+		}
+		start := int(math.Round(elapsed * float64(fps)))
+		elapsed += slide.seconds()
+		end := int(math.Round(elapsed * float64(fps)))
+		clips = append(clips, &timelineClip{
+			Name: filepath.Base(slide.PngFile),
+			URL: (&url.URL{Scheme: "file", Path: filepath.ToSlash(absPath)}).String(),
+			Start: start,
+			Frames: max(end-start, 1),
+		})
+	}
+	return clips, nil
+}
+
+// Write the timeline in the format implied by the file extension: .edl for
+// a CMX 3600 EDL, .otio for OpenTimelineIO, or .fcpxml for Final Cut XML.
+func writeTimeline(filename string, slides []*Slide, fps int) error {
+	if fps <= 0 {
+		return fmt.Errorf("frame rate must be positive, not %d", fps)
+	}
+	clips, err := layoutTimeline(slides, fps)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".edl":
+		data = encodeEDL(clips, fps)
+	case ".otio":
+		data, err = encodeOTIO(clips, fps)
+	case ".fcpxml":
+		// The project takes the size of the first slide; an empty one
+		// the usual 720p.
+		size := image.Pt(1280, 720)
+		if len(slides) > 0 {
+			if size, err = pngSize(slides[0].PngFile); err != nil {
+				return err
+			}
+		}
+		data, err = encodeFCPXML(clips, fps, size)
+	default:
+		return fmt.Errorf("unknown timeline format for %s (use .edl, .otio or .fcpxml)", filename)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// Format a frame count as a non-drop-frame SMPTE timecode.
+func timecode(frames int, fps int) string {
+	return fmt.Sprintf("%02d:%02d:%02d:%02d",
+		frames/(fps*3600), (frames/(fps*60))%60, (frames/fps)%60, frames%fps)
+}
+
+// Encode a CMX 3600 EDL. The record side starts at the customary 01:00:00:00
+// and every still uses the auxiliary "AX" reel with its filename as a comment.
+func encodeEDL(clips []*timelineClip, fps int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("TITLE: bulletpointer\nFCM: NON-DROP FRAME\n\n")
+	recordStart := 3600 * fps
+	for i, clip := range clips {
+		fmt.Fprintf(&buf, "%03d  AX       V     C        %s %s %s %s\n",
+			i+1, timecode(0, fps), timecode(clip.Frames, fps),
+			timecode(recordStart+clip.Start, fps), timecode(recordStart+clip.Start+clip.Frames, fps))
+		fmt.Fprintf(&buf, "* FROM CLIP NAME: %s\n\n", clip.Name)
+	}
+	return buf.Bytes()
+}
+
+// Build an OTIO RationalTime object.
+func otioTime(frames int, fps int) map[string]any {
+	return map[string]any{"OTIO_SCHEMA": "RationalTime.1", "rate": fps, "value": frames}
+}
+
+// Encode an OpenTimelineIO timeline with a single video track of clips.
+func encodeOTIO(clips []*timelineClip, fps int) ([]byte, error) {
+	children := []any{}
+	for _, clip := range clips {
+		children = append(children, map[string]any{
+			"OTIO_SCHEMA": "Clip.1",
+			"name": clip.Name,
+			"media_reference": map[string]any{
+				"OTIO_SCHEMA": "ExternalReference.1",
+				"target_url": clip.URL,
+				"available_range": nil,
+			},
+			"source_range": map[string]any{
+				"OTIO_SCHEMA": "TimeRange.1",
+				"start_time": otioTime(0, fps),
+				"duration": otioTime(clip.Frames, fps),
+			},
+		})
+	}
+
+	timeline := map[string]any{
+		"OTIO_SCHEMA": "Timeline.1",
+		"name": "bulletpointer",
+		"tracks": map[string]any{
+			"OTIO_SCHEMA": "Stack.1",
+			"name": "tracks",
+			"children": []any{map[string]any{
+				"OTIO_SCHEMA": "Track.1",
+				"name": "Slides",
+				"kind": "Video",
+				"children": children,
+			}},
+		},
+	}
+	data, err := json.MarshalIndent(timeline, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Express a frame count as an FCPXML rational time.
+func fcpTime(frames int, fps int) string {
+	return fmt.Sprintf("%d/%ds", frames, fps)
+}
+
+// Encode a Final Cut Pro XML (1.8) project whose spine holds every still, in
+// a format of the given frame size.
+func encodeFCPXML(clips []*timelineClip, fps int, size image.Point) ([]byte, error) {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	doc.CreateDirective("DOCTYPE fcpxml")
+	fcpxml := doc.CreateElement("fcpxml")
+	fcpxml.CreateAttr("version", "1.8")
+
+	resources := fcpxml.CreateElement("resources")
+	format := resources.CreateElement("format")
+	format.CreateAttr("id", "r1")
+	format.CreateAttr("frameDuration", fcpTime(1, fps))
+	format.CreateAttr("width", strconv.Itoa(size.X))
+	format.CreateAttr("height", strconv.Itoa(size.Y))
+
+	total := 0
+	if len(clips) > 0 {
+		last := clips[len(clips)-1]
+		total = last.Start + last.Frames
+	}
+	event := fcpxml.CreateElement("library").CreateElement("event")
+	event.CreateAttr("name", "bulletpointer")
+	project := event.CreateElement("project")
+	project.CreateAttr("name", "Slides")
+	sequence := project.CreateElement("sequence")
+	sequence.CreateAttr("format", "r1")
+	sequence.CreateAttr("duration", fcpTime(total, fps))
+	sequence.CreateAttr("tcStart", "0s")
+	spine := sequence.CreateElement("spine")
+
+	for i, clip := range clips {
+		assetID := fmt.Sprintf("r%d", i+2)
+		asset := resources.CreateElement("asset")
+		asset.CreateAttr("id", assetID)
+		asset.CreateAttr("name", clip.Name)
+		asset.CreateAttr("start", "0s")
+		asset.CreateAttr("duration", "0s")
+		asset.CreateAttr("hasVideo", "1")
+		asset.CreateAttr("format", "r1")
+		asset.CreateAttr("src", clip.URL)
+
+		video := spine.CreateElement("video")
+		video.CreateAttr("ref", assetID)
+		video.CreateAttr("name", clip.Name)
+		video.CreateAttr("offset", fcpTime(clip.Start, fps))
+		video.CreateAttr("start", "0s")
+		video.CreateAttr("duration", fcpTime(clip.Frames, fps))
+	}
+
+	doc.Indent(2)
+	return doc.WriteToBytes()
+}
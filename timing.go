@@ -0,0 +1,159 @@
+// Keep track of how long each exported layer should be shown for, and write
+// that timing out as files that video tools can consume directly.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Layers which don't specify a duration are shown for this many seconds, so
+// that a single timed layer doesn't leave the rest of the deck at zero.
+const defaultSlideDuration = 5.0
+
+// Represent one exported layer in the order that it appears in the final
+// video, along with how long it should be shown for and where it came from.
+type Slide struct {
+	PngFile string
+	Duration float64
+
+	// The image filename and layer suffix which produced the slide, which
+	// are empty for generated slides such as the slate.
+	Image string
+	Layer string
+	SvgFile string
+	RenderSeconds float64
+
+	// The slide's position in the deck counting from 1, for numbering. It
+	// is zero for generated slides.
+	Number int
+
+	// The layer's title and speaker notes, if it has any.
+	Title string
+	Notes string
+
+	// The text of the <title> and <desc> elements visible on the slide, for
+	// its alt text.
+	AltTitle string
+	AltText string
+
+	// The subtitle cues shown during the slide, when they are burned in, and
+	// when the slide starts on the subtitles' clock.
+	Captions []*Cue
+	CaptionsStart float64
+
+	// The PNGs of the layer's camera move, if it has one, in order.
+	Frames []string
+
+	// The PNGs of the layer's variants, by name.
+	Variants map[string]string
+
+	// With --bounds, the box around what the slide draws on top of its
+	// background, as "x y width height" fractions of the page.
+	Bounds *[4]float64
+}
+
+// Return how long the slide should be shown for, in seconds.
+func (slide *Slide) seconds() float64 {
+	if slide.Duration <= 0 {
+		return defaultSlideDuration
+	}
+	return slide.Duration
+}
+
+// Report whether any of the slides were given an explicit duration, in which
+// case the timing files are worth writing at all.
+func hasTiming(slides []*Slide) bool {
+	for _, slide := range slides {
+		if slide.Duration > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Quote a path for use in an ffmpeg concat demuxer file, which uses shell-like
+// single quotes with '\'' as the escape for an embedded quote.
+func quoteConcatPath(path string) string {
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
+
+// Write an ffmpeg concat demuxer file listing every slide and its duration.
+// Paths are written relative to the directory of the file, which is how
+// ffmpeg resolves them. Returns the ffmpeg command which assembles the video
+// at the given frame rate.
+func writeConcatFile(concatFile string, slides []*Slide, fps int) (string, error) {
+	if fps <= 0 {
+		return "", fmt.Errorf("frame rate must be positive, not %d", fps)
+	}
+	concatDir := filepath.Dir(concatFile)
+	command := fmt.Sprintf("ffmpeg -f concat -safe 0 -i %s -vf fps=%d,format=yuv420p %s",
+		concatFile, fps, filepath.Join(concatDir, "slides.mp4"))
+
+	var builder strings.Builder
+	builder.WriteString("ffconcat version 1.0\n")
+	fmt.Fprintf(&builder, "# %s\n", command)
+
+	var relPath string
+	for _, slide := range slides {
+		var err error
+		if relPath, err = filepath.Rel(concatDir, slide.PngFile); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&builder, "file %s\nduration %g\n", quoteConcatPath(filepath.ToSlash(relPath)), slide.seconds())
+	}
+
+	// The concat demuxer ignores the duration of the final entry unless the
+	// file is repeated once more afterwards.
+	if len(slides) > 0 {
+		fmt.Fprintf(&builder, "file %s\n", quoteConcatPath(filepath.ToSlash(relPath)))
+	}
+
+	if err := os.WriteFile(concatFile, []byte(builder.String()), 0644); err != nil {
+		return "", err
+	}
+	return command, nil
+}
+
+// Determine the duration of each layer of an image, in seconds. An explicit
+// duration always wins; otherwise the duration may be derived from the
+// layer's narration audio, or else from the subtitle file attached to the
+// image. Zero means "use the default".
+func (image *Image) layerDurations(inDir string) ([]float64, error) {
+	durations := make([]float64, len(image.Layers))
+	for i, layer := range image.Layers {
+		durations[i] = layer.Duration
+		if durations[i] <= 0 && layer.Audio != "" {
+			duration, err := audioDuration(resolvePath(inDir, layer.Audio))
+			if err != nil {
+				return nil, fmt.Errorf("layer %s: %w", layer.Suffix, err)
+			}
+			durations[i] = duration
+		}
+	}
+
+	if image.Subtitles != "" {
+		cues, err := parseSubtitles(resolvePath(inDir, image.Subtitles))
+		if err != nil {
+			return nil, err
+		}
+		starts, err := image.subtitleStarts(cues)
+		if err != nil {
+			return nil, err
+		}
+		derived, err := subtitleDurations(starts, cues)
+		if err != nil {
+			return nil, err
+		}
+		for i := range durations {
+			if durations[i] <= 0 {
+				durations[i] = derived[i]
+			}
+		}
+	}
+
+	return durations, nil
+}
@@ -0,0 +1,112 @@
+// Log what each of a layer's directives did to the document with --trace:
+// every element it touched, with its attributes before and after and whether
+// that showed or hid it. This saves diffing the intermediate SVGs by hand to
+// find the directive which misfired.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Represent the state of an element which the trace compares: its
+// attributes, and whether it is drawn at all.
+type traceState struct {
+	attrs map[string]string
+	visible bool
+}
+
+// Represent the trace of one layer, holding the document's state as of the
+// last directive. A nil trace (without --trace) does nothing.
+type layerTrace struct {
+	where string
+	doc *etree.Document
+	states map[*etree.Element]*traceState
+	order []*etree.Element
+}
+
+// Take the state of every element in the document.
+func traceSnapshot(doc *etree.Document) map[*etree.Element]*traceState {
+	states := make(map[*etree.Element]*traceState)
+	for _, element := range doc.FindElements("//*") {
+		state := &traceState{attrs: make(map[string]string), visible: isVisible(element)}
+		for _, attr := range element.Attr {
+			state.attrs[attr.FullKey()] = attr.Value
+		}
+		states[element] = state
+	}
+	return states
+}
+
+// Start tracing a layer, if the run is tracing at all.
+func (run *Run) traceLayer(image *Image, layer *ImageLayer, doc *etree.Document) *layerTrace {
+	if !run.Trace {
+		return nil
+	}
+	where := image.Filename + " layer " + layer.Suffix
+	if run.Locale != "" {
+		where = image.Filename + " (" + run.Locale + ") layer " + layer.Suffix
+	}
+	return &layerTrace{where: where, doc: doc, states: traceSnapshot(doc), order: doc.FindElements("//*")}
+}
+
+// Log every element which the named directive changed since the one before,
+// in document order. A directive which the layer uses but which changed
+// nothing is logged as such, since that is often the one which misfired.
+func (trace *layerTrace) step(directive string, used bool) {
+	if trace == nil {
+		return
+	}
+	states := traceSnapshot(trace.doc)
+	var changes []string
+	for _, element := range trace.order {
+		if _, exists := states[element]; !exists {
+			changes = append(changes, "removed "+elementName(element))
+		}
+	}
+	order := trace.doc.FindElements("//*")
+	for _, element := range order {
+		before, existed := trace.states[element]
+		after := states[element]
+		if !existed {
+			changes = append(changes, "added "+elementName(element))
+			continue
+		}
+		keys := maps.Clone(before.attrs)
+		maps.Copy(keys, after.attrs)
+		var diffs []string
+		for _, key := range slices.Sorted(maps.Keys(keys)) {
+			old, hadOld := before.attrs[key]
+			new, hasNew := after.attrs[key]
+			switch {
+			case !hasNew:
+				diffs = append(diffs, fmt.Sprintf("%s %q removed", key, old))
+			case !hadOld:
+				diffs = append(diffs, fmt.Sprintf("%s set to %q", key, new))
+			case old != new:
+				diffs = append(diffs, fmt.Sprintf("%s %q -> %q", key, old, new))
+			}
+		}
+		if before.visible != after.visible && after.visible {
+			diffs = append(diffs, "now visible")
+		} else if before.visible != after.visible {
+			diffs = append(diffs, "now hidden")
+		}
+		if len(diffs) > 0 {
+			changes = append(changes, elementName(element)+" "+strings.Join(diffs, ", "))
+		}
+	}
+	if len(changes) == 0 && used {
+		changes = append(changes, "no changes")
+	}
+	for _, change := range changes {
+		log.Printf("TRACE %s: %s: %s\n", trace.where, directive, change)
+	}
+	trace.states, trace.order = states, order
+}
@@ -0,0 +1,188 @@
+// Let bespoke changes to the SVG (filling in today's date, a build number,
+// ...) be plugged in as transforms, rather than growing the core for them.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Represent what a transform is told about where it is being applied. Options
+// are the transform's own settings from the config.
+type TransformContext struct {
+	Image *Image
+	Layer *ImageLayer
+	Options map[string]string
+}
+
+// Represent a change to an SVG document which is made for each layer, after
+// its elements have been hidden and shown and before it is exported. The
+// document is shared between the layers of an image, so a transform should
+// give the same result however many times it is applied.
+type Transform interface {
+	Apply(doc *etree.Document, context TransformContext) error
+}
+
+// Adapt an ordinary function to the Transform interface.
+type TransformFunc func(doc *etree.Document, context TransformContext) error
+
+// Call the function.
+func (transform TransformFunc) Apply(doc *etree.Document, context TransformContext) error {
+	return transform(doc, context)
+}
+
+// The transforms which can be named in "transforms:", by name.
+var transforms = map[string]Transform{
+	"text": TransformFunc(setTextTransform),
+	"date": TransformFunc(dateTransform),
+}
+
+// Make a transform available to configs under the given name. It is meant to
+// be called from an init function in the file which defines the transform.
+func registerTransform(name string, transform Transform) {
+	if _, ok := transforms[name]; ok {
+		panic(fmt.Sprintf("transform %q registered twice", name))
+	}
+	transforms[name] = transform
+}
+
+// Represent one entry of "transforms:", which is either a registered
+// transform or an external command.
+type TransformSpec struct {
+	Name string `yaml:"name,omitempty"`
+	Command string `yaml:"command,omitempty"`
+	Options map[string]string `yaml:"options,omitempty"`
+}
+
+// Check that the entry names exactly one transform which exists.
+func (spec *TransformSpec) validate() error {
+	switch {
+	case (spec.Name == "") == (spec.Command == ""):
+		return fmt.Errorf("transform needs exactly one of name or command")
+	case spec.Name != "" && transforms[spec.Name] == nil:
+		return fmt.Errorf("unknown transform %q", spec.Name)
+	}
+	return nil
+}
+
+// Apply the entry's transform to the document.
+func (spec *TransformSpec) apply(doc *etree.Document, context TransformContext) error {
+	context.Options = spec.Options
+	if spec.Command != "" {
+		return commandTransform(spec.Command, doc, context)
+	}
+	if err := transforms[spec.Name].Apply(doc, context); err != nil {
+		return fmt.Errorf("transform %s: %w", spec.Name, err)
+	}
+	return nil
+}
+
+// Apply the image's transforms and then the layer's own to the document.
+func (layer *ImageLayer) applyTransforms(image *Image, doc *etree.Document) error {
+	for _, spec := range slices.Concat(image.Transforms, layer.Transforms) {
+		if err := spec.apply(doc, TransformContext{Image: image, Layer: layer}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replace the text of the element with the "id" option by the "value" option,
+// such as a build number passed in through a ${VARIABLE}.
+func setTextTransform(doc *etree.Document, context TransformContext) error {
+	element, err := newElementIndex(doc, "").findOne(context.Options["id"])
+	if err != nil {
+		return err
+	}
+	setElementText(element, context.Options["value"])
+	return nil
+}
+
+// Replace the text of the element with the "id" option by today's date, in
+// the Go layout given by the "format" option (2006-01-02 by default).
+func dateTransform(doc *etree.Document, context TransformContext) error {
+	element, err := newElementIndex(doc, "").findOne(context.Options["id"])
+	if err != nil {
+		return err
+	}
+	format := context.Options["format"]
+	if format == "" {
+		format = "2006-01-02"
+	}
+	setElementText(element, time.Now().Format(format))
+	return nil
+}
+
+// Set the text shown by an element. Inkscape puts the text of a text element
+// into a tspan, so the first one that is found is kept (with its styling)
+// and any others are dropped.
+func setElementText(element *etree.Element, text string) {
+	if tspan := element.FindElement(".//tspan"); tspan != nil {
+		for _, other := range element.FindElements(".//tspan") {
+			if other != tspan && other.Parent() != nil {
+				other.Parent().RemoveChild(other)
+			}
+		}
+		element = tspan
+	}
+	for _, child := range element.Child {
+		if data, ok := child.(*etree.CharData); ok {
+			element.RemoveChild(data)
+		}
+	}
+	element.SetText(text)
+}
+
+// Run an external transform, which reads the SVG on stdin and writes the
+// changed one to stdout. It is told where it is being applied through
+// BULLETPOINTER_* environment variables, with each option in an
+// BULLETPOINTER_OPTION_<NAME> variable.
+func commandTransform(command string, doc *etree.Document, context TransformContext) error {
+	input, err := doc.WriteToBytes()
+	if err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Dir = filepath.Dir(context.Image.configFile)
+	cmd.Env = append(cmd.Environ(),
+		"BULLETPOINTER_CONFIG="+context.Image.configFile,
+		"BULLETPOINTER_IMAGE="+context.Image.Filename,
+		"BULLETPOINTER_LAYER="+context.Layer.Suffix)
+	for name, value := range context.Options {
+		cmd.Env = append(cmd.Env, "BULLETPOINTER_OPTION_"+strings.ToUpper(name)+"="+value)
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if text := trimOutput(stderr.String(), maxRendererOutput); text != "" {
+			err = fmt.Errorf("%w: %s", err, text)
+		}
+		return fmt.Errorf("transform %q failed: %w", command, err)
+	}
+
+	transformed := etree.NewDocument()
+	if err := transformed.ReadFromBytes(output); err != nil {
+		return fmt.Errorf("transform %q did not produce an SVG: %w", command, err)
+	}
+	if transformed.Root() == nil {
+		return fmt.Errorf("transform %q did not produce an SVG", command)
+	}
+	doc.SetRoot(transformed.Root())
+	return nil
+}
@@ -0,0 +1,263 @@
+// Browse the layers of a deck in the terminal and re-render, preview or edit
+// them one at a time, which is quicker than re-running the whole deck while
+// iterating on a few slides.
+
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Represent one row of the layer tree: a layer of an image, with the PNG it
+// is exported to.
+type tuiRow struct {
+	image *Image
+	layer *ImageLayer
+	pngFile string
+}
+
+// Describe whether a layer's PNG is there and newer than the inputs it was
+// made from. The check is only by modification time, so that listing a large
+// deck stays instant.
+func (row *tuiRow) status() string {
+	pngStat, err := os.Stat(row.pngFile)
+	if err != nil {
+		return "missing"
+	}
+	inputs := []string{row.image.configFile}
+	if !isRemote(row.image.Filename) {
+		inputs = append(inputs, resolvePath(row.image.baseDir, row.image.Filename))
+	}
+	for _, input := range inputs {
+		if inputStat, err := os.Stat(input); err == nil && inputStat.ModTime().After(pngStat.ModTime()) {
+			return "stale"
+		}
+	}
+	return "rendered"
+}
+
+// Load the configs afresh and list every layer, so that edits made from the
+// TUI show up straight away.
+func (options *RenderOptions) tuiRows() ([]*tuiRow, error) {
+	images, _, err := options.loadImages()
+	if err != nil {
+		return nil, err
+	}
+	if err := options.validateImages(images); err != nil {
+		return nil, err
+	}
+	var rows []*tuiRow
+	for _, image := range images {
+		names, _, err := image.outputNames(options.NameTemplate)
+		if err != nil {
+			return nil, err
+		}
+		for i, layer := range image.Layers {
+			pngFile := filepath.Join(options.OutDir, filepath.FromSlash(names[i]))
+			rows = append(rows, &tuiRow{image: image, layer: layer, pngFile: pngFile})
+		}
+	}
+	return rows, nil
+}
+
+// Print the tree of images and their numbered layers with their status.
+func writeTUITree(w io.Writer, rows []*tuiRow) {
+	var image *Image
+	for i, row := range rows {
+		if row.image != image {
+			image = row.image
+			fmt.Fprintf(w, "%s  (%s:%d)\n", image.Filename, image.configFile, image.configLine)
+		}
+		label := row.layer.Suffix
+		if row.layer.Title != "" {
+			label += "  " + row.layer.Title
+		}
+		fmt.Fprintf(w, "  %3d  %-8s  %s\n", i+1, row.status(), label)
+	}
+}
+
+// Show a PNG inline if the terminal has an image protocol (iTerm2's or
+// kitty's), or else open it in the desktop's image viewer.
+func previewPNG(w io.Writer, pngFile string) error {
+	data, err := os.ReadFile(pngFile)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	switch {
+	case os.Getenv("TERM_PROGRAM") == "iTerm.app" || os.Getenv("TERM_PROGRAM") == "WezTerm":
+		fmt.Fprintf(w, "\x1b]1337;File=inline=1;size=%d;width=80%%:%s\a\n", len(data), encoded)
+		return nil
+	case os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("TERM") == "xterm-kitty":
+		// Kitty takes the image in chunks of at most 4096 bytes.
+		for start := 0; start < len(encoded); start += 4096 {
+			end := min(start+4096, len(encoded))
+			more := 0
+			if end < len(encoded) {
+				more = 1
+			}
+			control := fmt.Sprintf("m=%d", more)
+			if start == 0 {
+				control = "a=T,f=100," + control
+			}
+			fmt.Fprintf(w, "\x1b_G%s;%s\x1b\\", control, encoded[start:end])
+		}
+		fmt.Fprintln(w)
+		return nil
+	}
+	var viewer *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		viewer = exec.Command("open", pngFile)
+	case "windows":
+		viewer = exec.Command("cmd", "/C", "start", "", pngFile)
+	default:
+		viewer = exec.Command("xdg-open", pngFile)
+	}
+	return viewer.Start()
+}
+
+// Open the config file at the line where a layer is defined, in $VISUAL or
+// $EDITOR (most of which understand "+line"). Without either, the location
+// is just printed.
+func editLayer(w io.Writer, row *tuiRow) error {
+	location := fmt.Sprintf("%s:%d", row.image.configFile, row.layer.line)
+	editor := cmp.Or(os.Getenv("VISUAL"), os.Getenv("EDITOR"))
+	if editor == "" {
+		fmt.Fprintln(w, location)
+		return nil
+	}
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], fmt.Sprintf("+%d", row.layer.line), row.image.configFile)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// Re-render just the given layers, with one run per image, leaving the rest
+// of the output directory as it is. The layers before each one are still
+// applied, so it comes out the same as in a full render.
+func (options *RenderOptions) rerender(rows []*tuiRow) error {
+	for start := 0; start < len(rows); {
+		rerun := *options
+		rerun.ImagePatterns = []string{rows[start].image.Filename}
+		rerun.LayerPatterns = nil
+		rerun.Progress = false
+		end := start
+		for ; end < len(rows) && rows[end].image == rows[start].image; end++ {
+			rerun.LayerPatterns = append(rerun.LayerPatterns, rows[end].layer.Suffix)
+		}
+		if err := rerun.render(); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// Pick out the rows named by numbers (such as "3" or "2-5") in a command's
+// arguments, or every row if there are none.
+func pickRows(rows []*tuiRow, args []string) ([]*tuiRow, error) {
+	if len(args) == 0 {
+		return rows, nil
+	}
+	var picked []*tuiRow
+	for _, arg := range args {
+		first, last, isRange := strings.Cut(arg, "-")
+		from, err := strconv.Atoi(first)
+		to := from
+		if err == nil && isRange {
+			to, err = strconv.Atoi(last)
+		}
+		if err != nil || from < 1 || to > len(rows) || from > to {
+			return nil, fmt.Errorf("no layer %s; pick from 1-%d", arg, len(rows))
+		}
+		picked = append(picked, rows[from-1:to]...)
+	}
+	return picked, nil
+}
+
+// The commands understood at the TUI's prompt.
+const tuiHelp = `Commands:
+  l            list the layers again (after reloading the config)
+  r [N...]     re-render layers N (such as 3 or 2-5), or all of them
+  s            re-render the layers which are missing or stale
+  p N          preview layer N inline, or in the image viewer
+  e N          edit the config at layer N (with $VISUAL or $EDITOR)
+  q            quit`
+
+// Run the interactive layer browser on the configs and output directory.
+func tuiCommand(name string, args []string) {
+	options := parseRenderOptions(name, args, nil)
+	if err := os.MkdirAll(options.OutDir, 0755); err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	rows, err := options.tuiRows()
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	writeTUITree(os.Stdout, rows)
+	fmt.Println("Type ? for help.")
+
+	input := bufio.NewScanner(os.Stdin)
+	for fmt.Print("> "); input.Scan(); fmt.Print("> ") {
+		fields := strings.Fields(input.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		// Reload before every command, so that the numbers and line
+		// numbers match the config as it is now.
+		if rows, err = options.tuiRows(); err != nil {
+			log.Printf("%s\n", err.Error())
+			continue
+		}
+		command, args := fields[0], fields[1:]
+		switch command {
+		case "q", "quit", "exit":
+			return
+		case "?", "h", "help":
+			fmt.Println(tuiHelp)
+			continue
+		case "l", "ls", "list":
+			writeTUITree(os.Stdout, rows)
+			continue
+		case "s":
+			var stale []*tuiRow
+			for _, row := range rows {
+				if row.status() != "rendered" {
+					stale = append(stale, row)
+				}
+			}
+			err = options.rerender(stale)
+		case "r", "p", "e":
+			var picked []*tuiRow
+			if picked, err = pickRows(rows, args); err != nil {
+				break
+			}
+			if command == "r" {
+				err = options.rerender(picked)
+			} else if len(args) != 1 || len(picked) != 1 {
+				err = fmt.Errorf("%s needs a single layer number", command)
+			} else if command == "p" {
+				err = previewPNG(os.Stdout, picked[0].pngFile)
+			} else {
+				err = editLayer(os.Stdout, picked[0])
+			}
+		default:
+			err = fmt.Errorf("unknown command %q; type ? for help", command)
+		}
+		if err != nil {
+			log.Printf("%s\n", err.Error())
+		}
+	}
+}
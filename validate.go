@@ -0,0 +1,302 @@
+// Check the YAML configuration for problems up front, before any of the
+// (slow) rendering work starts.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Suffixes become part of filenames and renderer arguments, so they are
+// limited to characters which are safe on every platform.
+var safeSuffix = regexp.MustCompile(`^[A-Za-z0-9._-]*$`)
+var unsafeSuffixRun = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Replace every run of unsafe characters in a suffix with an underscore.
+func normalizeSuffix(suffix string) string {
+	return unsafeSuffixRun.ReplaceAllString(suffix, "_")
+}
+
+// Check that every layer and composite suffix of the image is safe to use in
+// a filename, optionally normalizing the unsafe ones in place, and that no two
+// of them would end up writing the same output file.
+func (image *Image) validateSuffixes(normalize bool) error {
+	var problems []string
+	seen := make(map[string]string)
+
+	check := func(kind string, suffix *string) {
+		original := *suffix
+		if !safeSuffix.MatchString(*suffix) {
+			if !normalize {
+				problems = append(problems, fmt.Sprintf("%s suffix %q contains characters outside [A-Za-z0-9._-]", kind, original))
+				return
+			}
+			*suffix = normalizeSuffix(*suffix)
+		}
+		if other, ok := seen[*suffix]; ok {
+			problems = append(problems, fmt.Sprintf("%s suffix %q collides with %q", kind, original, other))
+			return
+		}
+		seen[*suffix] = original
+	}
+
+	for _, layer := range image.Layers {
+		check("layer", &layer.Suffix)
+	}
+	for _, composite := range image.Composites {
+		check("composite", &composite.Suffix)
+	}
+	for _, card := range image.cards() {
+		check(card.kind+" card", &card.Suffix)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %s", image.Filename, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Check that no two outputs of the whole run have the same name, since the
+// later one would silently overwrite the earlier: two images with the same
+// base name, say, or a name template which leaves out the suffix. Camera and
+// crossfade frames and variants count too, as they are named after their
+// layer.
+func validateOutputs(images []*Image, runTemplate string) error {
+	writers := make(map[string][]string)
+	var names []string
+	write := func(name, writer string) {
+		if writers[name] == nil {
+			names = append(names, name)
+		}
+		writers[name] = append(writers[name], writer)
+	}
+	for _, image := range images {
+		layers, composites, err := image.outputNames(runTemplate)
+		if err != nil {
+			return fmt.Errorf("%s: %w", image.Filename, err)
+		}
+		for i, name := range layers {
+			layer := image.Layers[i]
+			writer := fmt.Sprintf("%s layer %s (%s:%d)", image.Filename, layer.Suffix, image.configFile, layer.line)
+			write(name, writer)
+			for _, frame := range layer.Camera.framePngs(name) {
+				write(frame, writer+" camera frame")
+			}
+			for j, variant := range layer.variantPngs(name) {
+				write(variant, writer+" variant "+layer.Variants[j].Name)
+			}
+			if i == len(layers)-1 {
+				continue
+			}
+			for frame := 1; frame <= image.CrossfadeFrames; frame++ {
+				write(fmt.Sprintf("%s_xfade%02d.png", strings.TrimSuffix(name, ".png"), frame), writer+" crossfade")
+			}
+		}
+		for i, name := range composites {
+			write(name, fmt.Sprintf("%s composite %s (%s)", image.Filename, image.Composites[i].Suffix, image.configFile))
+		}
+		cards, err := image.cardNames(runTemplate)
+		if err != nil {
+			return fmt.Errorf("%s: %w", image.Filename, err)
+		}
+		for i, name := range cards {
+			write(name, fmt.Sprintf("%s %s card (%s)", image.Filename, image.cards()[i].kind, image.configFile))
+		}
+	}
+
+	var problems []string
+	for _, name := range names {
+		if len(writers[name]) > 1 {
+			problems = append(problems, fmt.Sprintf("%s is written by %s", name, strings.Join(writers[name], " and ")))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// The output formats which can be listed in "formats:" or --format. PNG is
+// always produced, since every other output is derived from it.
+var knownFormats = map[string]bool{"png": true, "pdf": true, "jpeg": true, "webp": true, "tiff": true}
+
+// Check that every requested output format is one that is supported,
+// rewriting alternative spellings (jpg, tif) to the canonical name in place.
+func validateFormats(formats []string) error {
+	for i, format := range formats {
+		formats[i] = canonicalFormat(strings.ToLower(strings.TrimSpace(format)))
+		if !knownFormats[formats[i]] {
+			return fmt.Errorf("unknown output format %q", format)
+		}
+	}
+	return nil
+}
+
+// Check that everything the image refers to outside the YAML is present: the
+// SVG itself, exactly one element for each ID its layers hide, show or
+// patch, the pages they export, the files it links to, its overlays, the
+// files its composites stack up and its timing sources. Every problem is
+// returned rather than just the first.
+func (image *Image) checkInputs(fetcher *remoteFetcher) []error {
+	inDir := image.baseDir
+	var problems []error
+	if image.BaseDir != "" {
+		if stat, err := os.Stat(inDir); err != nil || !stat.IsDir() {
+			return append(problems, &ConfigError{fmt.Errorf("%s: base_dir %s is not a directory", image.Filename, image.BaseDir)})
+		}
+	}
+	inFile, err := image.sourceFile(fetcher)
+	if err != nil {
+		return append(problems, &InputError{err})
+	}
+	doc := etree.NewDocument()
+	if err := readSVG(doc, inFile); err != nil {
+		return append(problems, &InputError{fmt.Errorf("%s: error reading SVG XML file: %w", image.Filename, err)})
+	}
+	if err := resolveAssets(doc, image.Filename, inFile); err != nil {
+		problems = append(problems, &InputError{fmt.Errorf("%s: %w", image.Filename, err)})
+	}
+	index := newElementIndex(doc, inFile)
+	for _, duplicate := range index.duplicates() {
+		log.Printf("WARNING %s: %s\n", image.Filename, duplicate)
+	}
+	if err := isolateElement(index, image.RootID); err != nil {
+		problems = append(problems, fmt.Errorf("%s: %w", image.Filename, err))
+	}
+	if _, err := insertOverlays(image.Overlays, index, inDir); err != nil {
+		problems = append(problems, fmt.Errorf("%s: %w", image.Filename, err))
+	}
+	for _, id := range image.backdropIDs() {
+		if _, err := index.resolve(id); err != nil {
+			problems = append(problems, fmt.Errorf("%s background_id: %w", image.Filename, err))
+		}
+	}
+	// Clones only exist from the layer that makes them onwards, so they are
+	// not looked for in the SVG itself.
+	cloned := make(map[string]bool)
+	for _, layer := range image.Layers {
+		ids := slices.Concat(layer.RemoveIDs, layer.HideIDs, layer.ShowIDs)
+		for _, variant := range layer.Variants {
+			ids = slices.Concat(ids, variant.HideIDs, variant.ShowIDs)
+		}
+		for _, spec := range layer.CloneIDs {
+			ids = append(ids, spec.ID)
+			cloned[spec.NewID] = true
+		}
+		if layer.Expect != nil {
+			ids = slices.Concat(ids, layer.Expect.Visible, layer.Expect.Hidden)
+		}
+		ids = append(ids, slices.Sorted(maps.Keys(layer.SetAttrs))...)
+		ids = append(ids, slices.Sorted(maps.Keys(layer.RemoveAttrs))...)
+		if err := checkPage(doc, layer.exportOptions(image).Page); err != nil {
+			problems = append(problems, fmt.Errorf("%s layer %s: %w", image.Filename, layer.Suffix, err))
+		}
+		overlays, err := insertOverlays(layer.Overlays, index, inDir)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s layer %s: %w", image.Filename, layer.Suffix, err))
+		}
+		for _, id := range ids {
+			if cloned[id] {
+				continue
+			}
+			if _, err := index.resolve(id); err != nil {
+				problems = append(problems, fmt.Errorf("%s layer %s: %w", image.Filename, layer.Suffix, err))
+			}
+		}
+		removeOverlays(overlays, index)
+	}
+	for _, locale := range slices.Sorted(maps.Keys(image.Locales)) {
+		for _, id := range slices.Sorted(maps.Keys(image.Locales[locale])) {
+			if _, err := index.findOne(id); err != nil {
+				problems = append(problems, fmt.Errorf("%s locale %s: %w", image.Filename, locale, err))
+			}
+		}
+	}
+	for _, composite := range image.Composites {
+		for _, source := range composite.Stack {
+			if source.File == "" {
+				continue
+			}
+			if _, err := os.Stat(resolvePath(inDir, source.File)); err != nil {
+				problems = append(problems, fmt.Errorf("%s composite %s: %w", image.Filename, composite.Suffix, err))
+			}
+		}
+	}
+	for _, card := range image.cards() {
+		if _, err := image.cardTemplate(card); err != nil {
+			problems = append(problems, fmt.Errorf("%s %s card: %w", image.Filename, card.kind, err))
+		}
+	}
+	if _, err := image.layerDurations(inDir); err != nil {
+		problems = append(problems, fmt.Errorf("%s: problem with timing: %w", image.Filename, err))
+	}
+	return problems
+}
+
+// Check a config file and the SVGs it refers to without rendering anything,
+// which is much quicker than finding a typo halfway through a render.
+func validateCommand(name string, args []string) {
+	flags := newFlagSet(name, "[options] in.yaml...")
+	options := &RenderOptions{}
+	options.registerFlags(flags)
+	flags.Parse(args)
+	if err := options.takePositional(flags.Args(), false); err != nil {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	images, configs, err := options.loadImages()
+	if err != nil {
+		fatal("", &ConfigError{err})
+	}
+	if _, err := options.runFormats(); err != nil {
+		fatal("", &ConfigError{err})
+	}
+	if err := options.validateImages(images); err != nil {
+		fatal("", &ConfigError{err})
+	}
+	images = options.selectLayers(images)
+	if images, err = options.selectImages(images); err != nil {
+		fatal("", &ConfigError{err})
+	}
+
+	fetcher, err := newRemoteFetcher(options.CacheDir)
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+	// Missing inputs take precedence in the exit code; anything else wrong
+	// is a mistake in the config.
+	exit := 0
+	report := func(problem error) {
+		log.Printf("%s\n", problem.Error())
+		if code := exitCode(problem); code == exitInput {
+			exit = exitInput
+		} else {
+			exit = max(exit, exitConfig)
+		}
+	}
+	layers := 0
+	for _, image := range images {
+		layers += len(image.Layers)
+		for _, problem := range image.checkInputs(fetcher) {
+			report(problem)
+		}
+		if options.RequireAlt {
+			if err := image.checkDescriptions(fetcher); err != nil {
+				report(err)
+			}
+		}
+	}
+	if exit != 0 {
+		os.Exit(exit)
+	}
+	infof("Valid: %s (%d images, %d layers)\n", strings.Join(configs, ", "), len(images), layers)
+}
@@ -0,0 +1,89 @@
+// Fill {{name}} placeholders in the text of the SVG with values known at
+// render time, such as the date and the revision the deck was built from.
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Match a {{name}} placeholder in text, allowing spaces inside the braces.
+var textPlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// The short git revisions of the directories that configs came from, looked
+// up once each since every image from the same config wants the same one.
+var gitRevisions sync.Map
+
+// Find the short revision of the git checkout a directory is in, or
+// "unknown" if it isn't in one (or git isn't installed).
+func gitRevision(dir string) string {
+	if revision, ok := gitRevisions.Load(dir); ok {
+		return revision.(string)
+	}
+	revision := "unknown"
+	if output, err := exec.Command("git", "-C", dir, "rev-parse", "--short", "HEAD").Output(); err == nil {
+		revision = strings.TrimSpace(string(output))
+	}
+	gitRevisions.Store(dir, revision)
+	return revision
+}
+
+// Work out the values of the placeholders for an image: the built-ins date,
+// git_sha (of the config's directory) and version (of this tool), then the
+// image's own variables and those given on the command line, each taking
+// precedence over the ones before.
+func (image *Image) textVariables(overrides map[string]string) map[string]string {
+	dir := image.baseDir
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	variables := map[string]string{
+		"date": time.Now().Format("2006-01-02"),
+		"git_sha": gitRevision(dir),
+		"version": toolVersion(),
+	}
+	maps.Copy(variables, image.Variables)
+	maps.Copy(variables, overrides)
+	return variables
+}
+
+// Replace the placeholders in all of the document's text. It is an error to
+// use a placeholder which has no value, rather than leave it on the slide.
+func substituteText(doc *etree.Document, variables map[string]string) error {
+	var undefined []string
+	var walk func(element *etree.Element)
+	walk = func(element *etree.Element) {
+		for _, token := range element.Child {
+			switch child := token.(type) {
+			case *etree.CharData:
+				child.Data = textPlaceholder.ReplaceAllStringFunc(child.Data, func(placeholder string) string {
+					name := textPlaceholder.FindStringSubmatch(placeholder)[1]
+					value, ok := variables[name]
+					if !ok {
+						undefined = append(undefined, name)
+						return placeholder
+					}
+					return value
+				})
+			case *etree.Element:
+				walk(child)
+			}
+		}
+	}
+	if root := doc.Root(); root != nil {
+		walk(root)
+	}
+	if len(undefined) > 0 {
+		return fmt.Errorf("no value for {{%s}} in the SVG text", strings.Join(undefined, "}}, {{"))
+	}
+	return nil
+}
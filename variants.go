@@ -0,0 +1,196 @@
+// Export more than one version of a layer from the same state of the
+// document: a full-screen slide and one which leaves room for the presenter's
+// camera, say. Each variant hides and shows some more elements on top of what
+// its layer does, and is written next to the layer's own PNG with a suffix of
+// its own added to the name.
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Represent a variant of a layer, named so that it can be told apart from
+// the others. Its suffix is added to the name of the layer's PNG, and is "_"
+// and the name unless given.
+type LayerVariant struct {
+	Name string `yaml:"name"`
+	Suffix string `yaml:"suffix,omitempty"`
+	HideIDs []string `yaml:"hide_ids,omitempty"`
+	ShowIDs []string `yaml:"show_ids,omitempty"`
+}
+
+// The attributes which hiding or showing an element may change.
+var visibilityAttrs = []string{"style", "display", "visibility"}
+
+// The suffix the variant adds to the name of its layer's PNG.
+func (variant *LayerVariant) suffix() string {
+	if variant.Suffix != "" {
+		return variant.Suffix
+	}
+	return "_" + variant.Name
+}
+
+// Name the PNG of a variant after that of its layer.
+func (variant *LayerVariant) pngName(pngFile string) string {
+	return strings.TrimSuffix(pngFile, ".png") + variant.suffix() + ".png"
+}
+
+// List the PNGs of a layer's variants, named after the layer's own PNG.
+func (layer *ImageLayer) variantPngs(pngFile string) []string {
+	var pngs []string
+	for _, variant := range layer.Variants {
+		pngs = append(pngs, variant.pngName(pngFile))
+	}
+	return pngs
+}
+
+// Check that every variant has a name, none of them share a name or suffix,
+// and the suffixes are safe to use in a filename.
+func (layer *ImageLayer) validateVariants() error {
+	names := make(map[string]bool)
+	suffixes := make(map[string]bool)
+	for _, variant := range layer.Variants {
+		switch {
+		case variant.Name == "":
+			return fmt.Errorf("every variant needs a name")
+		case names[variant.Name]:
+			return fmt.Errorf("there is more than one variant named %q", variant.Name)
+		case !safeSuffix.MatchString(variant.suffix()):
+			return fmt.Errorf("variant suffix %q contains characters outside [A-Za-z0-9._-]", variant.suffix())
+		case suffixes[variant.suffix()]:
+			return fmt.Errorf("there is more than one variant with the suffix %q", variant.suffix())
+		}
+		names[variant.Name] = true
+		suffixes[variant.suffix()] = true
+	}
+	return nil
+}
+
+// Hide and show the elements the variant asks for, returning a function which
+// puts them back as they were, for the next variant and the layers after.
+func (variant *LayerVariant) apply(index *elementIndex) (func(), error) {
+	type saved struct {
+		element *etree.Element
+		attrs map[string]*string
+	}
+	var changed []saved
+	restore := func() {
+		for i := len(changed) - 1; i >= 0; i-- {
+			for name, value := range changed[i].attrs {
+				if value == nil {
+					changed[i].element.RemoveAttr(name)
+				} else {
+					changed[i].element.CreateAttr(name, *value)
+				}
+			}
+		}
+	}
+	toggle := func(selectors []string, hidden bool) error {
+		for _, selector := range selectors {
+			elements, err := index.resolve(selector)
+			if err != nil {
+				return err
+			}
+			for _, element := range elements {
+				attrs := make(map[string]*string)
+				for _, name := range visibilityAttrs {
+					attrs[name] = nil
+					if attr := element.SelectAttr(name); attr != nil {
+						value := attr.Value
+						attrs[name] = &value
+					}
+				}
+				changed = append(changed, saved{element: element, attrs: attrs})
+				setHidden(element, hidden)
+			}
+		}
+		return nil
+	}
+
+	if err := toggle(variant.HideIDs, true); err != nil {
+		restore()
+		return nil, err
+	}
+	if err := toggle(variant.ShowIDs, false); err != nil {
+		restore()
+		return nil, err
+	}
+	return restore, nil
+}
+
+// Export one variant of a layer, from the document as the layer left it. Like
+// the layer itself, a variant whose PNG is up to date is skipped with
+// --resume.
+func (variant *LayerVariant) export(run *Run, image *Image, layer *ImageLayer, index *elementIndex, slide *Slide) (string, error) {
+	pngFile := variant.pngName(slide.PngFile)
+	restore, err := variant.apply(index)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	doc := index.doc
+	if run.Optimize {
+		doc, _ = optimizedCopy(index.doc, false)
+	}
+	renderer := run.imageRenderer(image)
+	pipe := run.pipesSVG(image, renderer)
+	svgHash := sha256.New()
+	var svgData []byte
+	var svgFile string
+	if pipe {
+		svgData, err = doc.WriteToBytes()
+		svgHash.Write(svgData)
+	} else if svgFile, err = run.svgPath(pngFile); err == nil {
+		err = writeFingerprinted(doc, svgFile, svgHash)
+	}
+	if err != nil {
+		return "", fmt.Errorf("problem writing the SVG of variant %s: %w", variant.Name, err)
+	}
+
+	options := layer.exportOptions(image)
+	fingerprint := exportFingerprint(svgHash, options, renderer, image.BurnCaptions, slide.Captions)
+	if run.Resume && pngFingerprint(pngFile) == fingerprint {
+		debugf("Already up to date: %s\n", pngFile)
+		run.Resumed.Add(1)
+		return pngFile, nil
+	}
+	if pipe {
+		err = renderer.exportPNGData(svgData, pngFile, options)
+	} else {
+		err = renderer.exportPNG(svgFile, pngFile, options)
+	}
+	if err != nil {
+		return "", &RenderError{fmt.Errorf("could not convert variant %s to PNG with Inkscape: %w", variant.Name, err)}
+	}
+	if err := image.BurnCaptions.burn(pngFile, captionLines(slide.Captions)); err != nil {
+		return "", fmt.Errorf("could not burn captions into %s: %w", pngFile, err)
+	}
+	if err := image.stampPNG(pngFile, layer.Suffix+variant.suffix(), layer.Title, layer.Notes, fingerprint); err != nil {
+		return "", fmt.Errorf("could not add metadata to %s: %w", pngFile, err)
+	}
+	debugf("Rendered %s\n", pngFile)
+	return pngFile, nil
+}
+
+// Export every variant of a layer, recording their PNGs on the slide by name.
+func (layer *ImageLayer) exportVariants(run *Run, image *Image, index *elementIndex, slide *Slide) error {
+	for _, variant := range layer.Variants {
+		stopRender := run.Profile.measure(image.Filename, layer.Suffix+variant.suffix(), "render")
+		pngFile, err := variant.export(run, image, layer, index, slide)
+		stopRender()
+		if err != nil {
+			return err
+		}
+		if slide.Variants == nil {
+			slide.Variants = make(map[string]string)
+		}
+		slide.Variants[variant.Name] = pngFile
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Re-render whenever the config or anything it refers to changes, which
+// makes for a quick edit-and-preview loop while working on the artwork.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"maps"
+	"os"
+	"strings"
+	"time"
+)
+
+// List every input file of a render: the config files (including those
+// included from others), and the SVGs, subtitles, audio and composite sources
+// they refer to. If a config can't be read then only the configs are
+// watched, so that fixing it triggers a new render. With --auto, the dirs
+// are watched for SVGs coming and going.
+func watchedFiles(options *RenderOptions) []string {
+	images, files, err := options.loadImages()
+	if err != nil {
+		return append(files, options.Configs...)
+	}
+	for _, image := range images {
+		inDir := image.baseDir
+		if !isRemote(image.Filename) {
+			files = append(files, resolvePath(inDir, image.Filename))
+		}
+		if image.Subtitles != "" {
+			files = append(files, resolvePath(inDir, image.Subtitles))
+		}
+		for _, layer := range image.Layers {
+			if layer.Audio != "" {
+				files = append(files, resolvePath(inDir, layer.Audio))
+			}
+		}
+		for _, composite := range image.Composites {
+			for _, source := range composite.Stack {
+				if source.File != "" {
+					files = append(files, resolvePath(inDir, source.File))
+				}
+			}
+		}
+		for _, card := range image.cards() {
+			if card.Template != "" {
+				files = append(files, resolvePath(inDir, card.Template))
+			}
+		}
+	}
+	return files
+}
+
+// Record the modification time of each file, with missing files recorded as
+// the zero time so that their creation counts as a change.
+func modTimes(files []string) map[string]time.Time {
+	times := make(map[string]time.Time)
+	for _, file := range files {
+		if stat, err := os.Stat(file); err == nil {
+			times[file] = stat.ModTime()
+		} else {
+			times[file] = time.Time{}
+		}
+	}
+	return times
+}
+
+// Render, then wait for an input to change and render again, until a signal
+// stops it. After every render the callback is given the slides and any
+// error.
+func watchRenders(options *RenderOptions, interval time.Duration, rendered func([]*Slide, error)) {
+	// A mistake in one layer shouldn't end the session; it will be fixed and
+	// rendered again on the next change.
+	options.KeepGoing = true
+
+	for {
+		// The times are taken before rendering, so that anything saved while
+		// the render is under way causes another one straight afterwards.
+		before := modTimes(watchedFiles(options))
+		slides, err := options.renderSlides()
+		if isInterrupted() {
+			return
+		}
+		rendered(slides, err)
+		for maps.Equal(before, modTimes(watchedFiles(options))) {
+			select {
+			case <-interrupted.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+		debugf("Change detected; rendering again\n")
+	}
+}
+
+// Entry point for "bulletpointer watch", which re-renders on every change.
+func watchCommand(name string, args []string) {
+	var interval time.Duration
+	options := parseRenderOptions(name, args, func(flags *flag.FlagSet) {
+		flags.DurationVar(&interval, "interval", time.Second, "how often to check the inputs for changes")
+	})
+	trapSignals()
+	watchRenders(options, interval, func(slides []*Slide, err error) {
+		if err != nil {
+			log.Printf("Render failed: %s\n", err.Error())
+		} else {
+			infof("Rendered %s; watching for changes\n", strings.Join(options.Configs, ", "))
+		}
+	})
+}